@@ -0,0 +1,351 @@
+// Package acs makes it easy to send emails via Azure Communication Services. This package follows [acs spec] strictly.
+// Requests are signed with HMAC-SHA256, so Config needs Key as the connection string of the resource
+// in the form of "endpoint=https://<resource>.communication.azure.com/;accesskey=<key>", BaseURL overrides its endpoint.
+//
+// ACS accepts an email as a long-running operation, the client returned by New returns as soon as the email is accepted
+// while the client returned by NewPolling waits until the operation reaches a terminal status.
+//
+// Example usage:
+//
+//	 email := emailer.Email{
+//		From:        "skywalker@jedi.com",
+//		To:          []string{"vindu@sith.com"},
+//		Subject:     "peace",
+//		TextContent: "peace was never an option",
+//	 }
+//	 c, err := New(emailer.Config{Key: "endpoint=https://jedi.communication.azure.com/;accesskey=c2VjcmV0"})
+//		if err != nil {
+//			//check err
+//		}
+//	 c.Send(ctx, email)
+//
+// [acs spec]: https://learn.microsoft.com/en-us/rest/api/communication/dataplane/email/send
+package acs
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrwormhole/emailer"
+)
+
+const (
+	apiVersion     = "2024-07-01"
+	sendPath       = "/emails:send"
+	operationsPath = "/emails/operations/"
+)
+
+// Statuses of a send operation, the ones other than StatusNotStarted and StatusRunning are terminal
+const (
+	StatusNotStarted = "NotStarted"
+	StatusRunning    = "Running"
+	StatusSucceeded  = "Succeeded"
+	StatusFailed     = "Failed"
+	StatusCanceled   = "Canceled"
+)
+
+// Capabilities describes what ACS can honour of an email
+var Capabilities = emailer.Capabilities{
+	// ACS limits an email to 50 recipients and 10MB of attachments
+	MaxRecipients:     50,
+	MaxAttachmentSize: 10 << 20,
+	InlineAttachments: true,
+}
+
+// EmailClient is ACS email client to interact with emails
+type EmailClient struct {
+	accessKey      []byte
+	baseURL        string
+	pollInterval   time.Duration
+	markdownLayout *template.Template
+	client         http.Client
+}
+
+// New creates a new ACS email client with given connection string and http.Client,
+// its sends wait for the send operation when PollInterval of c is set, see NewPolling
+func New(c emailer.Config) (*EmailClient, error) {
+	if strings.TrimSpace(c.Key) == "" {
+		return nil, errors.New("acs connection string is blank")
+	}
+	if c.PollInterval < 0 {
+		return nil, errors.New("acs poll interval must not be negative")
+	}
+	endpoint, accessKey, err := parseConnectionString(c.Key)
+	if err != nil {
+		return nil, err
+	}
+	e := &EmailClient{
+		accessKey:      accessKey,
+		baseURL:        cmp.Or(strings.TrimSuffix(c.BaseURL, "/"), endpoint),
+		pollInterval:   c.PollInterval,
+		markdownLayout: c.MarkdownLayout,
+		client:         c.Client,
+	}
+	return e, nil
+}
+
+func init() {
+	emailer.Register("acs", emailer.FactoryOf(New))
+}
+
+// Capabilities returns what ACS can honour of an email
+func (c *EmailClient) Capabilities() emailer.Capabilities {
+	return Capabilities
+}
+
+// NewPolling creates a new ACS email client like New whose sends wait until the send operation reaches a terminal status.
+// The status is checked every interval unless ACS asks for another one with Retry-After
+func NewPolling(c emailer.Config, interval time.Duration) (*EmailClient, error) {
+	if interval <= 0 {
+		return nil, errors.New("acs poll interval must be positive")
+	}
+	c.PollInterval = interval
+	return New(c)
+}
+
+// parseConnectionString returns the endpoint and decoded access key of a connection string
+func parseConnectionString(s string) (string, []byte, error) {
+	var endpoint, accessKey string
+	for _, part := range strings.Split(s, ";") {
+		// base64 access keys end with "=", so only the first one separates the name
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch strings.ToLower(k) {
+		case "endpoint":
+			endpoint = strings.TrimSuffix(v, "/")
+		case "accesskey":
+			accessKey = v
+		}
+	}
+	if endpoint == "" {
+		return "", nil, errors.New("acs connection string has no endpoint")
+	}
+	if accessKey == "" {
+		return "", nil, errors.New("acs connection string has no accesskey")
+	}
+	key, err := base64.StdEncoding.DecodeString(accessKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("base64.StdEncoding.DecodeString(accesskey): %v", err)
+	}
+	return endpoint, key, nil
+}
+
+// payload is a request that ACS uses to send email
+type payload struct {
+	SenderAddress string       `json:"senderAddress"`
+	Recipients    recipients   `json:"recipients"`
+	Content       content      `json:"content"`
+	Attachments   []attachment `json:"attachments,omitempty"`
+}
+
+type recipients struct {
+	To  []address `json:"to"`
+	CC  []address `json:"cc,omitempty"`
+	BCC []address `json:"bcc,omitempty"`
+}
+
+type address struct {
+	Address string `json:"address"`
+}
+
+type content struct {
+	Subject   string `json:"subject"`
+	PlainText string `json:"plainText,omitempty"`
+	HTML      string `json:"html,omitempty"`
+}
+
+// attachment is a file of ACS email, the inline ones have a content ID
+type attachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	ContentID   string `json:"contentId,omitempty"`
+	// ContentInBase64 is base64 encoded by JSON
+	ContentInBase64 []byte `json:"contentInBase64"`
+}
+
+// operation is the state of a send operation, ACS answers with it when it accepts an email and when it is polled
+type operation struct {
+	ID     string        `json:"id"`
+	Status string        `json:"status"`
+	Error  *errorMessage `json:"error"`
+}
+
+type errorMessage struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// errorResponse is a response when ACS rejects a request
+type errorResponse struct {
+	Error *errorMessage `json:"error"`
+}
+
+// OperationError is a send operation that ACS accepted but could not complete
+type OperationError struct {
+	ID      string
+	Status  string
+	Code    string
+	Message string
+}
+
+func (e *OperationError) Error() string {
+	if e.Code == "" && e.Message == "" {
+		return fmt.Sprintf("acs operation %s is %s", e.ID, e.Status)
+	}
+	return fmt.Sprintf("acs operation %s is %s: %s: %s", e.ID, e.Status, e.Code, e.Message)
+}
+
+// Unwrap returns emailer.ErrRejected, ACS ended the operation for good so the email must not be sent again as it is
+func (e *OperationError) Unwrap() error {
+	return emailer.ErrRejected
+}
+
+// Send sends a given email
+func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
+	_, err := c.SendMessage(ctx, email)
+	return err
+}
+
+// SendMessage sends a given email and returns the ID of its ACS send operation
+func (c *EmailClient) SendMessage(ctx context.Context, email emailer.Email) (string, error) {
+	if err := c.Capabilities().Check(email); err != nil {
+		return "", err
+	}
+	email, err := email.RenderMarkdown(c.markdownLayout)
+	if err != nil {
+		return "", fmt.Errorf("email.RenderMarkdown(): %v", err)
+	}
+
+	var p payload
+	p.SenderAddress = email.From
+	for _, e := range email.To {
+		p.Recipients.To = append(p.Recipients.To, address{Address: e})
+	}
+	for _, e := range email.CC {
+		p.Recipients.CC = append(p.Recipients.CC, address{Address: e})
+	}
+	for _, e := range email.BCC {
+		p.Recipients.BCC = append(p.Recipients.BCC, address{Address: e})
+	}
+	p.Content = content{Subject: email.Subject, PlainText: email.TextContent, HTML: email.HTMLContent}
+	for _, a := range email.Attachments {
+		p.Attachments = append(p.Attachments, attachment{
+			Name:            a.Filename,
+			ContentType:     cmp.Or(a.ContentType, "application/octet-stream"),
+			ContentID:       a.ContentID,
+			ContentInBase64: a.Data,
+		})
+	}
+
+	target := c.baseURL + sendPath + "?" + url.Values{"api-version": {apiVersion}}.Encode()
+	op, header, err := c.do(ctx, http.MethodPost, target, p)
+	if err != nil {
+		return "", err
+	}
+	if c.pollInterval == 0 {
+		return op.ID, nil
+	}
+	return op.ID, c.wait(ctx, op, header)
+}
+
+// wait polls the send operation until it reaches a terminal status, which is an OperationError unless it succeeded
+func (c *EmailClient) wait(ctx context.Context, op operation, header http.Header) error {
+	target := header.Get("Operation-Location")
+	if target == "" {
+		target = c.baseURL + operationsPath + url.PathEscape(op.ID) + "?" + url.Values{"api-version": {apiVersion}}.Encode()
+	}
+	for op.Status == "" || op.Status == StatusNotStarted || op.Status == StatusRunning {
+		timer := time.NewTimer(retryAfter(header, c.pollInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("acs operation %s: %w", op.ID, ctx.Err())
+		case <-timer.C:
+		}
+
+		var err error
+		op, header, err = c.do(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	if op.Status == StatusSucceeded {
+		return nil
+	}
+	opErr := &OperationError{ID: op.ID, Status: op.Status}
+	if op.Error != nil {
+		opErr.Code, opErr.Message = op.Error.Code, op.Error.Message
+	}
+	return opErr
+}
+
+// retryAfter returns the delay that ACS asks for in seconds, fallback when it asks for none
+func retryAfter(header http.Header, fallback time.Duration) time.Duration {
+	secs, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || secs <= 0 {
+		return fallback
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// do sends body as signed JSON to given target of ACS, a nil body sends nothing.
+// It returns the operation and the headers of a successful response
+func (c *EmailClient) do(ctx context.Context, method, target string, body any) (operation, http.Header, error) {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		reqBody, err = json.Marshal(body)
+		if err != nil {
+			return operation{}, nil, fmt.Errorf("json.Marshal(%v): %v", body, err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(reqBody))
+	if err != nil {
+		return operation{}, nil, fmt.Errorf("http.NewRequestWithContext(): %v", err)
+	}
+	req.Header.Add("accept", "application/json")
+	if body != nil {
+		req.Header.Add("content-type", "application/json")
+	}
+	sign(req, reqBody, c.accessKey, time.Now())
+
+	resp, err := emailer.Do(&c.client, req)
+	if err != nil {
+		return operation{}, nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		var op operation
+		if err := json.NewDecoder(resp.Body).Decode(&op); err != nil && !errors.Is(err, io.EOF) {
+			return operation{}, nil, fmt.Errorf("json.NewDecoder().Decode(): %v", err)
+		}
+		return op, resp.Header, nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return operation{}, nil, fmt.Errorf("io.ReadAll(): %v", err)
+	}
+	return operation{}, nil, emailer.NewStatusError(resp.StatusCode, respBody, func(body []byte) (any, bool) {
+		var m errorResponse
+		if err := json.Unmarshal(body, &m); err != nil || m.Error == nil {
+			return nil, false
+		}
+		return *m.Error, true
+	})
+}
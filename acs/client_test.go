@@ -0,0 +1,215 @@
+package acs
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+	"github.com/mrwormhole/emailer/emailtest"
+)
+
+// withConnectionString turns the key of c into a connection string of its base URL, configs without one get a made up endpoint
+func withConnectionString(c emailer.Config) emailer.Config {
+	endpoint := c.BaseURL
+	if endpoint == "" {
+		endpoint = "https://emailer.communication.azure.com"
+	}
+	c.Key = "endpoint=" + endpoint + "/;accesskey=" + base64.StdEncoding.EncodeToString([]byte(c.Key))
+	return c
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		newFunc func() (*EmailClient, error)
+		want    string
+	}{
+		{
+			name:    "blank connection string",
+			newFunc: func() (*EmailClient, error) { return New(emailer.Config{}) },
+			want:    "acs connection string is blank",
+		},
+		{
+			name:    "no endpoint",
+			newFunc: func() (*EmailClient, error) { return New(emailer.Config{Key: "accesskey=c2VjcmV0"}) },
+			want:    "acs connection string has no endpoint",
+		},
+		{
+			name: "no access key",
+			newFunc: func() (*EmailClient, error) {
+				return New(emailer.Config{Key: "endpoint=https://a.communication.azure.com/"})
+			},
+			want: "acs connection string has no accesskey",
+		},
+		{
+			name: "polling without interval",
+			newFunc: func() (*EmailClient, error) {
+				return NewPolling(emailer.Config{Key: "endpoint=https://a.communication.azure.com/;accesskey=c2VjcmV0"}, 0)
+			},
+			want: "acs poll interval must be positive",
+		},
+		{
+			name: "negative poll interval",
+			newFunc: func() (*EmailClient, error) {
+				return New(emailer.Config{Key: "endpoint=https://a.communication.azure.com/;accesskey=c2VjcmV0", PollInterval: -time.Second})
+			},
+			want: "acs poll interval must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.newFunc()
+			if err == nil || !cmp.Equal(tt.want, err.Error()) {
+				t.Errorf("New(): got=%v want=%q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseConnectionString(t *testing.T) {
+	endpoint, key, err := parseConnectionString("Endpoint=https://jedi.communication.azure.com/; AccessKey=c2VjcmV0PT0=")
+	if err != nil {
+		t.Fatalf("parseConnectionString(): %v", err)
+	}
+	if diff := cmp.Diff("https://jedi.communication.azure.com", endpoint); diff != "" {
+		t.Errorf("parseConnectionString(): endpoint diff=\n %v", diff)
+	}
+	if diff := cmp.Diff("secret==", string(key)); diff != "" {
+		t.Errorf("parseConnectionString(): key diff=\n %v", diff)
+	}
+
+	if _, _, err := parseConnectionString("endpoint=https://jedi.communication.azure.com/;accesskey=not base64"); err == nil {
+		t.Error("parseConnectionString(): got=nil want=error for access key that is not base64")
+	}
+}
+
+// recipientPaths are the paths of the request body that hold each recipient
+var recipientPaths = map[string][]string{
+	"to":  {"recipients.to.address"},
+	"cc":  {"recipients.cc.address"},
+	"bcc": {"recipients.bcc.address"},
+}
+
+// errorBody is how ACS rejects a request
+const errorBody = `{"error":{"code":"BadRequest","message":"conformance failure"}}`
+
+func TestConformance(t *testing.T) {
+	emailtest.RunSenderConformance(t, func(c emailer.Config) (emailer.Sender, error) {
+		return New(withConnectionString(c))
+	}, emailtest.Provider{Fake: emailtest.NewACSServer, Recipients: recipientPaths, ErrorBody: errorBody})
+}
+
+func TestFakeServer(t *testing.T) {
+	srv := emailtest.NewACSServer(t)
+	client, err := New(withConnectionString(srv.Config()))
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+
+	email := emailer.Email{
+		From:        "a@a.com",
+		To:          []string{"b@b.com"},
+		BCC:         []string{"bcc@bcc.com"},
+		Subject:     "sub",
+		HTMLContent: "<img src=\"cid:logo\">",
+		Attachments: []emailer.Attachment{{Filename: "logo.png", ContentType: "image/png", ContentID: "logo", Data: []byte("png")}},
+	}
+	id, err := client.SendMessage(context.Background(), email)
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	if id == "" {
+		t.Error("SendMessage(): operation ID is empty")
+	}
+	if got := len(srv.Requests()); got != 1 {
+		t.Errorf("SendMessage(): requests=%d want=1 without polling", got)
+	}
+	var got payload
+	if err := json.Unmarshal(srv.LastRequest().Body, &got); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
+	}
+	want := payload{
+		SenderAddress: "a@a.com",
+		Recipients:    recipients{To: []address{{Address: "b@b.com"}}, BCC: []address{{Address: "bcc@bcc.com"}}},
+		Content:       content{Subject: "sub", HTML: "<img src=\"cid:logo\">"},
+		Attachments:   []attachment{{Name: "logo.png", ContentType: "image/png", ContentID: "logo", ContentInBase64: []byte("png")}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SendMessage(): payload diff=\n %v", diff)
+	}
+
+	email.Subject = ""
+	var statusErr *emailer.StatusError
+	if err := client.Send(context.Background(), email); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Send(): got=%v want=status code(400)", err)
+	}
+	if diff := cmp.Diff(errorMessage{Code: "BadRequest", Message: "The subject is required"}, statusErr.Detail); diff != "" {
+		t.Errorf("Send(): error detail diff=\n %v", diff)
+	}
+
+	cfg := srv.Config()
+	cfg.Key = "wrong-key"
+	client, err = New(withConnectionString(cfg))
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	email.Subject = "sub"
+	if err := client.Send(context.Background(), email); err == nil || !strings.Contains(err.Error(), "status code(401)") {
+		t.Errorf("Send(): got=%v want=status code(401)", err)
+	}
+}
+
+func TestSend_Polling(t *testing.T) {
+	srv := emailtest.NewACSServer(t)
+	// the registry opens a polling client from the poll interval of config
+	cfg := withConnectionString(srv.Config())
+	cfg.PollInterval = time.Millisecond
+	s, err := emailer.Open("acs", cfg)
+	if err != nil {
+		t.Fatalf("emailer.Open(): %v", err)
+	}
+	client := s.(*EmailClient)
+
+	email := emailer.Email{From: "a@a.com", To: []string{"b@b.com"}, Subject: "sub", TextContent: "text"}
+	id, err := client.SendMessage(context.Background(), email)
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	last := srv.LastRequest()
+	if diff := cmp.Diff(http.MethodGet+" /emails/operations/"+id, last.Method+" "+last.Path); diff != "" {
+		t.Errorf("SendMessage(): last request diff=\n %v", diff)
+	}
+
+	email.To = []string{"b@" + emailtest.ACSFailed}
+	id, err = client.SendMessage(context.Background(), email)
+	var opErr *OperationError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("SendMessage(): got=%v want=operation error", err)
+	}
+	want := &OperationError{ID: id, Status: StatusFailed, Code: "EmailDroppedAllRecipientsSuppressed", Message: "Message was dropped"}
+	if diff := cmp.Diff(want, opErr); diff != "" {
+		t.Errorf("SendMessage(): operation error diff=\n %v", diff)
+	}
+	if !errors.Is(opErr, emailer.ErrRejected) {
+		t.Errorf("SendMessage(): error %q is not %v", opErr, emailer.ErrRejected)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	client, err = NewPolling(withConnectionString(srv.Config()), time.Hour)
+	if err != nil {
+		t.Fatalf("NewPolling(): %v", err)
+	}
+	if err := client.Send(ctx, email); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Send(): got=%v want=%v", err, context.DeadlineExceeded)
+	}
+}
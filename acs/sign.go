@@ -0,0 +1,27 @@
+package acs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"time"
+)
+
+// sign adds x-ms-date, x-ms-content-sha256 and Authorization headers to req, see [hmac authentication].
+// Date, host and content hash are signed together with method, path and query
+//
+// [hmac authentication]: https://learn.microsoft.com/en-us/rest/api/communication/authentication#authentication-with-hmac
+func sign(req *http.Request, body []byte, accessKey []byte, t time.Time) {
+	date := t.UTC().Format(http.TimeFormat)
+	sum := sha256.Sum256(body)
+	contentHash := base64.StdEncoding.EncodeToString(sum[:])
+	req.Header.Set("x-ms-date", date)
+	req.Header.Set("x-ms-content-sha256", contentHash)
+
+	stringToSign := req.Method + "\n" + req.URL.RequestURI() + "\n" + date + ";" + req.URL.Host + ";" + contentHash
+	h := hmac.New(sha256.New, accessKey)
+	h.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	req.Header.Set("Authorization", "HMAC-SHA256 SignedHeaders=x-ms-date;host;x-ms-content-sha256&Signature="+signature)
+}
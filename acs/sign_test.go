@@ -0,0 +1,60 @@
+package acs
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestSign checks sign against signatures computed with openssl from the string to sign of ACS hmac authentication,
+// "METHOD\nPATH?QUERY\nDATE;HOST;CONTENT-HASH", so a mistake in sign is not repeated by the expected values
+func TestSign(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		wantHash string
+		want     string
+	}{
+		{
+			name:     "send",
+			method:   http.MethodPost,
+			url:      "https://contoso.communication.azure.com/emails:send?api-version=2024-07-01",
+			body:     `{"senderAddress":"a@a.com"}`,
+			wantHash: "lnQ8TqKvASJZd955FcO4kXEi+gR4ffAWtb6fIko6srA=",
+			want:     "HMAC-SHA256 SignedHeaders=x-ms-date;host;x-ms-content-sha256&Signature=cB2iBH+D9NfuoWyXB+UQqROH+Ohh283rz8xD+ZLo/pg=",
+		},
+		{
+			name:     "poll with port",
+			method:   http.MethodGet,
+			url:      "https://contoso.communication.azure.com:8443/emails/operations/op-1?api-version=2024-07-01",
+			wantHash: "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+			want:     "HMAC-SHA256 SignedHeaders=x-ms-date;host;x-ms-content-sha256&Signature=aH3jfdbJW+ptsH0OumSaZ7huch/Kmw1WHe/zG7G3Fnw=",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("http.NewRequest(): %v", err)
+			}
+			sign(req, []byte(tt.body), []byte("secret"), at)
+
+			want := http.Header{
+				"X-Ms-Date":           {"Mon, 01 Jan 2024 00:00:00 GMT"},
+				"X-Ms-Content-Sha256": {tt.wantHash},
+				"Authorization":       {tt.want},
+			}
+			if diff := cmp.Diff(want, req.Header); diff != "" {
+				t.Errorf("sign(): diff=\n %v", diff)
+			}
+		})
+	}
+}
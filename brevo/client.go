@@ -19,24 +19,43 @@ package brevo
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
 	"net/http"
-	"net/http/httputil"
+	"net/url"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/mrwormhole/emailer"
 )
 
-const endpoint = "https://api.brevo.com/v3/smtp/email"
+const (
+	baseURL   = "https://api.brevo.com"
+	emailPath = "/v3/smtp/email"
+)
+
+// Capabilities describes what brevo can honour of an email
+var Capabilities = emailer.Capabilities{
+	// brevo limits an email to 99 recipients
+	MaxRecipients: 99,
+	// brevo cannot send inline attachments
+	InlineAttachments: false,
+	// brevo schedules emails up to 72 hours ahead
+	ScheduleHorizon: 72 * time.Hour,
+}
 
 // EmailClient is brevo email client to interact with emails
 type EmailClient struct {
-	key    string
-	client http.Client
+	key            string
+	baseURL        string
+	markdownLayout *template.Template
+	client         http.Client
 }
 
 // New creates a new brevo email client with given API key and http.Client
@@ -46,12 +65,23 @@ func New(c emailer.Config) (*EmailClient, error) {
 	}
 
 	e := &EmailClient{
-		key:    c.Key,
-		client: c.Client,
+		key:            c.Key,
+		baseURL:        cmp.Or(strings.TrimSuffix(c.BaseURL, "/"), baseURL),
+		markdownLayout: c.MarkdownLayout,
+		client:         c.Client,
 	}
 	return e, nil
 }
 
+func init() {
+	emailer.Register("brevo", emailer.FactoryOf(New))
+}
+
+// Capabilities returns what brevo can honour of an email
+func (c *EmailClient) Capabilities() emailer.Capabilities {
+	return Capabilities
+}
+
 // Detail is additional info about the person such as email and name
 type Detail struct {
 	Email string `json:"email"`
@@ -59,13 +89,27 @@ type Detail struct {
 
 // payload is a request that brevo uses to send email
 type payload struct {
-	Sender      Detail   `json:"sender"`
-	To          []Detail `json:"to"`
-	BCC         []Detail `json:"bcc"`
-	CC          []Detail `json:"cc"`
-	Subject     string   `json:"subject"`
-	HTMLContent string   `json:"htmlContent,omitempty"`
-	TextContent string   `json:"textContent,omitempty"`
+	Sender      Detail       `json:"sender"`
+	To          []Detail     `json:"to"`
+	BCC         []Detail     `json:"bcc"`
+	CC          []Detail     `json:"cc"`
+	Subject     string       `json:"subject"`
+	HTMLContent string       `json:"htmlContent,omitempty"`
+	TextContent string       `json:"textContent,omitempty"`
+	ScheduledAt string       `json:"scheduledAt,omitempty"`
+	Attachment  []attachment `json:"attachment,omitempty"`
+}
+
+// attachment is a file of brevo email, brevo cannot send inline attachments
+type attachment struct {
+	// Content is base64 encoded by JSON
+	Content []byte `json:"content"`
+	Name    string `json:"name"`
+}
+
+// result is a response when brevo accepts an email
+type result struct {
+	MessageID string `json:"messageId"`
 }
 
 // errorMessage is a response when brevo encounters a problem while sending email
@@ -76,6 +120,20 @@ type errorMessage struct {
 
 // Send sends a given email
 func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
+	_, err := c.SendMessage(ctx, email)
+	return err
+}
+
+// SendMessage sends a given email and returns its brevo message ID
+func (c *EmailClient) SendMessage(ctx context.Context, email emailer.Email) (string, error) {
+	if err := c.Capabilities().Check(email); err != nil {
+		return "", err
+	}
+	email, err := email.RenderMarkdown(c.markdownLayout)
+	if err != nil {
+		return "", fmt.Errorf("email.RenderMarkdown(): %v", err)
+	}
+
 	var p payload
 	p.Sender.Email = email.From
 	for _, e := range email.To {
@@ -90,12 +148,42 @@ func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
 	p.Subject = email.Subject
 	p.HTMLContent = email.HTMLContent
 	p.TextContent = email.TextContent
+	for _, a := range email.Attachments {
+		p.Attachment = append(p.Attachment, attachment{Content: a.Data, Name: a.Filename})
+	}
 
-	raw, err := json.Marshal(p)
-	if err != nil {
-		return fmt.Errorf("json.Marshal(%v): %v", p, err)
+	if !email.SendAt.IsZero() {
+		p.ScheduledAt = email.SendAt.UTC().Format(time.RFC3339)
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(raw))
+
+	var r result
+	if err := c.do(ctx, http.MethodPost, c.baseURL+emailPath, p, &r); err != nil {
+		return "", err
+	}
+	return r.MessageID, nil
+}
+
+// Cancel deletes a scheduled email by its brevo message ID
+func (c *EmailClient) Cancel(ctx context.Context, messageID string) error {
+	return emailer.NotFound(c.do(ctx, http.MethodDelete, c.baseURL+emailPath+"/"+url.PathEscape(messageID), nil, nil))
+}
+
+// Reschedule is not supported by brevo, scheduled emails can only be deleted
+func (c *EmailClient) Reschedule(context.Context, string, time.Time) error {
+	return fmt.Errorf("brevo can not reschedule: %w", errors.ErrUnsupported)
+}
+
+// do sends body as JSON to given target of brevo, then decodes a successful response into out when it is not nil
+func (c *EmailClient) do(ctx context.Context, method, target string, body, out any) error {
+	var reqBody io.Reader = http.NoBody
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("json.Marshal(%v): %v", body, err)
+		}
+		reqBody = bytes.NewBuffer(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reqBody)
 	if err != nil {
 		return fmt.Errorf("http.NewRequestWithContext(): %v", err)
 	}
@@ -103,23 +191,31 @@ func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
 	req.Header.Add("accept", "application/json")
 	req.Header.Add("content-type", "application/json")
 
-	resp, err := c.client.Do(req) //nolint:gosec //endpoint is already a constant
+	resp, err := emailer.Do(&c.client, req)
 	if err != nil {
-		return fmt.Errorf("client.Do(%v): %v", req, err)
+		return err
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
 
-	if slices.Contains([]int{http.StatusAccepted, http.StatusCreated, http.StatusOK}, resp.StatusCode) {
+	if slices.Contains([]int{http.StatusAccepted, http.StatusCreated, http.StatusOK, http.StatusNoContent}, resp.StatusCode) {
+		if out == nil {
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("json.NewDecoder().Decode(): %v", err)
+		}
 		return nil
 	}
 
-	var m errorMessage
-	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
-		dump, _ := httputil.DumpResponse(resp, true)
-		return fmt.Errorf("json.NewDecoder(%v).Decode(): %v", string(dump), err)
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("io.ReadAll(): %v", err)
 	}
-
-	return fmt.Errorf("unsuccessful response with status code(%d): %v", resp.StatusCode, m)
+	return emailer.NewStatusError(resp.StatusCode, raw, func(body []byte) (any, bool) {
+		var m errorMessage
+		err := json.Unmarshal(body, &m)
+		return m, err == nil
+	})
 }
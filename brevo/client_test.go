@@ -1,16 +1,13 @@
 package brevo
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
-	"io"
-	"log/slog"
 	"net/http"
-	"net/http/httptest"
-	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
@@ -26,48 +23,30 @@ func TestNew(t *testing.T) {
 	}
 }
 
-func TestEmailHandler_BrokenRequest(t *testing.T) {
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/email", bytes.NewBuffer([]byte{'h', 'e', 'l', 'l', 'o'}))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(nil)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusBadRequest, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=\n %v", diff)
-	}
-
-	if diff := cmp.Diff("Failed to decode request: invalid character 'h' looking for beginning of value\n", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=\n %v", diff)
-	}
+// recipientPaths are the paths of the request body that hold each recipient
+var recipientPaths = map[string][]string{
+	"to":  {"to.email"},
+	"cc":  {"cc.email"},
+	"bcc": {"bcc.email"},
 }
 
-func TestEmailHandler_FailedValidation(t *testing.T) {
-	email := emailer.Email{
-		From: "a@a.com",
-	}
-	raw, err := json.Marshal(email)
-	if err != nil {
-		t.Fatalf("json.Marshal(%v): %v", email, err)
-	}
-
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/email", bytes.NewBuffer(raw))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(nil)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusBadRequest, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=\n %v", diff)
-	}
+// errorBody is how brevo rejects a request
+const errorBody = `{"code":"invalid_parameter","message":"conformance failure"}`
 
-	if diff := cmp.Diff("Failed to validate: to field must not be blank\n", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=\n %v", diff)
-	}
+func TestConformance(t *testing.T) {
+	emailtest.RunSenderConformance(t, func(c emailer.Config) (emailer.Sender, error) {
+		return New(c)
+	}, emailtest.Provider{Fake: emailtest.NewBrevoServer, Recipients: recipientPaths, ErrorBody: errorBody})
 }
 
-func TestEmailHandler_Success(t *testing.T) {
+func TestSend_Schedule(t *testing.T) {
+	var got payload
 	tripper := func(req *http.Request) *http.Response {
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Fatalf("json.NewDecoder().Decode(): %v", err)
+		}
 		return &http.Response{
-			StatusCode: http.StatusOK,
+			StatusCode: http.StatusCreated,
 		}
 	}
 	client, err := New(emailtest.NewConfig(tripper))
@@ -75,39 +54,34 @@ func TestEmailHandler_Success(t *testing.T) {
 		t.Fatalf("New(): %v", err)
 	}
 
+	sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
 	email := emailer.Email{
 		From:        "a@a.com",
 		To:          []string{"b@b.com"},
-		BCC:         []string{"bcc@bcc.com"},
-		CC:          []string{"cc@cc.com"},
 		Subject:     "sub",
-		HTMLContent: "html",
+		TextContent: "text",
+		SendAt:      sendAt,
 	}
-	raw, err := json.Marshal(email)
-	if err != nil {
-		t.Fatalf("json.Marshal(%v): %v", email, err)
+	if err := client.Send(context.Background(), email); err != nil {
+		t.Fatalf("Send(): %v", err)
 	}
-
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/send", bytes.NewBuffer(raw))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(client)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusOK, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=\n %v", diff)
+	if diff := cmp.Diff(sendAt.UTC().Format(time.RFC3339), got.ScheduledAt); diff != "" {
+		t.Errorf("Send(): ScheduledAt diff=\n %v", diff)
 	}
 
-	if diff := cmp.Diff("Email successfully sent", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=\n %v", diff)
+	email.SendAt = time.Now().Add(Capabilities.ScheduleHorizon + time.Hour)
+	if err := client.Send(context.Background(), email); !errors.Is(err, emailer.ErrScheduleHorizon) {
+		t.Errorf("Send(): got=%v want=%v", err, emailer.ErrScheduleHorizon)
 	}
 }
 
-func TestEmailHandler_FaultyClient(t *testing.T) {
-	slog.SetLogLoggerLevel(slog.Level(100))
-	tripper := func(req *http.Request) *http.Response {
-		return nil
+func TestSend_InlineAttachment(t *testing.T) {
+	var calls int
+	tripper := func(*http.Request) *http.Response {
+		calls++
+		return &http.Response{StatusCode: http.StatusCreated}
 	}
-	client, err := New(emailtest.NewFaultyClientConfig(tripper))
+	client, err := New(emailtest.NewConfig(tripper))
 	if err != nil {
 		t.Fatalf("New(): %v", err)
 	}
@@ -116,32 +90,23 @@ func TestEmailHandler_FaultyClient(t *testing.T) {
 		From:        "a@a.com",
 		To:          []string{"b@b.com"},
 		Subject:     "sub",
-		HTMLContent: "html",
-	}
-	raw, err := json.Marshal(email)
-	if err != nil {
-		t.Fatalf("json.Marshal(%v): %v", email, err)
+		HTMLContent: `<img src="cid:logo">`,
+		Attachments: []emailer.Attachment{{Filename: "logo.png", ContentID: "logo", Data: []byte("png")}},
 	}
-
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/send", bytes.NewBuffer(raw))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(client)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusInternalServerError, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=\n %v", diff)
+	if err := client.Send(context.Background(), email); !errors.Is(err, emailer.ErrIncompatible) {
+		t.Errorf("Send(): got=%v want=%v", err, emailer.ErrIncompatible)
 	}
-
-	if diff := cmp.Diff("Failed to send email\n", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=\n %v", diff)
+	if calls != 0 {
+		t.Errorf("Send(): %d requests are sent for an inline attachment", calls)
 	}
 }
 
-func TestEmailHandler_TeapotClient(t *testing.T) {
-	slog.SetLogLoggerLevel(slog.Level(100))
+func TestCancel(t *testing.T) {
+	var method, url string
 	tripper := func(req *http.Request) *http.Response {
+		method, url = req.Method, req.URL.String()
 		return &http.Response{
-			StatusCode: http.StatusTeapot,
+			StatusCode: http.StatusNoContent,
 		}
 	}
 	client, err := New(emailtest.NewConfig(tripper))
@@ -149,49 +114,20 @@ func TestEmailHandler_TeapotClient(t *testing.T) {
 		t.Fatalf("New(): %v", err)
 	}
 
-	email := emailer.Email{
-		From:        "a@a.com",
-		To:          []string{"b@b.com"},
-		Subject:     "sub",
-		HTMLContent: "html",
+	if err := client.Cancel(context.Background(), "<id@smtp-relay.mailin.fr>"); err != nil {
+		t.Fatalf("Cancel(): %v", err)
 	}
-	raw, err := json.Marshal(email)
-	if err != nil {
-		t.Fatalf("json.Marshal(%v): %v", email, err)
+	if diff := cmp.Diff(http.MethodDelete+" "+baseURL+emailPath+"/%3Cid@smtp-relay.mailin.fr%3E", method+" "+url); diff != "" {
+		t.Errorf("Cancel(): request diff=\n %v", diff)
 	}
-
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/send", bytes.NewBuffer(raw))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(client)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusInternalServerError, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=\n %v", diff)
-	}
-
-	if diff := cmp.Diff("Failed to send email\n", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=\n %v", diff)
+	if err := client.Reschedule(context.Background(), "id", time.Now()); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Reschedule(): got=%v want=%v", err, errors.ErrUnsupported)
 	}
 }
 
-func TestEmailHandler_ProviderCodeMessage(t *testing.T) {
-	slog.SetLogLoggerLevel(slog.Level(100))
-	tripper := func(req *http.Request) *http.Response {
-		cm := errorMessage{
-			Code:    strconv.Itoa(http.StatusBadRequest),
-			Message: "brevo don't like that",
-		}
-		raw, err := json.Marshal(cm)
-		if err != nil {
-			t.Fatalf("json.Marshal(%v): %v", cm, err)
-		}
-
-		return &http.Response{
-			StatusCode: http.StatusBadRequest,
-			Body:       io.NopCloser(bytes.NewBuffer(raw)),
-		}
-	}
-	client, err := New(emailtest.NewConfig(tripper))
+func TestFakeServer(t *testing.T) {
+	srv := emailtest.NewBrevoServer(t)
+	client, err := New(srv.Config())
 	if err != nil {
 		t.Fatalf("New(): %v", err)
 	}
@@ -199,24 +135,56 @@ func TestEmailHandler_ProviderCodeMessage(t *testing.T) {
 	email := emailer.Email{
 		From:        "a@a.com",
 		To:          []string{"b@b.com"},
+		CC:          []string{"cc@cc.com"},
 		Subject:     "sub",
-		HTMLContent: "html",
+		TextContent: "text",
+		Attachments: []emailer.Attachment{{Filename: "logo.png", Data: []byte("png")}},
 	}
-	raw, err := json.Marshal(email)
-	if err != nil {
-		t.Fatalf("json.Marshal(%v): %v", email, err)
+	if _, err := client.SendMessage(context.Background(), email); err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	var got payload
+	if err := json.Unmarshal(srv.LastRequest().Body, &got); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
+	}
+	want := payload{
+		Sender:      Detail{Email: "a@a.com"},
+		To:          []Detail{{Email: "b@b.com"}},
+		CC:          []Detail{{Email: "cc@cc.com"}},
+		Subject:     "sub",
+		TextContent: "text",
+		Attachment:  []attachment{{Content: []byte("png"), Name: "logo.png"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SendMessage(): payload diff=\n %v", diff)
 	}
 
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/send", bytes.NewBuffer(raw))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(client)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusInternalServerError, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=\n %v", diff)
+	email.SendAt = time.Now().Add(time.Hour)
+	id, err := client.SendMessage(context.Background(), email)
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	if err := client.Cancel(context.Background(), id); err != nil {
+		t.Errorf("Cancel(): %v", err)
+	}
+	if err := client.Cancel(context.Background(), id); !errors.Is(err, emailer.ErrMessageNotFound) {
+		t.Errorf("Cancel(): got=%v want=%v", err, emailer.ErrMessageNotFound)
+	}
+	if diff := cmp.Diff(4, len(srv.Requests())); diff != "" {
+		t.Errorf("Requests(): diff=\n %v", diff)
 	}
 
-	if diff := cmp.Diff("Failed to send email\n", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=\n %v", diff)
+	email.To = []string{"not-an-address"}
+	if err := client.Send(context.Background(), email); err == nil {
+		t.Error("Send(): expected error, got nil")
+	}
+	cfg := srv.Config()
+	cfg.Key = "wrong-key"
+	client, err = New(cfg)
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	if err := client.Send(context.Background(), email); err == nil || !strings.Contains(err.Error(), "status code(401)") {
+		t.Errorf("Send(): got=%v want=status code(401)", err)
 	}
 }
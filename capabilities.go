@@ -0,0 +1,80 @@
+package emailer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrIncompatible is returned when an email uses features that the provider can not honour
+var ErrIncompatible = errors.New("email is incompatible with the provider")
+
+// Capabilities describes what a provider can honour of an email, so emails are rejected before sending instead of losing fields.
+// Email has no custom headers, tags or templates, so there is nothing to describe for them
+type Capabilities struct {
+	// MaxRecipients limits To, CC and BCC addresses together, 0 means no limit
+	MaxRecipients int `json:"maxRecipients" yaml:"maxRecipients"`
+	// MaxAttachmentSize limits the data of attachments together in bytes before any encoding, 0 means no limit
+	MaxAttachmentSize int `json:"maxAttachmentSize" yaml:"maxAttachmentSize"`
+	// InlineAttachments reports whether attachments with a ContentID are sent inline
+	InlineAttachments bool `json:"inlineAttachments" yaml:"inlineAttachments"`
+	// ScheduleHorizon is how far in the future SendAt can be, 0 means SendAt is not honoured
+	ScheduleHorizon time.Duration `json:"scheduleHorizon" yaml:"scheduleHorizon"`
+}
+
+// Capable is a behaviour for email senders that describe their capabilities.
+// Provider senders of this module also check emails against them when they send, so they are safe to call directly
+type Capable interface {
+	Capabilities() Capabilities
+}
+
+// Check returns an error wrapping ErrIncompatible that lists every feature of e that c can not honour, nil otherwise.
+// The error wraps ErrScheduleHorizon as well when SendAt is beyond the schedule horizon
+func (c Capabilities) Check(e Email) error {
+	var (
+		problems []string
+		beyond   error
+	)
+	if n := len(e.To) + len(e.CC) + len(e.BCC); c.MaxRecipients > 0 && n > c.MaxRecipients {
+		problems = append(problems, fmt.Sprintf("%d recipients exceed the limit of %d", n, c.MaxRecipients))
+	}
+	size, inline := 0, false
+	for _, a := range e.Attachments {
+		size += len(a.Data)
+		inline = inline || a.ContentID != ""
+	}
+	if c.MaxAttachmentSize > 0 && size > c.MaxAttachmentSize {
+		problems = append(problems, fmt.Sprintf("attachments of %d bytes exceed the limit of %d bytes", size, c.MaxAttachmentSize))
+	}
+	if inline && !c.InlineAttachments {
+		problems = append(problems, "inline attachments are not supported")
+	}
+	if wait := time.Until(e.SendAt); !e.SendAt.IsZero() && wait > 0 {
+		switch {
+		case c.ScheduleHorizon == 0:
+			problems = append(problems, "scheduled emails are not supported")
+		case wait > c.ScheduleHorizon:
+			beyond = fmt.Errorf("%w of %v by %v", ErrScheduleHorizon, c.ScheduleHorizon, (wait - c.ScheduleHorizon).Round(time.Second))
+		}
+	}
+
+	switch {
+	case beyond != nil && len(problems) > 0:
+		return fmt.Errorf("%w: %s, %w", ErrIncompatible, strings.Join(problems, ", "), beyond)
+	case beyond != nil:
+		return fmt.Errorf("%w: %w", ErrIncompatible, beyond)
+	case len(problems) > 0:
+		return fmt.Errorf("%w: %s", ErrIncompatible, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// CheckCapabilities checks e against the capabilities of sender when it is [Capable], other senders accept any email
+func CheckCapabilities(sender Sender, e Email) error {
+	c, ok := sender.(Capable)
+	if !ok {
+		return nil
+	}
+	return c.Capabilities().Check(e)
+}
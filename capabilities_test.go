@@ -0,0 +1,137 @@
+package emailer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// capableSender is a sender that counts sends and describes its capabilities
+type capableSender struct {
+	caps  Capabilities
+	sends int
+}
+
+func (s *capableSender) Send(context.Context, Email) error {
+	s.sends++
+	return nil
+}
+
+func (s *capableSender) Capabilities() Capabilities {
+	return s.caps
+}
+
+func TestCapabilities_Check(t *testing.T) {
+	caps := Capabilities{MaxRecipients: 2, MaxAttachmentSize: 4, ScheduleHorizon: time.Hour}
+
+	tests := []struct {
+		name    string
+		caps    Capabilities
+		email   Email
+		wantErr string
+		// wantHorizon is whether the error wraps ErrScheduleHorizon as well
+		wantHorizon bool
+	}{
+		{
+			name:  "compatible",
+			caps:  caps,
+			email: Email{To: []string{"a@a.com"}, CC: []string{"b@b.com"}, Attachments: []Attachment{{Data: []byte("data")}}, SendAt: time.Now().Add(time.Minute)},
+		},
+		{
+			name:  "no limits",
+			email: Email{To: []string{"a@a.com", "b@b.com", "c@c.com"}, Attachments: []Attachment{{Data: []byte("data")}}},
+		},
+		{
+			name:  "sendAt in the past",
+			email: Email{SendAt: time.Now().Add(-time.Minute)},
+		},
+		{
+			name:    "too many recipients",
+			caps:    caps,
+			email:   Email{To: []string{"a@a.com"}, CC: []string{"b@b.com"}, BCC: []string{"c@c.com"}},
+			wantErr: "email is incompatible with the provider: 3 recipients exceed the limit of 2",
+		},
+		{
+			name:    "large and inline attachments",
+			caps:    caps,
+			email:   Email{Attachments: []Attachment{{Data: []byte("data")}, {ContentID: "logo", Data: []byte("logo")}}},
+			wantErr: "email is incompatible with the provider: attachments of 8 bytes exceed the limit of 4 bytes, inline attachments are not supported",
+		},
+		{
+			name:    "scheduled email",
+			email:   Email{SendAt: time.Now().Add(time.Minute)},
+			wantErr: "email is incompatible with the provider: scheduled emails are not supported",
+		},
+		{
+			name:        "beyond schedule horizon",
+			caps:        caps,
+			email:       Email{SendAt: time.Now().Add(2 * time.Hour)},
+			wantErr:     "email is incompatible with the provider: sendAt is beyond the schedule horizon of 1h0m0s by 1h0m0s",
+			wantHorizon: true,
+		},
+		{
+			name:        "too many recipients beyond schedule horizon",
+			caps:        caps,
+			email:       Email{To: []string{"a@a.com", "b@b.com", "c@c.com"}, SendAt: time.Now().Add(2 * time.Hour)},
+			wantErr:     "email is incompatible with the provider: 3 recipients exceed the limit of 2, sendAt is beyond the schedule horizon of 1h0m0s by 1h0m0s",
+			wantHorizon: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.caps.Check(tt.email)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Check(): %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrIncompatible) {
+				t.Fatalf("Check(): got=%v want=%v", err, ErrIncompatible)
+			}
+			if got := errors.Is(err, ErrScheduleHorizon); got != tt.wantHorizon {
+				t.Errorf("Check(): wraps %v=%v, want=%v", ErrScheduleHorizon, got, tt.wantHorizon)
+			}
+			if diff := cmp.Diff(tt.wantErr, err.Error()); diff != "" {
+				t.Errorf("Check(): diff=\n %v", diff)
+			}
+		})
+	}
+}
+
+func TestSendMessage_Incompatible(t *testing.T) {
+	sender := &capableSender{caps: Capabilities{MaxRecipients: 1}}
+
+	if _, err := SendMessage(context.Background(), sender, Email{To: []string{"a@a.com", "b@b.com"}}); !errors.Is(err, ErrIncompatible) {
+		t.Errorf("SendMessage(): got=%v want=%v", err, ErrIncompatible)
+	}
+	if _, err := SendMessage(context.Background(), sender, Email{To: []string{"a@a.com"}}); err != nil {
+		t.Errorf("SendMessage(): %v", err)
+	}
+	if diff := cmp.Diff(1, sender.sends); diff != "" {
+		t.Errorf("SendMessage(): sends diff=\n %v", diff)
+	}
+}
+
+func TestLocalScheduler_Incompatible(t *testing.T) {
+	sender := &capableSender{caps: Capabilities{MaxRecipients: 1}}
+	s := NewLocalScheduler(sender, time.Second)
+	defer s.Close()
+
+	// held emails are checked as they will be sent, without SendAt
+	email := Email{To: []string{"a@a.com"}, SendAt: time.Now().Add(time.Hour)}
+	if _, err := s.SendMessage(context.Background(), email); err != nil {
+		t.Errorf("SendMessage(): %v", err)
+	}
+	email.To = append(email.To, "b@b.com")
+	if _, err := s.SendMessage(context.Background(), email); !errors.Is(err, ErrIncompatible) {
+		t.Errorf("SendMessage(): got=%v want=%v", err, ErrIncompatible)
+	}
+	if diff := cmp.Diff(1, s.Pending()); diff != "" {
+		t.Errorf("Pending(): diff=\n %v", diff)
+	}
+}
@@ -0,0 +1,147 @@
+// Package catcher keeps emails in a local inbox instead of sending them, so they can be inspected during development and QA.
+//
+// Example usage:
+//
+//	 inbox, err := catcher.New("")
+//		if err != nil {
+//			//check err
+//		}
+//	 inbox.Send(ctx, email)
+//	 inbox.RegisterHandlers(mux)
+package catcher
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrwormhole/emailer"
+)
+
+// Message is an email caught by the inbox
+type Message struct {
+	ID         string        `json:"id"`
+	ReceivedAt time.Time     `json:"receivedAt"`
+	Email      emailer.Email `json:"email"`
+}
+
+// Inbox is an email sender that keeps every email in memory, and on disk when it has a directory.
+// It is safe for concurrent use.
+type Inbox struct {
+	dir string
+
+	mu       sync.RWMutex
+	messages []Message
+}
+
+// New creates an inbox that persists messages as JSON files in dir and loads the ones already there.
+// Blank dir keeps messages only in memory.
+func New(dir string) (*Inbox, error) {
+	i := &Inbox{dir: dir}
+	if dir == "" {
+		return i, nil
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("os.MkdirAll(%q): %v", dir, err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Glob(): %v", err)
+	}
+	for _, p := range paths {
+		raw, err := os.ReadFile(p) //nolint:gosec //path is listed from the configured directory
+		if err != nil {
+			return nil, fmt.Errorf("os.ReadFile(%q): %v", p, err)
+		}
+		var m Message
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal(%q): %v", p, err)
+		}
+		i.messages = append(i.messages, m)
+	}
+	slices.SortFunc(i.messages, func(a, b Message) int {
+		return cmp.Or(a.ReceivedAt.Compare(b.ReceivedAt), strings.Compare(a.ID, b.ID))
+	})
+	return i, nil
+}
+
+// Send catches a given email
+func (i *Inbox) Send(ctx context.Context, e emailer.Email) error {
+	_, err := i.SendMessage(ctx, e)
+	return err
+}
+
+// SendMessage catches a given email and returns its inbox ID, markdown content is rendered as a provider would
+func (i *Inbox) SendMessage(_ context.Context, e emailer.Email) (string, error) {
+	e, err := e.RenderMarkdown(nil)
+	if err != nil {
+		return "", fmt.Errorf("email.RenderMarkdown(): %v", err)
+	}
+	m := Message{ID: strings.ToLower(rand.Text()), ReceivedAt: time.Now().UTC(), Email: e}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.dir != "" {
+		raw, err := json.Marshal(m)
+		if err != nil {
+			return "", fmt.Errorf("json.Marshal(): %v", err)
+		}
+		if err := os.WriteFile(i.path(m.ID), raw, 0o600); err != nil {
+			return "", fmt.Errorf("os.WriteFile(): %v", err)
+		}
+	}
+	i.messages = append(i.messages, m)
+	return m.ID, nil
+}
+
+// Messages returns caught messages, the newest first
+func (i *Inbox) Messages() []Message {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	ms := slices.Clone(i.messages)
+	slices.Reverse(ms)
+	return ms
+}
+
+// Message returns the caught message with given ID, it reports whether the message exists
+func (i *Inbox) Message(id string) (Message, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	idx := slices.IndexFunc(i.messages, func(m Message) bool { return m.ID == id })
+	if idx < 0 {
+		return Message{}, false
+	}
+	return i.messages[idx], true
+}
+
+// Clear removes every caught message
+func (i *Inbox) Clear() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	var errs []error
+	if i.dir != "" {
+		for _, m := range i.messages {
+			if err := os.Remove(i.path(m.ID)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("os.Remove(): %v", err))
+			}
+		}
+	}
+	i.messages = nil
+	return errors.Join(errs...)
+}
+
+// path returns the file path of the message with given ID
+func (i *Inbox) path(id string) string {
+	return filepath.Join(i.dir, id+".json")
+}
@@ -0,0 +1,83 @@
+package catcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+)
+
+func TestInbox(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  func(t *testing.T) string
+	}{
+		{name: "memory", dir: func(*testing.T) string { return "" }},
+		{name: "disk", dir: func(t *testing.T) string { return t.TempDir() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tt.dir(t)
+			inbox, err := New(dir)
+			if err != nil {
+				t.Fatalf("New(): %v", err)
+			}
+
+			emails := []emailer.Email{
+				{From: "a@a.com", To: []string{"b@b.com"}, Subject: "first", TextContent: "text"},
+				{From: "a@a.com", To: []string{"c@c.com"}, Subject: "second", MarkdownContent: "**md**"},
+			}
+			var ids []string
+			for _, e := range emails {
+				id, err := inbox.SendMessage(context.Background(), e)
+				if err != nil {
+					t.Fatalf("SendMessage(): %v", err)
+				}
+				ids = append(ids, id)
+			}
+
+			var subjects []string
+			for _, m := range inbox.Messages() {
+				subjects = append(subjects, m.Email.Subject)
+			}
+			if diff := cmp.Diff([]string{"second", "first"}, subjects); diff != "" {
+				t.Errorf("Messages(): subjects diff=\n %v", diff)
+			}
+			m, ok := inbox.Message(ids[1])
+			if !ok {
+				t.Fatalf("Message(%q): not found", ids[1])
+			}
+			if m.Email.MarkdownContent != "" || m.Email.HTMLContent == "" {
+				t.Errorf("Message(%q): markdown is not rendered %+v", ids[1], m.Email)
+			}
+
+			if dir != "" {
+				reopened, err := New(dir)
+				if err != nil {
+					t.Fatalf("New(): %v", err)
+				}
+				if diff := cmp.Diff(inbox.Messages(), reopened.Messages()); diff != "" {
+					t.Errorf("New(): reopened messages diff=\n %v", diff)
+				}
+			}
+
+			if err := inbox.Clear(); err != nil {
+				t.Fatalf("Clear(): %v", err)
+			}
+			if diff := cmp.Diff(0, len(inbox.Messages())); diff != "" {
+				t.Errorf("Messages(): diff=\n %v", diff)
+			}
+			if dir != "" {
+				reopened, err := New(dir)
+				if err != nil {
+					t.Fatalf("New(): %v", err)
+				}
+				if diff := cmp.Diff(0, len(reopened.Messages())); diff != "" {
+					t.Errorf("New(): reopened messages diff=\n %v", diff)
+				}
+			}
+		})
+	}
+}
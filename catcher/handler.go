@@ -0,0 +1,136 @@
+package catcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"log/slog"
+	"net/http"
+
+	"github.com/mrwormhole/emailer/mime"
+)
+
+// page is the web inbox, it lists caught messages and previews the selected one in a sandboxed frame
+var page = template.Must(template.New("inbox").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Inbox ({{len .Messages}})</title>
+<style>
+body { font-family: sans-serif; margin: 0; display: flex; height: 100vh; }
+nav { width: 35%; overflow-y: auto; border-right: 1px solid #ddd; }
+main { flex: 1; display: flex; flex-direction: column; }
+a.message { display: block; padding: 8px 12px; border-bottom: 1px solid #eee; color: inherit; text-decoration: none; }
+a.message.selected { background: #eef3ff; }
+small { color: #666; }
+header { padding: 8px 12px; border-bottom: 1px solid #ddd; }
+iframe { flex: 1; border: 0; }
+</style>
+</head>
+<body>
+<nav>
+<header>
+<strong>{{len .Messages}} messages</strong>
+<button onclick="fetch('/inbox', {method: 'DELETE'}).then(() => location.assign('/'))">Clear all</button>
+</header>
+{{range .Messages}}
+<a class="message{{if eq .ID $.Selected.ID}} selected{{end}}" href="/?id={{.ID}}">
+<strong>{{.Email.Subject}}</strong><br>
+<small>{{.Email.From}} &rarr; {{range $i, $to := .Email.To}}{{if $i}}, {{end}}{{$to}}{{end}}</small><br>
+<small>{{.ReceivedAt.Format "2006-01-02 15:04:05"}}</small>
+</a>
+{{end}}
+</nav>
+<main>
+{{with .Selected.ID}}
+<header>
+<strong>{{$.Selected.Email.Subject}}</strong><br>
+<small>From: {{$.Selected.Email.From}}</small><br>
+<small>To: {{$.Selected.Email.To}} Cc: {{$.Selected.Email.CC}} Bcc: {{$.Selected.Email.BCC}}</small><br>
+{{with $.Selected.Email.Attachments}}<small>Attachments: {{range $i, $a := .}}{{if $i}}, {{end}}{{$a.Filename}}{{end}}</small><br>{{end}}
+<a href="/inbox/{{.}}/raw">Download .eml</a> <a href="/inbox/{{.}}">JSON</a>
+</header>
+<iframe sandbox src="/inbox/{{.}}/html"></iframe>
+{{else}}
+<header>Select a message</header>
+{{end}}
+</main>
+</body>
+</html>
+`))
+
+// RegisterHandlers registers the web inbox at / and its JSON API under /inbox
+func (i *Inbox) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /{$}", i.pageHandler)
+	mux.HandleFunc("GET /inbox", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, r, i.Messages())
+	})
+	mux.HandleFunc("DELETE /inbox", func(w http.ResponseWriter, r *http.Request) {
+		if err := i.Clear(); err != nil {
+			slog.LogAttrs(r.Context(), slog.LevelError, "inbox.Clear()", slog.String("err", err.Error()))
+			http.Error(w, "Failed to clear inbox", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /inbox/{id}", i.messageHandler(func(w http.ResponseWriter, r *http.Request, m Message) {
+		writeJSON(w, r, m)
+	}))
+	mux.HandleFunc("GET /inbox/{id}/html", i.messageHandler(func(w http.ResponseWriter, _ *http.Request, m Message) {
+		body := m.Email.HTMLContent
+		if body == "" {
+			body = "<pre>" + html.EscapeString(m.Email.TextContent) + "</pre>"
+		}
+		// caught HTML is untrusted, the sandbox keeps its scripts away from the inbox
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = fmt.Fprint(w, body)
+	}))
+	mux.HandleFunc("GET /inbox/{id}/raw", i.messageHandler(func(w http.ResponseWriter, r *http.Request, m Message) {
+		b, err := mime.New(m.Email).MessageID(fmt.Sprintf("<%s@catcher.local>", m.ID)).Date(m.ReceivedAt).KeepBCC().Build()
+		if err != nil {
+			slog.LogAttrs(r.Context(), slog.LevelError, "mime.New().Build()", slog.String("id", m.ID), slog.String("err", err.Error()))
+			http.Error(w, "Failed to render message", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "message/rfc822")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", m.ID+".eml"))
+		_, _ = w.Write(b)
+	}))
+}
+
+// pageHandler renders the web inbox with the message of id query parameter selected
+func (i *Inbox) pageHandler(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Messages []Message
+		Selected Message
+	}{Messages: i.Messages()}
+	if id := r.URL.Query().Get("id"); id != "" {
+		data.Selected, _ = i.Message(id)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := page.Execute(w, data); err != nil {
+		slog.LogAttrs(r.Context(), slog.LevelError, "page.Execute()", slog.String("err", err.Error()))
+	}
+}
+
+// messageHandler looks up the message of id path value, then passes it to h
+func (i *Inbox) messageHandler(h func(w http.ResponseWriter, r *http.Request, m Message)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m, ok := i.Message(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return
+		}
+		h(w, r, m)
+	}
+}
+
+// writeJSON writes v as JSON response of r
+func writeJSON(w http.ResponseWriter, r *http.Request, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.LogAttrs(r.Context(), slog.LevelError, "json.NewEncoder().Encode()", slog.String("err", err.Error()))
+	}
+}
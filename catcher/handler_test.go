@@ -0,0 +1,169 @@
+package catcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+)
+
+func TestRegisterHandlers(t *testing.T) {
+	inbox, err := New("")
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	email := emailer.Email{
+		From:        "a@a.com",
+		To:          []string{"b@b.com"},
+		BCC:         []string{"bcc@bcc.com"},
+		Subject:     "héllo",
+		HTMLContent: "<p>html</p>",
+		TextContent: "text",
+	}
+	id, err := inbox.SendMessage(context.Background(), email)
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	mux := http.NewServeMux()
+	inbox.RegisterHandlers(mux)
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequestWithContext(context.Background(), method, target, nil))
+		return rr
+	}
+
+	tests := []struct {
+		name        string
+		target      string
+		wantCode    int
+		wantType    string
+		wantContain string
+	}{
+		{name: "page", target: "/?id=" + id, wantCode: http.StatusOK, wantType: "text/html; charset=utf-8", wantContain: "héllo"},
+		{name: "list", target: "/inbox", wantCode: http.StatusOK, wantType: "application/json", wantContain: `"id":"` + id + `"`},
+		{name: "message", target: "/inbox/" + id, wantCode: http.StatusOK, wantType: "application/json", wantContain: `"subject":"héllo"`},
+		{name: "preview", target: "/inbox/" + id + "/html", wantCode: http.StatusOK, wantType: "text/html; charset=utf-8", wantContain: "<p>html</p>"},
+		{name: "raw", target: "/inbox/" + id + "/raw", wantCode: http.StatusOK, wantType: "message/rfc822", wantContain: "Bcc: bcc@bcc.com"},
+		{name: "unknown message", target: "/inbox/unknown", wantCode: http.StatusNotFound, wantType: "text/plain; charset=utf-8", wantContain: "Message not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(http.MethodGet, tt.target)
+			if diff := cmp.Diff(tt.wantCode, rr.Code); diff != "" {
+				t.Errorf("ServeHTTP(): HTTP code diff=\n %v", diff)
+			}
+			if diff := cmp.Diff(tt.wantType, rr.Header().Get("Content-Type")); diff != "" {
+				t.Errorf("ServeHTTP(): content type diff=\n %v", diff)
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantContain) {
+				t.Errorf("ServeHTTP(): body %q does not contain %q", rr.Body, tt.wantContain)
+			}
+		})
+	}
+
+	rr := serve(http.MethodDelete, "/inbox")
+	if diff := cmp.Diff(http.StatusNoContent, rr.Code); diff != "" {
+		t.Errorf("ServeHTTP(): HTTP code diff=\n %v", diff)
+	}
+	var messages []Message
+	if err := json.NewDecoder(serve(http.MethodGet, "/inbox").Body).Decode(&messages); err != nil {
+		t.Fatalf("json.NewDecoder().Decode(): %v", err)
+	}
+	if diff := cmp.Diff(0, len(messages)); diff != "" {
+		t.Errorf("ServeHTTP(): messages diff=\n %v", diff)
+	}
+}
+
+func TestRawHandler(t *testing.T) {
+	inbox, err := New("")
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	email := emailer.Email{
+		From:        "a@a.com",
+		To:          []string{"b@b.com", "c@c.com"},
+		BCC:         []string{"bcc@bcc.com"},
+		Subject:     "héllo",
+		HTMLContent: "<p>html</p>",
+		TextContent: "text",
+	}
+	id, err := inbox.SendMessage(context.Background(), email)
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	mux := http.NewServeMux()
+	inbox.RegisterHandlers(mux)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/inbox/"+id+"/raw", nil))
+	if diff := cmp.Diff(fmt.Sprintf("attachment; filename=%q", id+".eml"), rr.Header().Get("Content-Disposition")); diff != "" {
+		t.Errorf("ServeHTTP(): content disposition diff=\n %v", diff)
+	}
+
+	msg, err := mail.ReadMessage(rr.Body)
+	if err != nil {
+		t.Fatalf("mail.ReadMessage(): %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("DecodeHeader(): %v", err)
+	}
+	// the catcher keeps Bcc, so the downloaded message shows every recipient of the caught email
+	headers := map[string]string{
+		"From":       msg.Header.Get("From"),
+		"To":         msg.Header.Get("To"),
+		"Bcc":        msg.Header.Get("Bcc"),
+		"Subject":    subject,
+		"Message-Id": msg.Header.Get("Message-Id"),
+	}
+	want := map[string]string{
+		"From":       "a@a.com",
+		"To":         "b@b.com, c@c.com",
+		"Bcc":        "bcc@bcc.com",
+		"Subject":    "héllo",
+		"Message-Id": "<" + id + "@catcher.local>",
+	}
+	if diff := cmp.Diff(want, headers); diff != "" {
+		t.Errorf("ServeHTTP(): headers diff=\n %v", diff)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("mime.ParseMediaType(): %v", err)
+	}
+	if diff := cmp.Diff("multipart/alternative", mediaType); diff != "" {
+		t.Errorf("ServeHTTP(): media type diff=\n %v", diff)
+	}
+	var parts []string
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("mr.NextPart(): %v", err)
+		}
+		body, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatalf("io.ReadAll(): %v", err)
+		}
+		partType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		parts = append(parts, partType+": "+strings.TrimSpace(string(body)))
+	}
+	if diff := cmp.Diff([]string{"text/plain: text", "text/html: <p>html</p>"}, parts); diff != "" {
+		t.Errorf("ServeHTTP(): parts diff=\n %v", diff)
+	}
+}
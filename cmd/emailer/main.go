@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -16,19 +18,41 @@ import (
 	"github.com/hashicorp/go-retryablehttp"
 
 	"github.com/mrwormhole/emailer"
-	"github.com/mrwormhole/emailer/brevo"
-	"github.com/mrwormhole/emailer/resend"
-	"github.com/mrwormhole/emailer/sendgrid"
+	_ "github.com/mrwormhole/emailer/acs"
+	_ "github.com/mrwormhole/emailer/brevo"
+	"github.com/mrwormhole/emailer/catcher"
+	"github.com/mrwormhole/emailer/file"
+	"github.com/mrwormhole/emailer/generic"
+	_ "github.com/mrwormhole/emailer/jmap"
+	_ "github.com/mrwormhole/emailer/mailersend"
+	_ "github.com/mrwormhole/emailer/mailjet"
+	_ "github.com/mrwormhole/emailer/mailtrap"
+	_ "github.com/mrwormhole/emailer/mandrill"
+	_ "github.com/mrwormhole/emailer/resend"
+	_ "github.com/mrwormhole/emailer/sendgrid"
+	"github.com/mrwormhole/emailer/sendmail"
+	_ "github.com/mrwormhole/emailer/ses"
+	"github.com/mrwormhole/emailer/smtpd"
+	_ "github.com/mrwormhole/emailer/sparkpost"
+	"github.com/mrwormhole/emailer/stdout"
+	"github.com/mrwormhole/emailer/templates"
 )
 
 var debugEnabled = flag.Bool("debug", false, "in debug environment")
 
 const (
-	defaultPort = "5555"
-	// Providers Listed below
+	defaultPort   = "5555"
+	defaultLocale = "en"
+	// Providers Listed below need more than config, the others are opened by name from the registry
 	providerBrevo    = "brevo"
-	providerResend   = "resend"
-	providerSendgrid = "sendgrid"
+	providerGeneric  = "generic"
+	providerCatcher  = "catcher"
+	providerFile     = "file"
+	providerStdout   = "stdout"
+	providerLog      = "log"
+	providerSendmail = "sendmail"
+	// defaultSendmailPath is where the local MTA usually installs its sendmail binary
+	defaultSendmailPath = "/usr/sbin/sendmail"
 )
 
 func main() {
@@ -47,11 +71,6 @@ func main() {
 	}
 	slog.SetDefault(slog.New(logHandler))
 
-	key, ok := os.LookupEnv("API_KEY")
-	if !ok {
-		slog.Error("API_KEY not found in env")
-		os.Exit(1)
-	}
 	port, ok := os.LookupEnv("PORT")
 	if !ok {
 		port = defaultPort
@@ -65,6 +84,13 @@ func main() {
 	if !ok {
 		provider = providerBrevo
 	}
+	key, ok := os.LookupEnv("API_KEY")
+	if !ok && !slices.ContainsFunc([]string{providerCatcher, providerFile, providerStdout, providerLog, providerSendmail, providerGeneric}, func(p string) bool {
+		return strings.EqualFold(provider, p)
+	}) {
+		slog.Error("API_KEY not found in env")
+		os.Exit(1)
+	}
 
 	c := retryablehttp.NewClient()
 	c.RetryMax = 3
@@ -72,34 +98,112 @@ func main() {
 	httpClient.Timeout = 10 * time.Second
 
 	ctx := context.Background()
-	var sender emailer.Sender
-	cfg := emailer.Config{Key: key, Client: *httpClient}
+	var (
+		sender emailer.Sender
+		inbox  *catcher.Inbox
+	)
+	cfg := emailer.Config{
+		Key:          key,
+		Secret:       os.Getenv("API_SECRET"),
+		SessionToken: os.Getenv("API_SESSION_TOKEN"),
+		Region:       os.Getenv("API_REGION"),
+		BaseURL:      os.Getenv("API_BASE_URL"),
+		InboxID:      os.Getenv("MAILTRAP_INBOX_ID"),
+		Client:       *httpClient,
+	}
+	if interval, ok := os.LookupEnv("ACS_POLL_INTERVAL"); ok {
+		cfg.PollInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, fmt.Sprintf("time.ParseDuration(%q)", interval), slog.String("err", err.Error()))
+			os.Exit(1)
+		}
+	}
 	switch {
-	case strings.EqualFold(provider, providerBrevo):
-		slog.LogAttrs(ctx, slog.LevelDebug, "brevo.New()")
-		sender, err = brevo.New(cfg)
+	case strings.EqualFold(provider, providerGeneric):
+		path := os.Getenv("GENERIC_CONFIG")
+		slog.LogAttrs(ctx, slog.LevelDebug, "generic.Load()", slog.String("path", path))
+		d, err := generic.Load(path)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "generic.Load()", slog.String("err", err.Error()))
+			os.Exit(1)
+		}
+		slog.LogAttrs(ctx, slog.LevelDebug, "generic.New()")
+		sender, err = generic.New(cfg, d)
 		if err != nil {
-			slog.LogAttrs(ctx, slog.LevelError, "brevo.New()", slog.String("err", err.Error()))
+			slog.LogAttrs(ctx, slog.LevelError, "generic.New()", slog.String("err", err.Error()))
+			os.Exit(1)
 		}
-	case strings.EqualFold(provider, providerResend):
-		slog.LogAttrs(ctx, slog.LevelDebug, "resend.New()")
-		sender, err = resend.New(cfg)
+	case strings.EqualFold(provider, providerCatcher):
+		slog.LogAttrs(ctx, slog.LevelDebug, "catcher.New()")
+		inbox, err = catcher.New(os.Getenv("CATCHER_DIR"))
 		if err != nil {
-			slog.LogAttrs(ctx, slog.LevelError, "resend.New()", slog.String("err", err.Error()))
+			slog.LogAttrs(ctx, slog.LevelError, "catcher.New()", slog.String("err", err.Error()))
+			os.Exit(1)
+		}
+		sender = inbox
+	case strings.EqualFold(provider, providerFile):
+		slog.LogAttrs(ctx, slog.LevelDebug, "file.New()")
+		format := file.EML
+		if strings.EqualFold(os.Getenv("FILE_FORMAT"), "maildir") {
+			format = file.Maildir
+		}
+		sender, err = file.New(os.Getenv("FILE_DIR"), format)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "file.New()", slog.String("err", err.Error()))
+			os.Exit(1)
+		}
+	case strings.EqualFold(provider, providerSendmail):
+		slog.LogAttrs(ctx, slog.LevelDebug, "sendmail.New()")
+		path, ok := os.LookupEnv("SENDMAIL_PATH")
+		if !ok {
+			path = defaultSendmailPath
 		}
-	case strings.EqualFold(provider, providerSendgrid):
-		slog.LogAttrs(ctx, slog.LevelDebug, "sendgrid.New()")
-		sender, err = sendgrid.New(cfg)
+		sender, err = sendmail.New(path)
 		if err != nil {
-			slog.LogAttrs(ctx, slog.LevelError, "sendgrid.New()", slog.String("err", err.Error()))
+			slog.LogAttrs(ctx, slog.LevelError, "sendmail.New()", slog.String("err", err.Error()))
+			os.Exit(1)
 		}
+	case strings.EqualFold(provider, providerStdout):
+		slog.LogAttrs(ctx, slog.LevelDebug, "stdout.New()")
+		sender = stdout.New(os.Stdout)
+	case strings.EqualFold(provider, providerLog):
+		slog.LogAttrs(ctx, slog.LevelDebug, "stdout.NewLogger()")
+		sender = stdout.NewLogger(slog.Default())
 	default:
-		slog.LogAttrs(ctx, slog.LevelError, "unknown provider", slog.String("provider", provider))
-		os.Exit(1)
+		// providers that only need config register themselves when their packages are imported,
+		// including mailtrap sandbox, acs polling and other JMAP servers that are set by config
+		slog.LogAttrs(ctx, slog.LevelDebug, "emailer.Open()", slog.String("provider", provider))
+		sender, err = emailer.Open(provider, cfg)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "emailer.Open()", slog.String("err", err.Error()),
+				slog.String("providers", strings.Join(emailer.Providers(), ",")))
+			os.Exit(1)
+		}
 	}
 
+	scheduler := emailer.NewLocalScheduler(sender, httpClient.Timeout)
+	sender = scheduler
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("POST /email", emailer.HandlerFunc(sender))
+	mux.HandleFunc("POST /email/raw", emailer.RawHandlerFunc(sender))
+	mux.HandleFunc("DELETE /email/{id}", emailer.CancelHandlerFunc(scheduler))
+	mux.HandleFunc("PATCH /email/{id}", emailer.RescheduleHandlerFunc(scheduler))
+	if inbox != nil {
+		inbox.RegisterHandlers(mux)
+	}
+	if dir, ok := os.LookupEnv("TEMPLATES_DIR"); ok {
+		locale, ok := os.LookupEnv("DEFAULT_LOCALE")
+		if !ok {
+			locale = defaultLocale
+		}
+		set, err := templates.Load(os.DirFS(dir), locale)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "templates.Load()", slog.String("dir", dir), slog.String("err", err.Error()))
+			os.Exit(1)
+		}
+		mux.HandleFunc("POST /email/template", templates.HandlerFunc(set, sender))
+	}
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", portNum),
 		Handler:      mux,
@@ -114,6 +218,35 @@ func main() {
 		}
 	}()
 
+	var smtpSrv *smtpd.Server
+	if addr, ok := os.LookupEnv("SMTP_ADDR"); ok {
+		smtpSrv = &smtpd.Server{
+			Addr:     addr,
+			Sender:   sender,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+		if smtpSrv.Username == "" || smtpSrv.Password == "" {
+			slog.Error("SMTP_USERNAME or SMTP_PASSWORD not found in env")
+			os.Exit(1)
+		}
+		if certFile, ok := os.LookupEnv("SMTP_TLS_CERT"); ok {
+			cert, err := tls.LoadX509KeyPair(certFile, os.Getenv("SMTP_TLS_KEY"))
+			if err != nil {
+				slog.LogAttrs(ctx, slog.LevelError, "tls.LoadX509KeyPair()", slog.String("err", err.Error()))
+				os.Exit(1)
+			}
+			smtpSrv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		}
+
+		go func() {
+			slog.Debug(fmt.Sprintf("smtp server started at %s", addr))
+			if err := smtpSrv.ListenAndServe(); err != nil && !errors.Is(err, smtpd.ErrServerClosed) {
+				slog.LogAttrs(context.Background(), slog.LevelError, "smtpSrv.ListenAndServe()", slog.String("err", err.Error()))
+			}
+		}()
+	}
+
 	wait := make(chan os.Signal, 1)
 	signal.Notify(wait, os.Interrupt)
 	<-wait
@@ -123,4 +256,12 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		slog.LogAttrs(context.Background(), slog.LevelError, "srv.Shutdown()", slog.String("err", err.Error()))
 	}
+	if smtpSrv != nil {
+		if err := smtpSrv.Close(); err != nil {
+			slog.LogAttrs(context.Background(), slog.LevelError, "smtpSrv.Close()", slog.String("err", err.Error()))
+		}
+	}
+	if n := scheduler.Close(); n > 0 {
+		slog.LogAttrs(context.Background(), slog.LevelWarn, "scheduler.Close() dropped scheduled emails", slog.Int("count", n))
+	}
 }
@@ -0,0 +1,350 @@
+// Package cssinline moves `<style>` rules of HTML email bodies into the `style` attributes of matching elements.
+// Email clients like Gmail and Outlook strip `<style>` blocks, inlining keeps the intended look.
+//
+// Rules are applied by [css cascade] order: specificity first, then source order. Existing `style` attributes win over
+// stylesheet rules unless the stylesheet declaration is `!important`. At-rules (e.g. `@media`, `@font-face`) and rules
+// that can not be inlined (e.g. `:hover`, `::before`) are left in place inside the `<style>` block. Declarations are inlined
+// without their `!important` marker, so `!important` rules left behind such as `@media` overrides still apply.
+//
+// Example usage:
+//
+//	 out, err := cssinline.Inline(`<style>p { color: red }</style><p>hi</p>`)
+//		if err != nil {
+//			//check err
+//		}
+//
+//	 sender = cssinline.Middleware(sender)
+//
+// [css cascade]: https://www.w3.org/TR/css-cascade-4/#cascade-sort
+package cssinline
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/mrwormhole/emailer"
+)
+
+// dynamicPseudoRegex matches user action pseudo-classes that only make sense within a stylesheet
+var dynamicPseudoRegex = regexp.MustCompile(`(?i):(hover|active|focus|focus-within|focus-visible|visited|target)\b`)
+
+// Middleware returns a sender that inlines CSS of HTML content before passing the email to next
+func Middleware(next emailer.Sender) emailer.Sender {
+	return emailer.SenderFunc(func(ctx context.Context, e emailer.Email) error {
+		if strings.TrimSpace(e.HTMLContent) != "" {
+			out, err := Inline(e.HTMLContent)
+			if err != nil {
+				return fmt.Errorf("cssinline.Inline(): %v", err)
+			}
+			e.HTMLContent = out
+		}
+		return next.Send(ctx, e)
+	})
+}
+
+// Inline parses given HTML document and inlines its `<style>` rules, then renders the document back.
+// Given fragments are rendered as full documents.
+func Inline(s string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return "", fmt.Errorf("html.Parse(): %v", err)
+	}
+
+	var rules []rule
+	for _, n := range styleNodes(doc) {
+		parsed, rest := parseStylesheet(textOf(n))
+		rules = append(rules, parsed...)
+		if strings.TrimSpace(rest) == "" {
+			n.Parent.RemoveChild(n)
+			continue
+		}
+		for c := n.FirstChild; c != nil; c = n.FirstChild {
+			n.RemoveChild(c)
+		}
+		n.AppendChild(&html.Node{Type: html.TextNode, Data: rest})
+	}
+
+	matches := make(map[*html.Node][]match)
+	for i, r := range rules {
+		for _, sel := range r.selectors {
+			for _, n := range cascadia.QueryAll(doc, sel) {
+				matches[n] = append(matches[n], match{specificity: sel.Specificity(), order: i, declarations: r.declarations})
+			}
+		}
+	}
+	for n, ms := range matches {
+		slices.SortStableFunc(ms, func(a, b match) int {
+			if a.specificity.Less(b.specificity) {
+				return -1
+			}
+			if b.specificity.Less(a.specificity) {
+				return 1
+			}
+			return a.order - b.order
+		})
+		applyStyle(n, ms)
+	}
+
+	var b strings.Builder
+	if err := html.Render(&b, doc); err != nil {
+		return "", fmt.Errorf("html.Render(): %v", err)
+	}
+	return b.String(), nil
+}
+
+// rule is an inlinable style rule
+type rule struct {
+	selectors    cascadia.SelectorGroup
+	declarations []declaration
+}
+
+// declaration is a single CSS property and value pair
+type declaration struct {
+	property  string
+	value     string
+	important bool
+}
+
+// match is a rule that matched an element
+type match struct {
+	specificity  cascadia.Specificity
+	order        int
+	declarations []declaration
+}
+
+// styleNodes returns the style elements that apply to all media
+func styleNodes(doc *html.Node) []*html.Node {
+	var nodes []*html.Node
+	for n := range doc.Descendants() {
+		if n.Type != html.ElementNode || n.DataAtom != atom.Style {
+			continue
+		}
+		if media, ok := attr(n, "media"); ok && !slices.Contains([]string{"", "all", "screen"}, strings.ToLower(strings.TrimSpace(media))) {
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// applyStyle merges sorted matches and existing style attribute of n, then sets the result back
+func applyStyle(n *html.Node, ms []match) {
+	type winner struct {
+		value     string
+		important bool
+	}
+	var order []string
+	winners := make(map[string]winner)
+	set := func(d declaration) {
+		w, ok := winners[d.property]
+		if !ok {
+			order = append(order, d.property)
+		}
+		if ok && w.important && !d.important {
+			return
+		}
+		winners[d.property] = winner{value: d.value, important: d.important}
+	}
+	for _, m := range ms {
+		for _, d := range m.declarations {
+			set(d)
+		}
+	}
+	existing, _ := attr(n, "style")
+	for _, d := range parseDeclarations(existing) {
+		set(d)
+	}
+
+	decls := make([]string, 0, len(order))
+	for _, p := range order {
+		decls = append(decls, p+": "+winners[p].value)
+	}
+	setAttr(n, "style", strings.Join(decls, "; "))
+}
+
+// parseStylesheet splits CSS text into inlinable rules and the remaining CSS text that must stay in the style element
+func parseStylesheet(css string) ([]rule, string) {
+	var (
+		rules []rule
+		rest  strings.Builder
+	)
+	css = stripComments(css)
+	for i := 0; i < len(css); {
+		open := indexOutsideQuotes(css[i:], '{')
+		// statements such as @import or @charset end with a top-level semicolon before any block
+		if semi := indexOutsideQuotes(css[i:], ';'); semi >= 0 && (open < 0 || semi < open) {
+			if statement := strings.TrimSpace(css[i : i+semi+1]); strings.HasPrefix(statement, "@") {
+				rest.WriteString(statement + "\n")
+			}
+			i += semi + 1
+			continue
+		}
+		if open < 0 {
+			break
+		}
+		prelude := strings.TrimSpace(css[i : i+open])
+		end := matchingBrace(css, i+open)
+		if end < 0 {
+			end = len(css) - 1
+		}
+		block := css[i+open+1 : end]
+		raw := strings.TrimSpace(css[i : end+1])
+		i = end + 1
+
+		if strings.HasPrefix(prelude, "@") {
+			rest.WriteString(raw + "\n")
+			continue
+		}
+		group, err := cascadia.ParseGroup(prelude)
+		if err != nil || dynamicPseudoRegex.MatchString(prelude) || slices.ContainsFunc(group, func(s cascadia.Sel) bool { return s.PseudoElement() != "" }) {
+			rest.WriteString(raw + "\n")
+			continue
+		}
+		rules = append(rules, rule{selectors: group, declarations: parseDeclarations(block)})
+	}
+	return rules, rest.String()
+}
+
+// parseDeclarations parses the body of a CSS block or style attribute
+func parseDeclarations(s string) []declaration {
+	var decls []declaration
+	for _, part := range splitOutsideQuotes(s, ';') {
+		property, value, ok := strings.Cut(part, ":")
+		if !ok {
+			continue
+		}
+		property = strings.ToLower(strings.TrimSpace(property))
+		value = strings.TrimSpace(value)
+		if property == "" || value == "" {
+			continue
+		}
+		d := declaration{property: property, value: value}
+		if i := strings.LastIndex(value, "!"); i >= 0 && strings.EqualFold(strings.TrimSpace(value[i+1:]), "important") {
+			d.value = strings.TrimSpace(value[:i])
+			d.important = true
+		}
+		decls = append(decls, d)
+	}
+	return decls
+}
+
+// stripComments removes CSS comments
+func stripComments(s string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "/*")
+		if start < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		b.WriteString(s[:start])
+		end := strings.Index(s[start+2:], "*/")
+		if end < 0 {
+			return b.String()
+		}
+		s = s[start+2+end+2:]
+	}
+}
+
+// indexOutsideQuotes returns the index of the first c that is not within quotes or parentheses, -1 if none
+func indexOutsideQuotes(s string, c byte) int {
+	var quote byte
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == '(':
+			depth++
+		case s[i] == ')' && depth > 0:
+			depth--
+		case s[i] == c && depth == 0:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitOutsideQuotes splits s by sep that is not within quotes or parentheses
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	for {
+		i := indexOutsideQuotes(s, sep)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+// matchingBrace returns the index of the brace that closes the one at open, -1 if it is never closed
+func matchingBrace(s string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == '{':
+			depth++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// textOf returns the concatenated text of the children of n
+func textOf(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+	}
+	return b.String()
+}
+
+// attr returns the value of attribute key of n
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && strings.EqualFold(a.Key, key) {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// setAttr sets the value of attribute key of n
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Namespace == "" && strings.EqualFold(a.Key, key) {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
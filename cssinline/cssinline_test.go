@@ -0,0 +1,116 @@
+package cssinline
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+)
+
+func TestInline(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "type selector",
+			html: `<html><head><style>p { color: red; }</style></head><body><p>hi</p></body></html>`,
+			want: `<html><head></head><body><p style="color: red">hi</p></body></html>`,
+		},
+		{
+			name: "specificity wins over source order",
+			html: `<html><head><style>#a { color: blue } .b { color: green } p { color: red; margin: 0 }</style></head><body><p id="a" class="b">hi</p></body></html>`,
+			want: `<html><head></head><body><p id="a" class="b" style="color: blue; margin: 0">hi</p></body></html>`,
+		},
+		{
+			name: "source order breaks specificity ties",
+			html: `<html><head><style>.a { color: blue } .b { color: green }</style></head><body><p class="a b">hi</p></body></html>`,
+			want: `<html><head></head><body><p class="a b" style="color: green">hi</p></body></html>`,
+		},
+		{
+			name: "existing style attribute wins",
+			html: `<html><head><style>p { color: red; padding: 1px }</style></head><body><p style="color: black">hi</p></body></html>`,
+			want: `<html><head></head><body><p style="color: black; padding: 1px">hi</p></body></html>`,
+		},
+		{
+			name: "important wins over style attribute",
+			html: `<html><head><style>p { color: red !important } #a { color: blue }</style></head><body><p id="a" style="color: black">hi</p></body></html>`,
+			want: `<html><head></head><body><p id="a" style="color: red">hi</p></body></html>`,
+		},
+		{
+			name: "important media queries override inlined important",
+			html: `<html><head><style>p { color: red !important } @media (max-width: 600px) { p { color: green !important } }</style></head><body><p>hi</p></body></html>`,
+			want: `<html><head><style>@media (max-width: 600px) { p { color: green !important } }
+</style></head><body><p style="color: red">hi</p></body></html>`,
+		},
+		{
+			name: "block-less at-rules stay",
+			html: `<html><head><style>@import url("a;b.css"); @charset "utf-8"; p { color: red }</style></head><body><p>hi</p></body></html>`,
+			want: `<html><head><style>@import url("a;b.css");
+@charset "utf-8";
+</style></head><body><p style="color: red">hi</p></body></html>`,
+		},
+		{
+			name: "combinators and attributes",
+			html: `<html><head><style>td > a[href^="https"] { text-decoration: none }</style></head><body><table><tbody><tr><td><a href="https://a.com">a</a><a href="mailto:a@a.com">b</a></td></tr></tbody></table></body></html>`,
+			want: `<html><head></head><body><table><tbody><tr><td><a href="https://a.com" style="text-decoration: none">a</a><a href="mailto:a@a.com">b</a></td></tr></tbody></table></body></html>`,
+		},
+		{
+			name: "media queries and pseudo rules stay",
+			html: `<html><head><style>/* base */ p { color: red } a:hover { color: blue } p::before { content: "x;y" } @media (max-width: 600px) { p { color: green } }</style></head><body><p>hi</p></body></html>`,
+			want: `<html><head><style>a:hover { color: blue }
+p::before { content: "x;y" }
+@media (max-width: 600px) { p { color: green } }
+</style></head><body><p style="color: red">hi</p></body></html>`,
+		},
+		{
+			name: "print style is skipped",
+			html: `<html><head><style media="print">p { color: red }</style></head><body><p>hi</p></body></html>`,
+			want: `<html><head><style media="print">p { color: red }</style></head><body><p>hi</p></body></html>`,
+		},
+		{
+			name: "no style",
+			html: `<p>hi</p>`,
+			want: `<html><head></head><body><p>hi</p></body></html>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Inline(tt.html)
+			if err != nil {
+				t.Fatalf("Inline(): %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Inline(): diff=\n %v", diff)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var got emailer.Email
+	sender := Middleware(emailer.SenderFunc(func(_ context.Context, e emailer.Email) error {
+		got = e
+		return nil
+	}))
+
+	email := emailer.Email{
+		From:        "a@a.com",
+		To:          []string{"b@b.com"},
+		Subject:     "sub",
+		HTMLContent: `<style>p { color: red }</style><p>hi</p>`,
+		TextContent: "hi",
+	}
+	if err := sender.Send(context.Background(), email); err != nil {
+		t.Fatalf("Send(): %v", err)
+	}
+
+	want := email
+	want.HTMLContent = `<html><head></head><body><p style="color: red">hi</p></body></html>`
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Send(): diff=\n %v", diff)
+	}
+}
@@ -2,32 +2,85 @@
 package emailer
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"log/slog"
+	"mime"
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 )
 
 var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 
+// maxRawSize is the size limit of raw messages, it is above what providers accept with attachments
+const maxRawSize = 40 << 20
+
 // Config configures the email clients
 type Config struct {
 	Key string
+	// Secret is the second half of credentials that come as a pair such as AWS secret access key, blank for single key providers
+	Secret string
+	// SessionToken is a temporary token that goes with Key and Secret such as AWS session token, blank means none
+	SessionToken string
+	// Region selects the regional API of providers that have many such as AWS regions, blank means the provider default
+	Region string
+	// BaseURL overrides the API base URL of the provider such as regional hosts or local stand-ins, blank means default
+	BaseURL string
+	// MarkdownLayout wraps HTML rendered from markdown content, nil means DefaultMarkdownLayout
+	MarkdownLayout *template.Template
+	// InboxID delivers emails into the testing inbox of providers that have one such as mailtrap sandbox, blank means recipients
+	InboxID string
+	// PollInterval makes sends of providers that accept emails asynchronously such as ACS wait for the outcome, 0 means no wait
+	PollInterval time.Duration
 	http.Client
 }
 
 // Email is generic email structure for all providers
 type Email struct {
-	From        string   `json:"from"`
-	To          []string `json:"to"`
-	BCC         []string `json:"bcc"`
-	CC          []string `json:"cc"`
-	Subject     string   `json:"subject"`
-	HTMLContent string   `json:"htmlContent"`
-	TextContent string   `json:"textContent"`
+	From            string       `json:"from"`
+	To              []string     `json:"to"`
+	BCC             []string     `json:"bcc"`
+	CC              []string     `json:"cc"`
+	Subject         string       `json:"subject"`
+	HTMLContent     string       `json:"htmlContent"`
+	TextContent     string       `json:"textContent"`
+	MarkdownContent string       `json:"markdownContent,omitempty"`
+	Attachments     []Attachment `json:"attachments,omitempty"`
+	SendAt          time.Time    `json:"sendAt,omitzero"`
+}
+
+// Attachment is a file attached to an email, it is shown inline when it has a content ID
+type Attachment struct {
+	Filename string `json:"filename"`
+	// ContentType is detected from the filename extension then the data when it is blank
+	ContentType string `json:"contentType,omitempty"`
+	// ContentID makes the attachment an inline part that HTML content refers as cid:<ContentID>
+	ContentID string `json:"contentId,omitempty"`
+	// Data is the file content, it is base64 in JSON
+	Data []byte `json:"content"`
+}
+
+// LogValue logs e without its contents so error logs stay small, attachments are logged by their names and sizes
+func (e Email) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("from", e.From),
+		slog.Int("recipients", len(e.To)+len(e.CC)+len(e.BCC)),
+		slog.String("subject", e.Subject),
+	}
+	if len(e.Attachments) > 0 {
+		attachments := make([]string, 0, len(e.Attachments))
+		for _, a := range e.Attachments {
+			attachments = append(attachments, fmt.Sprintf("%s (%d bytes)", a.Filename, len(a.Data)))
+		}
+		attrs = append(attrs, slog.Any("attachments", attachments))
+	}
+	return slog.GroupValue(attrs...)
 }
 
 // ValidationMsg returns empty if all validations passed, else it will return failed validation message
@@ -49,8 +102,20 @@ func (e Email) ValidationMsg() string {
 	if strings.TrimSpace(e.Subject) == "" {
 		return "subject field must not be blank"
 	}
-	if strings.TrimSpace(e.HTMLContent) == "" && strings.TrimSpace(e.TextContent) == "" {
-		return "either the htmlContent or textContent field must be filled"
+	hasMarkdown := strings.TrimSpace(e.MarkdownContent) != ""
+	if strings.TrimSpace(e.HTMLContent) == "" && strings.TrimSpace(e.TextContent) == "" && !hasMarkdown {
+		return "either the htmlContent, textContent or markdownContent field must be filled"
+	}
+	if hasMarkdown && (e.HTMLContent != "" || e.TextContent != "") {
+		return "markdownContent field must not be combined with htmlContent or textContent"
+	}
+	if !e.SendAt.IsZero() && e.SendAt.Before(time.Now()) {
+		return "sendAt field must be in the future"
+	}
+	for _, a := range e.Attachments {
+		if strings.TrimSpace(a.Filename) == "" {
+			return "attachment filename must not be blank"
+		}
 	}
 	for _, s := range e.BCC {
 		if !emailRegex.MatchString(s) {
@@ -70,6 +135,59 @@ type Sender interface {
 	Send(ctx context.Context, e Email) error
 }
 
+// MessageSender is a behaviour for email senders that report the message ID given by the provider
+type MessageSender interface {
+	Sender
+	SendMessage(ctx context.Context, e Email) (string, error)
+}
+
+// StatusError is returned by senders when the provider API responds unsuccessfully
+type StatusError struct {
+	StatusCode int
+	// Detail is the decoded error body of the provider, or the raw body when it is not decodable
+	Detail any
+}
+
+// Error returns the status code and the detail of the response
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unsuccessful response with status code(%d): %v", e.StatusCode, e.Detail)
+}
+
+// Temporary reports whether sending again later may succeed, which is the case for rate limits and server errors
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// Do sends req of a provider API with client, the request is not printed on errors since it carries the credentials
+func Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req) //nolint:gosec //target is built from the configuration of the sender
+	if err != nil {
+		return nil, fmt.Errorf("client.Do(%s %s): %w", req.Method, req.URL.Redacted(), err)
+	}
+	return resp, nil
+}
+
+// NewStatusError returns the StatusError of an unsuccessful response body, decode returns the provider error of the body.
+// Bodies that decode does not recognise, such as proxy pages, are reported as they are
+func NewStatusError(code int, body []byte, decode func(body []byte) (any, bool)) *StatusError {
+	if detail, ok := decode(body); ok {
+		return &StatusError{StatusCode: code, Detail: detail}
+	}
+	return &StatusError{StatusCode: code, Detail: string(bytes.TrimSpace(body))}
+}
+
+// ErrRejected is wrapped by errors of emails that the provider accepted but refused to deliver for good,
+// sending them again fails the same way or duplicates the deliveries that succeeded
+var ErrRejected = errors.New("rejected by provider")
+
+// SenderFunc is an adapter to allow the use of ordinary functions as email senders
+type SenderFunc func(ctx context.Context, e Email) error
+
+// Send calls f(ctx, e)
+func (f SenderFunc) Send(ctx context.Context, e Email) error {
+	return f(ctx, e)
+}
+
 // HandlerFunc is opinionated/reusable HTTP handler for brevo provider
 func HandlerFunc(sender Sender) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -78,19 +196,63 @@ func HandlerFunc(sender Sender) http.HandlerFunc {
 			http.Error(w, fmt.Sprintf("Failed to decode request: %v", err), http.StatusBadRequest)
 			return
 		}
+		send(w, r, sender, e)
+	}
+}
 
-		if m := e.ValidationMsg(); m != "" {
-			http.Error(w, fmt.Sprintf("Failed to validate: %v", m), http.StatusBadRequest)
+// RawHandlerFunc is HTTP handler that sends raw RFC 5322 messages of message/rfc822 request bodies
+func RawHandlerFunc(sender Sender) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "message/rfc822" {
+			http.Error(w, "Content-Type must be message/rfc822", http.StatusUnsupportedMediaType)
 			return
 		}
-
-		if err := sender.Send(r.Context(), e); err != nil {
-			slog.LogAttrs(r.Context(), slog.LevelError, fmt.Sprintf("%T.Send(%v)", sender, e), slog.String("err", err.Error()))
-			http.Error(w, "Failed to send email", http.StatusInternalServerError)
+		e, err := ParseMIME(http.MaxBytesReader(w, r.Body, maxRawSize))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to parse message: %v", err), http.StatusBadRequest)
 			return
 		}
+		send(w, r, sender, e)
+	}
+}
+
+// send validates e then sends it via sender, it writes the outcome as response
+func send(w http.ResponseWriter, r *http.Request, sender Sender, e Email) {
+	if m := e.ValidationMsg(); m != "" {
+		http.Error(w, fmt.Sprintf("Failed to validate: %v", m), http.StatusBadRequest)
+		return
+	}
 
-		w.WriteHeader(http.StatusOK)
-		_, _ = fmt.Fprint(w, "Email successfully sent")
+	id, err := SendMessage(r.Context(), sender, e)
+	if errors.Is(err, ErrIncompatible) {
+		http.Error(w, fmt.Sprintf("Failed to send email: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.LogAttrs(r.Context(), slog.LevelError, fmt.Sprintf("%T.Send()", sender), slog.Any("email", e), slog.String("err", err.Error()))
+		http.Error(w, "Failed to send email", http.StatusInternalServerError)
+		return
+	}
+	if id != "" {
+		w.Header().Set("X-Message-Id", id)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if !e.SendAt.IsZero() {
+		_, _ = fmt.Fprint(w, "Email successfully scheduled")
+		return
+	}
+	_, _ = fmt.Fprint(w, "Email successfully sent")
+}
+
+// SendMessage sends e via sender and returns the message ID when sender is a [MessageSender], empty otherwise.
+// Emails that a [Capable] sender can not honour are rejected without sending, see CheckCapabilities
+func SendMessage(ctx context.Context, sender Sender, e Email) (string, error) {
+	if err := CheckCapabilities(sender, e); err != nil {
+		return "", err
+	}
+	if ms, ok := sender.(MessageSender); ok {
+		return ms.SendMessage(ctx, e)
 	}
+	return "", sender.Send(ctx, e)
 }
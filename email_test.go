@@ -1,7 +1,15 @@
 package emailer
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -56,7 +64,50 @@ func TestValidationMsg(t *testing.T) {
 				To:      []string{"b@b.com"},
 				Subject: "subj",
 			},
-			want: "either the htmlContent or textContent field must be filled",
+			want: "either the htmlContent, textContent or markdownContent field must be filled",
+		},
+		{
+			name: "markdown combined with html",
+			email: Email{
+				From:            "a@a.com",
+				To:              []string{"b@b.com"},
+				Subject:         "subj",
+				HTMLContent:     "html",
+				MarkdownContent: "*md*",
+			},
+			want: "markdownContent field must not be combined with htmlContent or textContent",
+		},
+		{
+			name: "markdown only",
+			email: Email{
+				From:            "a@a.com",
+				To:              []string{"b@b.com"},
+				Subject:         "subj",
+				MarkdownContent: "*md*",
+			},
+			want: "",
+		},
+		{
+			name: "send at in the past",
+			email: Email{
+				From:        "a@a.com",
+				To:          []string{"b@b.com"},
+				Subject:     "subj",
+				TextContent: "text",
+				SendAt:      time.Now().Add(-time.Minute),
+			},
+			want: "sendAt field must be in the future",
+		},
+		{
+			name: "attachment without filename",
+			email: Email{
+				From:        "a@a.com",
+				To:          []string{"b@b.com"},
+				Subject:     "subj",
+				TextContent: "text",
+				Attachments: []Attachment{{Data: []byte("data")}},
+			},
+			want: "attachment filename must not be blank",
 		},
 		{
 			name: "invalid BCC",
@@ -90,3 +141,178 @@ func TestValidationMsg(t *testing.T) {
 		})
 	}
 }
+
+func TestHandlerFunc(t *testing.T) {
+	slog.SetLogLoggerLevel(slog.Level(100))
+	sent := SenderFunc(func(context.Context, Email) error { return nil })
+	failed := SenderFunc(func(context.Context, Email) error { return errors.New("boom") })
+	tests := []struct {
+		name     string
+		sender   Sender
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "broken request",
+			body:     "hello",
+			wantCode: http.StatusBadRequest,
+			wantBody: "Failed to decode request: invalid character 'h' looking for beginning of value\n",
+		},
+		{
+			name:     "failed validation",
+			body:     `{"from": "a@a.com"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: "Failed to validate: to field must not be blank\n",
+		},
+		{
+			name:     "failed send",
+			sender:   failed,
+			body:     `{"from": "a@a.com", "to": ["b@b.com"], "subject": "sub", "htmlContent": "html"}`,
+			wantCode: http.StatusInternalServerError,
+			wantBody: "Failed to send email\n",
+		},
+		{
+			name:     "incompatible email",
+			sender:   &capableSender{caps: Capabilities{MaxRecipients: 1}},
+			body:     `{"from": "a@a.com", "to": ["b@b.com", "c@c.com"], "subject": "sub", "htmlContent": "html"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: "Failed to send email: email is incompatible with the provider: 2 recipients exceed the limit of 1\n",
+		},
+		{
+			name:     "success",
+			sender:   sent,
+			body:     `{"from": "a@a.com", "to": ["b@b.com"], "cc": ["cc@cc.com"], "bcc": ["bcc@bcc.com"], "subject": "sub", "htmlContent": "html"}`,
+			wantCode: http.StatusOK,
+			wantBody: "Email successfully sent",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/email", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			HandlerFunc(tt.sender).ServeHTTP(rr, req)
+
+			if diff := cmp.Diff(tt.wantCode, rr.Code); diff != "" {
+				t.Errorf("HandlerFunc(): HTTP code diff=\n %v", diff)
+			}
+			if diff := cmp.Diff(tt.wantBody, rr.Body.String()); diff != "" {
+				t.Errorf("HandlerFunc(): HTTP body diff=\n %v", diff)
+			}
+		})
+	}
+}
+
+func TestRawHandlerFunc(t *testing.T) {
+	slog.SetLogLoggerLevel(slog.Level(100))
+	var got Email
+	sender := SenderFunc(func(_ context.Context, e Email) error {
+		got = e
+		return nil
+	})
+	raw := "From: a@a.com\r\nTo: b@b.com\r\nSubject: sub\r\n\r\ntext"
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantCode    int
+		wantBody    string
+	}{
+		{
+			name:        "wrong content type",
+			contentType: "application/json",
+			body:        raw,
+			wantCode:    http.StatusUnsupportedMediaType,
+			wantBody:    "Content-Type must be message/rfc822\n",
+		},
+		{
+			name:        "broken message",
+			contentType: "message/rfc822",
+			body:        "hello",
+			wantCode:    http.StatusBadRequest,
+			wantBody:    "Failed to parse message: mail.ReadMessage(): malformed header line: \"hello\"\n",
+		},
+		{
+			name:        "failed validation",
+			contentType: "message/rfc822",
+			body:        "From: a@a.com\r\nSubject: sub\r\n\r\ntext",
+			wantCode:    http.StatusBadRequest,
+			wantBody:    "Failed to validate: to field must not be blank\n",
+		},
+		{
+			name:        "success",
+			contentType: "message/rfc822",
+			body:        raw,
+			wantCode:    http.StatusOK,
+			wantBody:    "Email successfully sent",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/email/raw", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			RawHandlerFunc(sender).ServeHTTP(rr, req)
+
+			if diff := cmp.Diff(tt.wantCode, rr.Code); diff != "" {
+				t.Errorf("RawHandlerFunc(): HTTP code diff=\n %v", diff)
+			}
+			if diff := cmp.Diff(tt.wantBody, rr.Body.String()); diff != "" {
+				t.Errorf("RawHandlerFunc(): HTTP body diff=\n %v", diff)
+			}
+		})
+	}
+	want := Email{From: "a@a.com", To: []string{"b@b.com"}, Subject: "sub", TextContent: "text"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("RawHandlerFunc(): sent email diff=\n %v", diff)
+	}
+}
+
+func TestEmail_LogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+		if a.Key == slog.TimeKey {
+			return slog.Attr{}
+		}
+		return a
+	}}))
+	e := Email{
+		From:        "a@a.com",
+		To:          []string{"b@b.com"},
+		CC:          []string{"c@c.com"},
+		Subject:     "sub",
+		HTMLContent: "<p>secret</p>",
+		Attachments: []Attachment{{Filename: "report.pdf", Data: bytes.Repeat([]byte("x"), 1024)}},
+	}
+	logger.Error("send", slog.Any("email", e))
+
+	want := `level=ERROR msg=send email.from=a@a.com email.recipients=2 email.subject=sub email.attachments="[report.pdf (1024 bytes)]"` + "\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("LogValue(): diff=\n %v", diff)
+	}
+}
+
+func TestNewStatusError(t *testing.T) {
+	decode := func(body []byte) (any, bool) {
+		s, ok := strings.CutPrefix(string(body), "error: ")
+		return s, ok
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want *StatusError
+	}{
+		{name: "provider error", body: "error: from is blank", want: &StatusError{StatusCode: http.StatusBadRequest, Detail: "from is blank"}},
+		{name: "proxy page", body: "\n<html>bad gateway</html>\n", want: &StatusError{StatusCode: http.StatusBadRequest, Detail: "<html>bad gateway</html>"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewStatusError(http.StatusBadRequest, []byte(tt.body), decode)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("NewStatusError(): diff=\n %v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package emailtest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const (
+	// acsMaxRecipients is the recipient limit of a single ACS email across all address fields
+	acsMaxRecipients = 50
+	// ACSFailed is the recipient domain whose emails are accepted by the ACS fake but whose send operations fail
+	ACSFailed = "failed.test"
+)
+
+// acsAddress is a recipient of ACS email
+type acsAddress struct {
+	Address     string `json:"address"`
+	DisplayName string `json:"displayName"`
+}
+
+// acsPayload is the request body of ACS send email
+type acsPayload struct {
+	SenderAddress string `json:"senderAddress"`
+	Recipients    struct {
+		To  []acsAddress `json:"to"`
+		CC  []acsAddress `json:"cc"`
+		BCC []acsAddress `json:"bcc"`
+	} `json:"recipients"`
+	Content struct {
+		Subject   string `json:"subject"`
+		PlainText string `json:"plainText"`
+		HTML      string `json:"html"`
+	} `json:"content"`
+	Attachments []struct {
+		Name            string `json:"name"`
+		ContentType     string `json:"contentType"`
+		ContentID       string `json:"contentId"`
+		ContentInBase64 string `json:"contentInBase64"`
+	} `json:"attachments"`
+}
+
+// NewACSServer starts a fake of ACS email API that verifies HMAC-SHA256 signatures made with FakeKey as the access key.
+// Accepted emails are running operations that succeed when they are polled, unless a recipient is at ACSFailed domain
+func NewACSServer(t testing.TB) *FakeServer {
+	t.Helper()
+	return newFakeServer(t, func(s *FakeServer) http.Handler {
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /emails:send", func(w http.ResponseWriter, r *http.Request) {
+			if !acsAuthorized(w, r) {
+				return
+			}
+			var p acsPayload
+			if err := decodeStrict(r, &p); err != nil {
+				acsError(w, http.StatusBadRequest, "BadRequest", err.Error())
+				return
+			}
+			if msg := p.validate(); msg != "" {
+				acsError(w, http.StatusBadRequest, "BadRequest", msg)
+				return
+			}
+
+			id := uuid()
+			// operations that succeed are remembered, the others fail when they are polled
+			if !p.failing() {
+				s.schedule(id)
+			}
+			w.Header().Set("Operation-Location", s.URL+"/emails/operations/"+id+"?api-version="+r.URL.Query().Get("api-version"))
+			w.Header().Set("Retry-After", "0")
+			writeJSON(w, http.StatusAccepted, map[string]any{"id": id, "status": "Running", "error": nil})
+		})
+		mux.HandleFunc("GET /emails/operations/{id}", func(w http.ResponseWriter, r *http.Request) {
+			if !acsAuthorized(w, r) {
+				return
+			}
+			id := r.PathValue("id")
+			if s.isScheduled(id) {
+				writeJSON(w, http.StatusOK, map[string]any{"id": id, "status": "Succeeded", "error": nil})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{
+				"id":     id,
+				"status": "Failed",
+				"error":  map[string]string{"code": "EmailDroppedAllRecipientsSuppressed", "message": "Message was dropped"},
+			})
+		})
+		return mux
+	})
+}
+
+// validate returns the first problem of the payload as ACS reports it, empty if it is valid
+func (p acsPayload) validate() string {
+	rcpts := p.Recipients
+	switch {
+	case strings.TrimSpace(p.SenderAddress) == "":
+		return "The sender address is required"
+	case len(rcpts.To)+len(rcpts.CC)+len(rcpts.BCC) == 0:
+		return "At least one recipient is required"
+	case len(rcpts.To)+len(rcpts.CC)+len(rcpts.BCC) > acsMaxRecipients:
+		return "The number of recipients exceeds the limit"
+	case strings.TrimSpace(p.Content.Subject) == "":
+		return "The subject is required"
+	case p.Content.PlainText == "" && p.Content.HTML == "":
+		return "Either plain text or HTML content is required"
+	}
+	for _, a := range slices.Concat(rcpts.To, rcpts.CC, rcpts.BCC) {
+		if strings.TrimSpace(a.Address) == "" {
+			return "The recipient address is required"
+		}
+	}
+	for _, a := range p.Attachments {
+		if a.Name == "" || a.ContentType == "" || !isBase64(a.ContentInBase64) {
+			return "Attachment name, content type and base64 content are required"
+		}
+	}
+	return ""
+}
+
+// failing reports whether a recipient is at ACSFailed domain
+func (p acsPayload) failing() bool {
+	return slices.ContainsFunc(slices.Concat(p.Recipients.To, p.Recipients.CC, p.Recipients.BCC), func(a acsAddress) bool {
+		return strings.HasSuffix(a.Address, "@"+ACSFailed)
+	})
+}
+
+// acsAuthorized verifies the HMAC-SHA256 signature, it writes the ACS error response when it is wrong
+func acsAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	req := Request{Method: r.Method, Host: r.Host, Path: r.URL.Path, RawQuery: r.URL.RawQuery, Header: r.Header, Body: body}
+	if !acsSigned(req, []byte(FakeKey)) {
+		acsError(w, http.StatusUnauthorized, "Denied", "Denied by the resource provider.")
+		return false
+	}
+	return true
+}
+
+// acsSigned reports whether req carries a valid HMAC-SHA256 signature of ACS made with key
+func acsSigned(req Request, key []byte) bool {
+	sum := sha256.Sum256(req.Body)
+	contentHash := base64.StdEncoding.EncodeToString(sum[:])
+	date := req.Header.Get("x-ms-date")
+	if date == "" || req.Header.Get("x-ms-content-sha256") != contentHash {
+		return false
+	}
+
+	target := req.Path
+	if req.RawQuery != "" {
+		target += "?" + req.RawQuery
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(req.Method + "\n" + target + "\n" + date + ";" + req.Host + ";" + contentHash))
+	want := "HMAC-SHA256 SignedHeaders=x-ms-date;host;x-ms-content-sha256&Signature=" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+	return hmac.Equal([]byte(req.Header.Get("Authorization")), []byte(want))
+}
+
+// acsError writes ACS error response
+func acsError(w http.ResponseWriter, code int, errCode, msg string) {
+	writeJSON(w, code, map[string]any{"error": map[string]string{"code": errCode, "message": msg}})
+}
@@ -0,0 +1,120 @@
+package emailtest
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// brevoMaxRecipients is the recipient limit of a single brevo transactional email
+const brevoMaxRecipients = 99
+
+// brevoContact is a sender or recipient of brevo transactional email
+type brevoContact struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+// brevoPayload is the request body of brevo transactional email
+type brevoPayload struct {
+	Sender      *brevoContact  `json:"sender"`
+	To          []brevoContact `json:"to"`
+	BCC         []brevoContact `json:"bcc"`
+	CC          []brevoContact `json:"cc"`
+	Subject     string         `json:"subject"`
+	HTMLContent string         `json:"htmlContent"`
+	TextContent string         `json:"textContent"`
+	ScheduledAt string         `json:"scheduledAt"`
+	Attachment  []struct {
+		Content string `json:"content"`
+		Name    string `json:"name"`
+	} `json:"attachment"`
+}
+
+// NewBrevoServer starts a fake of brevo transactional email API
+func NewBrevoServer(t testing.TB) *FakeServer {
+	t.Helper()
+	return newFakeServer(t, func(s *FakeServer) http.Handler {
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v3/smtp/email", func(w http.ResponseWriter, r *http.Request) {
+			if !brevoAuthorized(w, r) {
+				return
+			}
+			var p brevoPayload
+			if err := decodeStrict(r, &p); err != nil {
+				brevoError(w, http.StatusBadRequest, "bad_request", err.Error())
+				return
+			}
+			if msg := p.validate(); msg != "" {
+				brevoError(w, http.StatusBadRequest, "missing_parameter", msg)
+				return
+			}
+
+			id := fmt.Sprintf("<%s.%d@smtp-relay.mailin.fr>", time.Now().UTC().Format("200601021504"), time.Now().UnixNano()%1_000_000_000)
+			if p.ScheduledAt != "" {
+				s.schedule(id)
+			}
+			writeJSON(w, http.StatusCreated, map[string]string{"messageId": id})
+		})
+		mux.HandleFunc("DELETE /v3/smtp/email/{identifier}", func(w http.ResponseWriter, r *http.Request) {
+			if !brevoAuthorized(w, r) {
+				return
+			}
+			if !s.unschedule(r.PathValue("identifier")) {
+				brevoError(w, http.StatusNotFound, "not_found", "Scheduled email not found")
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+		return mux
+	})
+}
+
+// validate returns the first problem of the payload as brevo reports it, empty if it is valid
+func (p brevoPayload) validate() string {
+	switch {
+	case p.Sender == nil || strings.TrimSpace(p.Sender.Email) == "":
+		return "sender is missing"
+	case len(p.To) == 0:
+		return "to is missing"
+	case len(p.To)+len(p.CC)+len(p.BCC) > brevoMaxRecipients:
+		return fmt.Sprintf("recipients are more than %d", brevoMaxRecipients)
+	case strings.TrimSpace(p.Subject) == "":
+		return "subject is missing"
+	case p.HTMLContent == "" && p.TextContent == "":
+		return "htmlContent or textContent is missing"
+	}
+	for _, c := range slices.Concat(p.To, p.CC, p.BCC) {
+		if !strings.Contains(c.Email, "@") {
+			return fmt.Sprintf("email is not valid in %q", c.Email)
+		}
+	}
+	if p.ScheduledAt != "" {
+		if _, err := time.Parse(time.RFC3339, p.ScheduledAt); err != nil {
+			return "scheduledAt is not a valid date-time"
+		}
+	}
+	for _, a := range p.Attachment {
+		if a.Name == "" || !isBase64(a.Content) {
+			return "attachment needs a name and base64 content"
+		}
+	}
+	return ""
+}
+
+// brevoAuthorized checks the api-key header, it writes the brevo error response when it is wrong
+func brevoAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("api-key") != FakeKey {
+		brevoError(w, http.StatusUnauthorized, "unauthorized", "Key not found")
+		return false
+	}
+	return true
+}
+
+// brevoError writes brevo error response
+func brevoError(w http.ResponseWriter, code int, errCode, msg string) {
+	writeJSON(w, code, map[string]string{"code": errCode, "message": msg})
+}
@@ -0,0 +1,355 @@
+package emailtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+)
+
+// SenderFactory creates the sender under conformance test from given config
+type SenderFactory func(c emailer.Config) (emailer.Sender, error)
+
+// Provider describes the provider under conformance test
+type Provider struct {
+	// Fake starts the fake server of the provider, which answers successful sends like the provider does.
+	// Sends of providers without a fake are answered with an empty JSON object
+	Fake func(t testing.TB) *FakeServer
+	// Recipients maps "to", "cc" and "bcc" to every path of the request body that holds their addresses.
+	// Paths are lowercase object keys joined by dots such as "personalizations.to.email", arrays are stepped over
+	Recipients map[string][]string
+	// ErrorBody is a JSON error body of the provider whose message is "conformance failure",
+	// the sender must report the message it finds instead of the body as it is. Blank skips the case
+	ErrorBody string
+}
+
+// RunSenderConformance runs the behaviours every provider sender must share against a local fake endpoint.
+// Failures are answered on any path, so the suite only covers immediate sends.
+func RunSenderConformance(t *testing.T, factory SenderFactory, p Provider) {
+	t.Helper()
+
+	email := emailer.Email{
+		From:        "from@conformance.test",
+		To:          []string{"to@conformance.test"},
+		CC:          []string{"cc@conformance.test"},
+		BCC:         []string{"bcc@conformance.test"},
+		Subject:     "conformance subject",
+		HTMLContent: "<p>conformance html</p>",
+		TextContent: "conformance text",
+	}
+
+	t.Run("success", func(t *testing.T) {
+		srv, sender := conformanceSend(t, factory, p)
+		if err := sender.Send(context.Background(), email); err != nil {
+			t.Fatalf("Send(): %v", err)
+		}
+
+		req := srv.LastRequest()
+		// fakes reject requests without the key in the way of their provider, other senders send the key
+		// either as it is, as the user of basic auth or as a body field
+		if p.Fake == nil {
+			user, _, _ := (&http.Request{Header: req.Header}).BasicAuth()
+			_, inBody := jsonPaths(t, req.Body)[FakeKey]
+			authorized := user == FakeKey || inBody
+			for _, values := range req.Header {
+				authorized = authorized || slices.ContainsFunc(values, func(v string) bool { return strings.Contains(v, FakeKey) })
+			}
+			if !authorized {
+				t.Errorf("Send(): API key is not in request headers %v", req.Header)
+			}
+		}
+		if !json.Valid(req.Body) {
+			t.Errorf("Send(): request body is not JSON %q", req.Body)
+		}
+	})
+
+	t.Run("recipients", func(t *testing.T) {
+		srv, sender := conformanceSend(t, factory, p)
+		if err := sender.Send(context.Background(), email); err != nil {
+			t.Fatalf("Send(): %v", err)
+		}
+
+		paths := jsonPaths(t, srv.LastRequest().Body)
+		for field, addr := range map[string]string{"to": email.To[0], "cc": email.CC[0], "bcc": email.BCC[0]} {
+			want, ok := p.Recipients[field]
+			if !ok {
+				t.Errorf("Provider.Recipients has no paths of %s", field)
+				continue
+			}
+			var got []string
+			for _, path := range paths[addr] {
+				got = append(got, strings.Join(path, "."))
+			}
+			slices.Sort(got)
+			if diff := cmp.Diff(slices.Sorted(slices.Values(want)), slices.Compact(got)); diff != "" {
+				t.Errorf("Send(): %s address %q paths diff=\n %v", field, addr, diff)
+			}
+		}
+	})
+
+	contents := []struct {
+		name        string
+		html, text  string
+		sent, unset string
+	}{
+		{name: "text only", text: email.TextContent, sent: email.TextContent, unset: email.HTMLContent},
+		{name: "html only", html: email.HTMLContent, sent: email.HTMLContent, unset: email.TextContent},
+	}
+	for _, tt := range contents {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, sender := conformanceSend(t, factory, p)
+			e := email
+			e.HTMLContent, e.TextContent = tt.html, tt.text
+			if err := sender.Send(context.Background(), e); err != nil {
+				t.Fatalf("Send(): %v", err)
+			}
+
+			paths := jsonPaths(t, srv.LastRequest().Body)
+			if _, ok := paths[tt.sent]; !ok {
+				t.Errorf("Send(): content %q is not in request body", tt.sent)
+			}
+			if _, ok := paths[tt.unset]; ok {
+				t.Errorf("Send(): content %q is in request body", tt.unset)
+			}
+			if emptyPaths, ok := paths[""]; ok {
+				t.Errorf("Send(): empty value is under %q", joinPaths(emptyPaths))
+			}
+		})
+	}
+
+	t.Run("markdown", func(t *testing.T) {
+		srv := conformanceServer(t, p)
+		cfg := srv.Config()
+		cfg.MarkdownLayout = template.Must(template.New("layout").Parse(`{{.Body}}`))
+		sender, err := factory(cfg)
+		if err != nil {
+			t.Fatalf("factory(): %v", err)
+		}
+		e := email
+		e.HTMLContent, e.TextContent, e.MarkdownContent = "", "", "**conformance markdown**"
+		if err := sender.Send(context.Background(), e); err != nil {
+			t.Fatalf("Send(): %v", err)
+		}
+
+		// the markdown is rendered with the configured layout into both contents
+		paths := jsonPaths(t, srv.LastRequest().Body)
+		for _, want := range []string{"<p><strong>conformance markdown</strong></p>\n", "conformance markdown\n"} {
+			if _, ok := paths[want]; !ok {
+				t.Errorf("Send(): content %q is not in request body", want)
+			}
+		}
+		if _, ok := paths[e.MarkdownContent]; ok {
+			t.Errorf("Send(): markdown %q is in request body", e.MarkdownContent)
+		}
+	})
+
+	t.Run("incompatible", func(t *testing.T) {
+		srv := conformanceServer(t, p)
+		sender, err := factory(srv.Config())
+		if err != nil {
+			t.Fatalf("factory(): %v", err)
+		}
+		capable, ok := sender.(emailer.Capable)
+		if !ok {
+			t.Skip("sender does not describe its capabilities")
+		}
+
+		// senders check their own capabilities, so calling them directly is as safe as emailer.SendMessage
+		e, caps := email, capable.Capabilities()
+		switch {
+		case caps.MaxRecipients > 0:
+			e.BCC = make([]string, caps.MaxRecipients)
+			for i := range e.BCC {
+				e.BCC[i] = fmt.Sprintf("bcc%d@conformance.test", i)
+			}
+		case !caps.InlineAttachments:
+			e.Attachments = []emailer.Attachment{{Filename: "logo.png", ContentID: "logo", Data: []byte("png")}}
+		case caps.ScheduleHorizon == 0:
+			e.SendAt = time.Now().Add(time.Hour)
+		default:
+			t.Skip("sender honours every feature of an email")
+		}
+		if err := sender.Send(context.Background(), e); !errors.Is(err, emailer.ErrIncompatible) {
+			t.Errorf("Send(): got=%v want=%v", err, emailer.ErrIncompatible)
+		}
+		if diff := cmp.Diff(0, len(srv.Requests())); diff != "" {
+			t.Errorf("Send(): requests diff=\n %v", diff)
+		}
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		_, sender := conformanceSetup(t, factory, func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			accept(w, r)
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if err := sender.Send(ctx, email); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Send(): got=%v want=%v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("transport error", func(t *testing.T) {
+		sender, err := factory(NewFaultyClientConfig(func(*http.Request) *http.Response { return nil }))
+		if err != nil {
+			t.Fatalf("factory(): %v", err)
+		}
+		if err := sender.Send(context.Background(), email); err == nil {
+			t.Error("Send(): expected error, got nil")
+		}
+	})
+
+	t.Run("JSON error body", func(t *testing.T) {
+		if p.ErrorBody == "" {
+			t.Skip("provider has no error body")
+		}
+		_, sender := conformanceSetup(t, factory, func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, p.ErrorBody)
+		})
+		err := sender.Send(context.Background(), email)
+		var statusErr *emailer.StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Send(): error %q is not a status error of %d", err, http.StatusBadRequest)
+		}
+		if !strings.Contains(err.Error(), "conformance failure") {
+			t.Errorf("Send(): error %q does not contain the message of the error body", err)
+		}
+		if strings.Contains(err.Error(), p.ErrorBody) {
+			t.Errorf("Send(): error %q reports the error body as it is", err)
+		}
+	})
+
+	errorBodies := []struct {
+		name        string
+		code        int
+		contentType string
+		body        string
+		want        []string
+	}{
+		{
+			name:        "non-JSON error body",
+			code:        http.StatusBadGateway,
+			contentType: "text/html",
+			body:        "<html><body>502 Bad Gateway</body></html>",
+			want:        []string{"502"},
+		},
+		{
+			name: "empty error body",
+			code: http.StatusTeapot,
+			want: []string{"418"},
+		},
+	}
+	for _, tt := range errorBodies {
+		t.Run(tt.name, func(t *testing.T) {
+			_, sender := conformanceSetup(t, factory, func(w http.ResponseWriter, _ *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.WriteHeader(tt.code)
+				_, _ = fmt.Fprint(w, tt.body)
+			})
+			err := sender.Send(context.Background(), email)
+			if err == nil {
+				t.Fatal("Send(): expected error, got nil")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Send(): error %q does not contain %q", err, want)
+				}
+			}
+			var statusErr *emailer.StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.code {
+				t.Errorf("Send(): error %q is not a status error of %d", err, tt.code)
+			}
+		})
+	}
+}
+
+// accept answers with an empty JSON object, for providers that have no fake
+func accept(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = fmt.Fprint(w, "{}")
+}
+
+// conformanceServer starts the fake of p, or an endpoint that accepts every request when p has none
+func conformanceServer(t *testing.T, p Provider) *FakeServer {
+	t.Helper()
+	if p.Fake != nil {
+		return p.Fake(t)
+	}
+	return newFakeServer(t, func(*FakeServer) http.Handler { return http.HandlerFunc(accept) })
+}
+
+// conformanceSend starts the server of conformanceServer, then creates the sender for it
+func conformanceSend(t *testing.T, factory SenderFactory, p Provider) (*FakeServer, emailer.Sender) {
+	t.Helper()
+	srv := conformanceServer(t, p)
+	sender, err := factory(srv.Config())
+	if err != nil {
+		t.Fatalf("factory(): %v", err)
+	}
+	return srv, sender
+}
+
+// conformanceSetup starts a fake endpoint that answers every request with respond, then creates the sender for it
+func conformanceSetup(t *testing.T, factory SenderFactory, respond http.HandlerFunc) (*FakeServer, emailer.Sender) {
+	t.Helper()
+	srv := newFakeServer(t, func(*FakeServer) http.Handler { return respond })
+	sender, err := factory(srv.Config())
+	if err != nil {
+		t.Fatalf("factory(): %v", err)
+	}
+	return srv, sender
+}
+
+// joinPaths formats paths of a value for messages
+func joinPaths(paths [][]string) string {
+	joined := make([]string, 0, len(paths))
+	for _, path := range paths {
+		joined = append(joined, strings.Join(path, "."))
+	}
+	return strings.Join(joined, ", ")
+}
+
+// jsonPaths maps every string value of a JSON document to the object keys leading to each of its occurrences
+func jsonPaths(t *testing.T, body []byte) map[string][][]string {
+	t.Helper()
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", body, err)
+	}
+
+	paths := make(map[string][][]string)
+	var walk func(v any, path []string)
+	walk = func(v any, path []string) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, child := range v {
+				walk(child, append(slices.Clone(path), strings.ToLower(k)))
+			}
+		case []any:
+			for _, child := range v {
+				walk(child, path)
+			}
+		case string:
+			paths[v] = append(paths[v], path)
+		}
+	}
+	walk(doc, nil)
+	return paths
+}
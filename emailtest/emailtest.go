@@ -28,6 +28,7 @@ func (f FaultyRoundTripFunc) RoundTrip(req *http.Request) (*http.Response, error
 func NewConfig(tripper RoundTripFunc) emailer.Config {
 	return emailer.Config{
 		Key:    "key",
+		Secret: "secret",
 		Client: http.Client{Transport: tripper},
 	}
 }
@@ -36,6 +37,7 @@ func NewConfig(tripper RoundTripFunc) emailer.Config {
 func NewFaultyClientConfig(tripper FaultyRoundTripFunc) emailer.Config {
 	return emailer.Config{
 		Key:    "key",
+		Secret: "secret",
 		Client: http.Client{Transport: tripper},
 	}
 }
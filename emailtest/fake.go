@@ -0,0 +1,150 @@
+package emailtest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/mrwormhole/emailer"
+)
+
+const (
+	// FakeKey is the API key that fake provider servers accept
+	FakeKey = "fake-key"
+	// FakeSecret is the secret that goes with FakeKey for providers that need a pair
+	FakeSecret = "fake-secret"
+)
+
+// Request is a request received by a fake provider server
+type Request struct {
+	Method   string
+	Host     string
+	Path     string
+	RawQuery string
+	Header   http.Header
+	Body     []byte
+}
+
+// FakeServer is a local stand-in of a provider API that validates and records received requests.
+// It is closed when the test finishes.
+type FakeServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	requests  []Request
+	scheduled map[string]bool
+}
+
+// newFakeServer starts a fake server that records every request before passing it to handler
+func newFakeServer(t testing.TB, handler func(s *FakeServer) http.Handler) *FakeServer {
+	t.Helper()
+	s := &FakeServer{scheduled: make(map[string]bool)}
+	h := handler(s)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{
+			Method:   r.Method,
+			Host:     r.Host,
+			Path:     r.URL.Path,
+			RawQuery: r.URL.RawQuery,
+			Header:   r.Header.Clone(),
+			Body:     body,
+		})
+		s.mu.Unlock()
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Config creates emailer config that points to the fake server with the accepted key
+func (s *FakeServer) Config() emailer.Config {
+	return emailer.Config{
+		Key:     FakeKey,
+		Secret:  FakeSecret,
+		BaseURL: s.URL,
+		Client:  *s.Client(),
+	}
+}
+
+// Requests returns the received requests in order
+func (s *FakeServer) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// LastRequest returns the last received request, the zero request if nothing is received
+func (s *FakeServer) LastRequest() Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		return Request{}
+	}
+	return s.requests[len(s.requests)-1]
+}
+
+// schedule remembers id as a scheduled message that can be canceled
+func (s *FakeServer) schedule(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scheduled[id] = true
+}
+
+// unschedule forgets a scheduled message, it reports whether id was scheduled
+func (s *FakeServer) unschedule(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ok := s.scheduled[id]
+	delete(s.scheduled, id)
+	return ok
+}
+
+// isScheduled reports whether id is a scheduled message
+func (s *FakeServer) isScheduled(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scheduled[id]
+}
+
+// writeJSON writes v as JSON response with given status code
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// decodeStrict decodes JSON body of r into v and rejects unknown fields
+func decodeStrict(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON body: %v", err)
+	}
+	return nil
+}
+
+// isBase64 reports whether s is non-empty standard base64
+func isBase64(s string) bool {
+	_, err := base64.StdEncoding.DecodeString(s)
+	return s != "" && err == nil
+}
+
+// uuid returns a random version 4 UUID
+func uuid() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
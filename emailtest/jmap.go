@@ -0,0 +1,335 @@
+package emailtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	// JMAPIdentity is the only address that the JMAP fake may send from
+	JMAPIdentity = "me@jmap.test"
+	// JMAPRejected is the recipient domain whose submissions are rejected by the JMAP fake
+	JMAPRejected = "rejected.test"
+
+	jmapAccountID = "A1"
+)
+
+// jmapRequest is a JMAP API request, method calls are decoded one by one
+type jmapRequest struct {
+	Using       []string            `json:"using"`
+	MethodCalls [][]json.RawMessage `json:"methodCalls"`
+}
+
+// jmapAddress is a sender or recipient of JMAP email
+type jmapAddress struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// jmapPart is a text part or an attachment of JMAP email
+type jmapPart struct {
+	PartID      string `json:"partId"`
+	BlobID      string `json:"blobId"`
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Disposition string `json:"disposition"`
+	CID         string `json:"cid"`
+}
+
+// jmapEmail is an email that is created with Email/set
+type jmapEmail struct {
+	MailboxIDs  map[string]bool                   `json:"mailboxIds"`
+	Keywords    map[string]bool                   `json:"keywords"`
+	From        []jmapAddress                     `json:"from"`
+	To          []jmapAddress                     `json:"to"`
+	CC          []jmapAddress                     `json:"cc"`
+	BCC         []jmapAddress                     `json:"bcc"`
+	Subject     string                            `json:"subject"`
+	BodyValues  map[string]struct{ Value string } `json:"bodyValues"`
+	TextBody    []jmapPart                        `json:"textBody"`
+	HTMLBody    []jmapPart                        `json:"htmlBody"`
+	Attachments []jmapPart                        `json:"attachments"`
+}
+
+// jmapSubmission is an email submission that is created with EmailSubmission/set
+type jmapSubmission struct {
+	IdentityID string `json:"identityId"`
+	EmailID    string `json:"emailId"`
+	Envelope   *struct {
+		MailFrom jmapAddress   `json:"mailFrom"`
+		RcptTo   []jmapAddress `json:"rcptTo"`
+	} `json:"envelope"`
+}
+
+// jmapFake keeps the blobs and emails of the JMAP fake account
+type jmapFake struct {
+	mu     sync.Mutex
+	blobs  map[string]bool
+	emails map[string]bool
+}
+
+// NewJMAPServer starts a fake of a JMAP server with a single account that has drafts and sent mailboxes and sends from JMAPIdentity.
+// It supports session discovery, blob upload, Mailbox/get, Identity/get, Email/set with create and destroy and EmailSubmission/set
+func NewJMAPServer(t testing.TB) *FakeServer {
+	t.Helper()
+	f := &jmapFake{blobs: make(map[string]bool), emails: make(map[string]bool)}
+	return newFakeServer(t, func(s *FakeServer) http.Handler {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /.well-known/jmap", func(w http.ResponseWriter, r *http.Request) {
+			if !jmapAuthorized(w, r) {
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{
+				"capabilities":    map[string]any{"urn:ietf:params:jmap:core": map[string]any{}},
+				"accounts":        map[string]any{jmapAccountID: map[string]any{"name": JMAPIdentity}},
+				"primaryAccounts": map[string]string{"urn:ietf:params:jmap:mail": jmapAccountID, "urn:ietf:params:jmap:submission": jmapAccountID},
+				"apiUrl":          s.URL + "/jmap/api/",
+				"uploadUrl":       s.URL + "/jmap/upload/{accountId}/",
+				"state":           "0",
+			})
+		})
+		mux.HandleFunc("POST /jmap/upload/{accountId}/", func(w http.ResponseWriter, r *http.Request) {
+			if !jmapAuthorized(w, r) {
+				return
+			}
+			if r.PathValue("accountId") != jmapAccountID {
+				jmapProblem(w, http.StatusNotFound, "notFound", "account not found")
+				return
+			}
+			data, _ := io.ReadAll(r.Body)
+			id := "B" + uuid()
+			f.mu.Lock()
+			f.blobs[id] = true
+			f.mu.Unlock()
+			writeJSON(w, http.StatusCreated, map[string]any{"accountId": jmapAccountID, "blobId": id, "type": r.Header.Get("Content-Type"), "size": len(data)})
+		})
+		mux.HandleFunc("POST /jmap/api/", func(w http.ResponseWriter, r *http.Request) {
+			if !jmapAuthorized(w, r) {
+				return
+			}
+			var req jmapRequest
+			if err := decodeStrict(r, &req); err != nil {
+				jmapProblem(w, http.StatusBadRequest, "notRequest", err.Error())
+				return
+			}
+			// creation IDs of this request map to the IDs they are created with
+			created := make(map[string]string)
+			var responses [][]any
+			for _, call := range req.MethodCalls {
+				var name, callID string
+				if len(call) != 3 || json.Unmarshal(call[0], &name) != nil || json.Unmarshal(call[2], &callID) != nil {
+					jmapProblem(w, http.StatusBadRequest, "notRequest", "method call must be [name, arguments, call ID]")
+					return
+				}
+				responses = append(responses, f.call(name, call[1], callID, created)...)
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"methodResponses": responses, "sessionState": "0"})
+		})
+		return mux
+	})
+}
+
+// call runs a method call, it returns the method response and the implicit ones such as Email/set after a submission
+func (f *jmapFake) call(name string, raw json.RawMessage, callID string, created map[string]string) [][]any {
+	methodError := func(errType, desc string) [][]any {
+		return [][]any{{"error", map[string]string{"type": errType, "description": desc}, callID}}
+	}
+	switch name {
+	case "Mailbox/get":
+		var args struct {
+			AccountID  string   `json:"accountId"`
+			IDs        []string `json:"ids"`
+			Properties []string `json:"properties"`
+		}
+		if err := decodeArgs(raw, &args); err != nil || args.AccountID != jmapAccountID {
+			return methodError("invalidArguments", fmt.Sprint(err))
+		}
+		list := []map[string]any{{"id": "inbox", "role": "inbox"}, {"id": "drafts", "role": "drafts"}, {"id": "sent", "role": "sent"}}
+		return [][]any{{name, map[string]any{"accountId": jmapAccountID, "state": "0", "list": list, "notFound": []string{}}, callID}}
+	case "Identity/get":
+		var args struct {
+			AccountID  string   `json:"accountId"`
+			IDs        []string `json:"ids"`
+			Properties []string `json:"properties"`
+		}
+		if err := decodeArgs(raw, &args); err != nil || args.AccountID != jmapAccountID {
+			return methodError("invalidArguments", fmt.Sprint(err))
+		}
+		list := []map[string]any{{"id": "I1", "name": "Me", "email": JMAPIdentity}}
+		return [][]any{{name, map[string]any{"accountId": jmapAccountID, "state": "0", "list": list, "notFound": []string{}}, callID}}
+	case "Email/set":
+		var args struct {
+			AccountID string               `json:"accountId"`
+			Create    map[string]jmapEmail `json:"create"`
+			Destroy   []string             `json:"destroy"`
+		}
+		if err := decodeArgs(raw, &args); err != nil || args.AccountID != jmapAccountID {
+			return methodError("invalidArguments", fmt.Sprint(err))
+		}
+		res := jmapSetResponse()
+		for cid, e := range args.Create {
+			if props, desc := f.validateEmail(e); desc != "" {
+				res["notCreated"].(map[string]any)[cid] = map[string]any{"type": "invalidProperties", "properties": props, "description": desc}
+				continue
+			}
+			id := "M" + uuid()
+			f.mu.Lock()
+			f.emails[id] = true
+			f.mu.Unlock()
+			created[cid] = id
+			res["created"].(map[string]any)[cid] = map[string]string{"id": id}
+		}
+		destroyed, notDestroyed := []string{}, make(map[string]any)
+		for _, id := range args.Destroy {
+			if !f.destroy(id) {
+				notDestroyed[id] = map[string]string{"type": "notFound"}
+				continue
+			}
+			destroyed = append(destroyed, id)
+		}
+		res["destroyed"], res["notDestroyed"] = destroyed, notDestroyed
+		return [][]any{{name, res, callID}}
+	case "EmailSubmission/set":
+		var args struct {
+			AccountID             string                    `json:"accountId"`
+			Create                map[string]jmapSubmission `json:"create"`
+			OnSuccessUpdateEmail  map[string]map[string]any `json:"onSuccessUpdateEmail"`
+			OnSuccessDestroyEmail []string                  `json:"onSuccessDestroyEmail"`
+		}
+		if err := decodeArgs(raw, &args); err != nil || args.AccountID != jmapAccountID {
+			return methodError("invalidArguments", fmt.Sprint(err))
+		}
+		res := jmapSetResponse()
+		updated, destroyed := make(map[string]any), []string{}
+		for cid, sub := range args.Create {
+			if setErr := f.validateSubmission(sub, created); setErr != nil {
+				res["notCreated"].(map[string]any)[cid] = setErr
+				continue
+			}
+			res["created"].(map[string]any)[cid] = map[string]string{"id": "S" + uuid()}
+			emailID := created[strings.TrimPrefix(sub.EmailID, "#")]
+			if _, ok := args.OnSuccessUpdateEmail["#"+cid]; ok {
+				updated[emailID] = nil
+			}
+			if slices.Contains(args.OnSuccessDestroyEmail, "#"+cid) && f.destroy(emailID) {
+				destroyed = append(destroyed, emailID)
+			}
+		}
+		responses := [][]any{{name, res, callID}}
+		if len(updated) > 0 || len(destroyed) > 0 {
+			emailRes := jmapSetResponse()
+			emailRes["updated"], emailRes["destroyed"] = updated, destroyed
+			responses = append(responses, []any{"Email/set", emailRes, callID})
+		}
+		return responses
+	}
+	return methodError("unknownMethod", name)
+}
+
+// destroy removes the email of given ID, it reports whether the email existed
+func (f *jmapFake) destroy(id string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.emails[id] {
+		return false
+	}
+	delete(f.emails, id)
+	return true
+}
+
+// validateEmail returns the invalid properties of an email and why, empty if it is valid
+func (f *jmapFake) validateEmail(e jmapEmail) ([]string, string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case len(e.MailboxIDs) == 0:
+		return []string{"mailboxIds"}, "email must be in a mailbox"
+	case len(e.From) == 0 || strings.TrimSpace(e.From[0].Email) == "":
+		return []string{"from"}, "from is required"
+	case len(e.BCC) > 0:
+		return []string{"bcc"}, "bcc would be kept in the sent copy"
+	}
+	for id := range e.MailboxIDs {
+		if id != "drafts" && id != "sent" && id != "inbox" {
+			return []string{"mailboxIds"}, "mailbox " + id + " does not exist"
+		}
+	}
+	for _, p := range append(e.TextBody, e.HTMLBody...) {
+		if _, ok := e.BodyValues[p.PartID]; !ok {
+			return []string{"bodyValues"}, "part " + p.PartID + " has no value"
+		}
+	}
+	for _, a := range e.Attachments {
+		if !f.blobs[a.BlobID] {
+			return []string{"attachments"}, "blob " + a.BlobID + " is not uploaded"
+		}
+	}
+	return nil, ""
+}
+
+// validateSubmission returns the set error of a submission as JMAP servers report it, nil if it is valid
+func (f *jmapFake) validateSubmission(sub jmapSubmission, created map[string]string) map[string]any {
+	emailID := sub.EmailID
+	if id, ok := strings.CutPrefix(emailID, "#"); ok {
+		emailID = created[id]
+	}
+	f.mu.Lock()
+	known := f.emails[emailID]
+	f.mu.Unlock()
+	switch {
+	case !known:
+		return map[string]any{"type": "invalidProperties", "properties": []string{"emailId"}, "description": "email does not exist"}
+	case sub.IdentityID != "I1":
+		return map[string]any{"type": "invalidProperties", "properties": []string{"identityId"}, "description": "identity does not exist"}
+	case sub.Envelope == nil || len(sub.Envelope.RcptTo) == 0:
+		return map[string]any{"type": "noRecipients", "description": "envelope has no recipients"}
+	case sub.Envelope.MailFrom.Email != JMAPIdentity:
+		return map[string]any{"type": "forbiddenFrom", "description": "not allowed to send from " + sub.Envelope.MailFrom.Email}
+	}
+	var rejected []string
+	for _, a := range sub.Envelope.RcptTo {
+		if strings.HasSuffix(a.Email, "@"+JMAPRejected) {
+			rejected = append(rejected, a.Email)
+		}
+	}
+	if len(rejected) > 0 {
+		return map[string]any{"type": "invalidRecipients", "invalidRecipients": rejected, "description": "recipients are rejected"}
+	}
+	return nil
+}
+
+// jmapSetResponse returns an empty response of a /set method
+func jmapSetResponse() map[string]any {
+	return map[string]any{"accountId": jmapAccountID, "newState": "1", "created": map[string]any{}, "notCreated": map[string]any{}}
+}
+
+// decodeArgs decodes method call arguments into v and rejects unknown ones
+func decodeArgs(raw json.RawMessage, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// jmapAuthorized checks the bearer token, it writes the JMAP problem response when it is wrong
+func jmapAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Authorization") != "Bearer "+FakeKey {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="jmap"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// jmapProblem writes JMAP request level error response
+func jmapProblem(w http.ResponseWriter, code int, errType, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{"type": "urn:ietf:params:jmap:error:" + errType, "status": code, "detail": detail})
+}
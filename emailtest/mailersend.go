@@ -0,0 +1,143 @@
+package emailtest
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mailersendMaxRecipients is the recipient limit of each mailersend address field
+const mailersendMaxRecipients = 50
+
+// mailersendContact is a sender or recipient of mailersend email
+type mailersendContact struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// mailersendPayload is the request body of mailersend send email
+type mailersendPayload struct {
+	From        *mailersendContact  `json:"from"`
+	To          []mailersendContact `json:"to"`
+	CC          []mailersendContact `json:"cc"`
+	BCC         []mailersendContact `json:"bcc"`
+	Subject     string              `json:"subject"`
+	Text        string              `json:"text"`
+	HTML        string              `json:"html"`
+	Attachments []struct {
+		Content     string `json:"content"`
+		Filename    string `json:"filename"`
+		Disposition string `json:"disposition"`
+		ID          string `json:"id"`
+	} `json:"attachments"`
+	SendAt int64 `json:"send_at"`
+}
+
+// NewMailersendServer starts a fake of mailersend email API
+func NewMailersendServer(t testing.TB) *FakeServer {
+	t.Helper()
+	return newFakeServer(t, func(s *FakeServer) http.Handler {
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v1/email", func(w http.ResponseWriter, r *http.Request) {
+			if !mailersendAuthorized(w, r) {
+				return
+			}
+			var p mailersendPayload
+			if err := decodeStrict(r, &p); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+				return
+			}
+			if errs := p.validate(); len(errs) > 0 {
+				mailersendValidationError(w, errs)
+				return
+			}
+
+			id := strings.ReplaceAll(uuid(), "-", "")[:24]
+			if p.SendAt != 0 {
+				s.schedule(id)
+			}
+			w.Header().Set("X-Message-Id", id)
+			w.WriteHeader(http.StatusAccepted)
+		})
+		mux.HandleFunc("DELETE /v1/message-schedules/{id}", func(w http.ResponseWriter, r *http.Request) {
+			if !mailersendAuthorized(w, r) {
+				return
+			}
+			if !s.unschedule(r.PathValue("id")) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"message": "Resource not found."})
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+		return mux
+	})
+}
+
+// validate returns the problems of the payload keyed by field path as mailersend reports them, none if it is valid
+func (p mailersendPayload) validate() map[string][]string {
+	errs := make(map[string][]string)
+	if p.From == nil || !strings.Contains(p.From.Email, "@") {
+		errs["from.email"] = append(errs["from.email"], "The from.email field is required.")
+	}
+	if len(p.To) == 0 {
+		errs["to"] = append(errs["to"], "The to field is required.")
+	}
+	if strings.TrimSpace(p.Subject) == "" {
+		errs["subject"] = append(errs["subject"], "The subject field is required.")
+	}
+	if p.Text == "" && p.HTML == "" {
+		errs["text"] = append(errs["text"], "The text field is required when html is not present.")
+	}
+	fields := []struct {
+		name     string
+		contacts []mailersendContact
+	}{{"to", p.To}, {"cc", p.CC}, {"bcc", p.BCC}}
+	for _, f := range fields {
+		if len(f.contacts) > mailersendMaxRecipients {
+			errs[f.name] = append(errs[f.name], fmt.Sprintf("The %s may not have more than %d items.", f.name, mailersendMaxRecipients))
+		}
+		for i, c := range f.contacts {
+			if !strings.Contains(c.Email, "@") {
+				key := fmt.Sprintf("%s.%d.email", f.name, i)
+				errs[key] = append(errs[key], fmt.Sprintf("The %s must be a valid email address.", key))
+			}
+		}
+	}
+	for i, a := range p.Attachments {
+		if a.Filename == "" || !isBase64(a.Content) || (a.Disposition != "attachment" && a.Disposition != "inline") {
+			key := fmt.Sprintf("attachments.%d", i)
+			errs[key] = append(errs[key], "The attachment needs filename, base64 content and disposition.")
+		}
+	}
+	if p.SendAt != 0 && time.Until(time.Unix(p.SendAt, 0)) > 72*time.Hour {
+		errs["send_at"] = append(errs["send_at"], "The send at must be a date before 72 hours from now.")
+	}
+	return errs
+}
+
+// mailersendAuthorized checks the bearer token, it writes the mailersend error response when it is wrong
+func mailersendAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Authorization") != "Bearer "+FakeKey {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "Unauthenticated."})
+		return false
+	}
+	return true
+}
+
+// mailersendValidationError writes mailersend 422 response, its message is the first error and tells how many more there are
+func mailersendValidationError(w http.ResponseWriter, errs map[string][]string) {
+	keys := slices.Sorted(maps.Keys(errs))
+	count := 0
+	for _, msgs := range errs {
+		count += len(msgs)
+	}
+	msg := errs[keys[0]][0]
+	if count > 1 {
+		msg = fmt.Sprintf("%s (and %d more errors)", msg, count-1)
+	}
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"message": msg, "errors": errs})
+}
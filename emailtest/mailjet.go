@@ -0,0 +1,139 @@
+package emailtest
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// mailjetMaxRecipients is the recipient limit of a single mailjet message across all address fields
+const mailjetMaxRecipients = 50
+
+// mailjetContact is a sender or recipient of mailjet message
+type mailjetContact struct {
+	Email string `json:"Email"`
+	Name  string `json:"Name"`
+}
+
+// mailjetAttachment is a file of mailjet message
+type mailjetAttachment struct {
+	ContentType   string `json:"ContentType"`
+	Filename      string `json:"Filename"`
+	ContentID     string `json:"ContentID"`
+	Base64Content string `json:"Base64Content"`
+}
+
+// mailjetMessage is a single message of mailjet send request
+type mailjetMessage struct {
+	From               *mailjetContact     `json:"From"`
+	To                 []mailjetContact    `json:"To"`
+	CC                 []mailjetContact    `json:"Cc"`
+	BCC                []mailjetContact    `json:"Bcc"`
+	Subject            string              `json:"Subject"`
+	TextPart           string              `json:"TextPart"`
+	HTMLPart           string              `json:"HTMLPart"`
+	Attachments        []mailjetAttachment `json:"Attachments"`
+	InlinedAttachments []mailjetAttachment `json:"InlinedAttachments"`
+}
+
+// NewMailjetServer starts a fake of mailjet send API v3.1, messages are checked one by one like mailjet does
+func NewMailjetServer(t testing.TB) *FakeServer {
+	t.Helper()
+	return newFakeServer(t, func(*FakeServer) http.Handler {
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v3.1/send", func(w http.ResponseWriter, r *http.Request) {
+			if user, pass, ok := r.BasicAuth(); !ok || user != FakeKey || pass != FakeSecret {
+				writeJSON(w, http.StatusUnauthorized, map[string]any{
+					"ErrorIdentifier": uuid(),
+					"StatusCode":      http.StatusUnauthorized,
+					"ErrorMessage":    "API key authentication/authorization failure. You may be unauthorized to access the API or your API key may be expired. Visit API keys management section to check your keys.",
+				})
+				return
+			}
+			var p struct {
+				Messages []mailjetMessage `json:"Messages"`
+			}
+			if err := decodeStrict(r, &p); err != nil || len(p.Messages) == 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]any{
+					"ErrorIdentifier": uuid(),
+					"ErrorCode":       "mj-0002",
+					"StatusCode":      http.StatusBadRequest,
+					"ErrorMessage":    "Malformed JSON, please review the syntax and properties types.",
+				})
+				return
+			}
+
+			code := http.StatusOK
+			results := make([]map[string]any, 0, len(p.Messages))
+			for i, m := range p.Messages {
+				if field, msg := m.validate(); msg != "" {
+					code = http.StatusBadRequest
+					results = append(results, map[string]any{"Status": "error", "Errors": []map[string]any{{
+						"ErrorIdentifier": uuid(),
+						"ErrorCode":       "mj-0003",
+						"StatusCode":      http.StatusBadRequest,
+						"ErrorMessage":    msg,
+						"ErrorRelatedTo":  []string{fmt.Sprintf("Messages[%d].%s", i, field)},
+					}}})
+					continue
+				}
+				results = append(results, map[string]any{
+					"Status": "success",
+					"To":     mailjetSent(m.To),
+					"Cc":     mailjetSent(m.CC),
+					"Bcc":    mailjetSent(m.BCC),
+				})
+			}
+			writeJSON(w, code, map[string]any{"Messages": results})
+		})
+		return mux
+	})
+}
+
+// validate returns the field and the first problem of the message as mailjet reports it, empty if it is valid
+func (m mailjetMessage) validate() (string, string) {
+	switch {
+	case m.From == nil || !strings.Contains(m.From.Email, "@"):
+		return "From", "Missing mandatory property."
+	case len(m.To) == 0:
+		return "To", "At least one recipient is required."
+	case len(m.To)+len(m.CC)+len(m.BCC) > mailjetMaxRecipients:
+		return "To", fmt.Sprintf("Too many recipients, the maximum is %d.", mailjetMaxRecipients)
+	case m.TextPart == "" && m.HTMLPart == "":
+		return "TextPart", "At least TextPart or HTMLPart is required."
+	}
+	fields := []struct {
+		name     string
+		contacts []mailjetContact
+	}{{"To", m.To}, {"Cc", m.CC}, {"Bcc", m.BCC}}
+	for _, f := range fields {
+		for i, c := range f.contacts {
+			if !strings.Contains(c.Email, "@") {
+				return fmt.Sprintf("%s[%d].Email", f.name, i), fmt.Sprintf("%q is an invalid email address.", c.Email)
+			}
+		}
+	}
+	for i, a := range append(m.Attachments, m.InlinedAttachments...) {
+		if a.Filename == "" || a.ContentType == "" || !isBase64(a.Base64Content) {
+			return fmt.Sprintf("Attachments[%d]", i), "Attachment needs ContentType, Filename and Base64Content."
+		}
+	}
+	return "", ""
+}
+
+// mailjetSent lists contacts as mailjet reports sent recipients
+func mailjetSent(contacts []mailjetContact) []map[string]any {
+	sent := make([]map[string]any, 0, len(contacts))
+	for _, c := range contacts {
+		id := rand.Int64N(1 << 53)
+		sent = append(sent, map[string]any{
+			"Email":       c.Email,
+			"MessageUUID": uuid(),
+			"MessageID":   id,
+			"MessageHref": fmt.Sprintf("https://api.mailjet.com/v3/REST/message/%d", id),
+		})
+	}
+	return sent
+}
@@ -0,0 +1,112 @@
+package emailtest
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// mailtrapMaxRecipients is the recipient limit of each mailtrap address field
+const mailtrapMaxRecipients = 1000
+
+// mailtrapContact is a sender or recipient of mailtrap email
+type mailtrapContact struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// mailtrapPayload is the request body of mailtrap send email
+type mailtrapPayload struct {
+	From        *mailtrapContact  `json:"from"`
+	To          []mailtrapContact `json:"to"`
+	CC          []mailtrapContact `json:"cc"`
+	BCC         []mailtrapContact `json:"bcc"`
+	Subject     string            `json:"subject"`
+	Text        string            `json:"text"`
+	HTML        string            `json:"html"`
+	Attachments []struct {
+		Content     string `json:"content"`
+		Filename    string `json:"filename"`
+		Type        string `json:"type"`
+		Disposition string `json:"disposition"`
+		ContentID   string `json:"content_id"`
+	} `json:"attachments"`
+}
+
+// NewMailtrapServer starts a fake of mailtrap email sending and sandbox APIs, sandbox inbox IDs must be numeric
+func NewMailtrapServer(t testing.TB) *FakeServer {
+	t.Helper()
+	return newFakeServer(t, func(*FakeServer) http.Handler {
+		send := func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Api-Token") != FakeKey && r.Header.Get("Authorization") != "Bearer "+FakeKey {
+				mailtrapError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			if id := r.PathValue("inbox"); id != "" {
+				if _, err := strconv.Atoi(id); err != nil {
+					mailtrapError(w, http.StatusNotFound, "Not Found")
+					return
+				}
+			}
+			var p mailtrapPayload
+			if err := decodeStrict(r, &p); err != nil {
+				mailtrapError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if errs := p.validate(); len(errs) > 0 {
+				mailtrapError(w, http.StatusBadRequest, errs...)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"success": true, "message_ids": []string{strconv.FormatInt(rand.Int64(), 16)}})
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /api/send", send)
+		mux.HandleFunc("POST /api/send/{inbox}", send)
+		return mux
+	})
+}
+
+// validate returns every problem of the payload as mailtrap reports them, none if it is valid
+func (p mailtrapPayload) validate() []string {
+	var errs []string
+	if p.From == nil || !strings.Contains(p.From.Email, "@") {
+		errs = append(errs, "'from' is required")
+	}
+	if len(p.To) == 0 {
+		errs = append(errs, "'to' is required")
+	}
+	if strings.TrimSpace(p.Subject) == "" {
+		errs = append(errs, "'subject' is required")
+	}
+	if p.Text == "" && p.HTML == "" {
+		errs = append(errs, "must specify either text or html body")
+	}
+	fields := []struct {
+		name     string
+		contacts []mailtrapContact
+	}{{"to", p.To}, {"cc", p.CC}, {"bcc", p.BCC}}
+	for _, f := range fields {
+		if len(f.contacts) > mailtrapMaxRecipients {
+			errs = append(errs, fmt.Sprintf("'%s' has more than %d recipients", f.name, mailtrapMaxRecipients))
+		}
+		for _, c := range f.contacts {
+			if !strings.Contains(c.Email, "@") {
+				errs = append(errs, fmt.Sprintf("'%s' address '%s' is invalid", f.name, c.Email))
+			}
+		}
+	}
+	for _, a := range p.Attachments {
+		if a.Filename == "" || !isBase64(a.Content) || (a.Disposition != "attachment" && a.Disposition != "inline") {
+			errs = append(errs, "'attachments' is invalid")
+		}
+	}
+	return errs
+}
+
+// mailtrapError writes mailtrap error response
+func mailtrapError(w http.ResponseWriter, code int, errs ...string) {
+	writeJSON(w, code, map[string]any{"success": false, "errors": errs})
+}
@@ -0,0 +1,104 @@
+package emailtest
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// MandrillRejected is the domain whose recipients the fake mandrill server rejects with a 200 response like mandrill does for bounced or blocked addresses
+const MandrillRejected = "rejected.test"
+
+// mandrillPayload is the request body of mandrill send message
+type mandrillPayload struct {
+	Key     string `json:"key"`
+	Message *struct {
+		FromEmail string `json:"from_email"`
+		FromName  string `json:"from_name"`
+		To        []struct {
+			Email string `json:"email"`
+			Name  string `json:"name"`
+			Type  string `json:"type"`
+		} `json:"to"`
+		Subject            string `json:"subject"`
+		HTML               string `json:"html"`
+		Text               string `json:"text"`
+		PreserveRecipients bool   `json:"preserve_recipients"`
+		Attachments        []struct {
+			Type    string `json:"type"`
+			Name    string `json:"name"`
+			Content string `json:"content"`
+		} `json:"attachments"`
+		Images []struct {
+			Type    string `json:"type"`
+			Name    string `json:"name"`
+			Content string `json:"content"`
+		} `json:"images"`
+	} `json:"message"`
+	SendAt string `json:"send_at"`
+}
+
+// NewMandrillServer starts a fake of mandrill send message API.
+// Invalid addresses get "invalid" status and the ones under MandrillRejected get "rejected" status in a 200 response.
+func NewMandrillServer(t testing.TB) *FakeServer {
+	t.Helper()
+	return newFakeServer(t, func(*FakeServer) http.Handler {
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /api/1.0/messages/send", func(w http.ResponseWriter, r *http.Request) {
+			var p mandrillPayload
+			if err := decodeStrict(r, &p); err != nil {
+				mandrillError(w, -2, "ValidationError", err.Error())
+				return
+			}
+			if p.Key != FakeKey {
+				mandrillError(w, -1, "Invalid_Key", "Invalid API key")
+				return
+			}
+			if msg := p.validate(); msg != "" {
+				mandrillError(w, -2, "ValidationError", msg)
+				return
+			}
+
+			results := make([]map[string]string, 0, len(p.Message.To))
+			for _, rcpt := range p.Message.To {
+				result := map[string]string{"email": rcpt.Email, "status": "sent", "reject_reason": "", "_id": strings.ReplaceAll(uuid(), "-", "")}
+				switch {
+				case !strings.Contains(rcpt.Email, "@"):
+					result["status"] = "invalid"
+				case strings.HasSuffix(rcpt.Email, "@"+MandrillRejected):
+					result["status"], result["reject_reason"] = "rejected", "hard-bounce"
+				}
+				results = append(results, result)
+			}
+			writeJSON(w, http.StatusOK, results)
+		})
+		return mux
+	})
+}
+
+// validate returns the first problem of the payload as mandrill reports it, empty if it is valid
+func (p mandrillPayload) validate() string {
+	m := p.Message
+	switch {
+	case m == nil:
+		return "You must specify a message value"
+	case len(m.To) == 0:
+		return "Validation error: {\"message\":{\"to\":\"Please enter an array\"}}"
+	}
+	for _, rcpt := range m.To {
+		if rcpt.Type != "to" && rcpt.Type != "cc" && rcpt.Type != "bcc" {
+			return "Validation error: {\"message\":{\"to\":{\"type\":\"Please select one of: to, cc, bcc\"}}}"
+		}
+	}
+	for _, a := range append(m.Attachments, m.Images...) {
+		if a.Type == "" || a.Name == "" || !isBase64(a.Content) {
+			return "Validation error: {\"message\":{\"attachments\":\"type, name and base64 content are required\"}}"
+		}
+	}
+	return ""
+}
+
+// mandrillError writes mandrill error response, which mandrill sends with 500 status code
+func mandrillError(w http.ResponseWriter, code int, name, msg string) {
+	writeJSON(w, http.StatusInternalServerError, map[string]any{"status": "error", "code": code, "name": name, "message": msg})
+}
@@ -0,0 +1,150 @@
+package emailtest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mrwormhole/emailer"
+)
+
+// Recorder is a fake email sender that records every successfully sent email, it is safe for concurrent use.
+// The zero value is ready to use.
+type Recorder struct {
+	mu        sync.Mutex
+	calls     int
+	emails    []emailer.Email
+	delay     time.Duration
+	failCalls map[int]error
+	failAddrs map[string]error
+}
+
+// FailCall makes the nth call (starting from 1) of Send fail with err
+func (r *Recorder) FailCall(n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failCalls == nil {
+		r.failCalls = make(map[int]error)
+	}
+	r.failCalls[n] = err
+}
+
+// FailFor makes Send fail with err for emails that have addr as one of their recipients
+func (r *Recorder) FailFor(addr string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failAddrs == nil {
+		r.failAddrs = make(map[string]error)
+	}
+	r.failAddrs[addr] = err
+}
+
+// Delay makes every Send wait for d, or until its context is done
+func (r *Recorder) Delay(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.delay = d
+}
+
+// Send records a given email unless it is programmed to fail
+func (r *Recorder) Send(ctx context.Context, e emailer.Email) error {
+	_, err := r.SendMessage(ctx, e)
+	return err
+}
+
+// SendMessage records a given email unless it is programmed to fail, it returns the call number as message ID
+func (r *Recorder) SendMessage(ctx context.Context, e emailer.Email) (string, error) {
+	r.mu.Lock()
+	r.calls++
+	call, delay := r.calls, r.delay
+	err, ok := r.failCalls[call]
+	if !ok {
+		for _, addr := range recipients(e) {
+			if err, ok = r.failAddrs[addr]; ok {
+				break
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("recorder delay: %w", ctx.Err())
+		case <-t.C:
+		}
+	}
+	if ok {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.emails = append(r.emails, e)
+	return strconv.Itoa(call), nil
+}
+
+// Calls returns the number of Send calls including the failed ones
+func (r *Recorder) Calls() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls
+}
+
+// Emails returns the recorded emails in the order they are sent
+func (r *Recorder) Emails() []emailer.Email {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.emails)
+}
+
+// LastEmail returns the last recorded email, the zero email if nothing is recorded
+func (r *Recorder) LastEmail() emailer.Email {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.emails) == 0 {
+		return emailer.Email{}
+	}
+	return r.emails[len(r.emails)-1]
+}
+
+// Reset forgets recorded emails, calls and programmed failures
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = 0
+	r.emails = nil
+	r.delay = 0
+	r.failCalls = nil
+	r.failAddrs = nil
+}
+
+// AssertSentTo fails the test if no recorded email has addr as one of its recipients
+func (r *Recorder) AssertSentTo(t testing.TB, addr string) {
+	t.Helper()
+	for _, e := range r.Emails() {
+		if slices.Contains(recipients(e), addr) {
+			return
+		}
+	}
+	t.Errorf("AssertSentTo(): no email is sent to %q", addr)
+}
+
+// AssertCount fails the test if the number of recorded emails is not n
+func (r *Recorder) AssertCount(t testing.TB, n int) {
+	t.Helper()
+	if got := len(r.Emails()); got != n {
+		t.Errorf("AssertCount(): got=%d want=%d", got, n)
+	}
+}
+
+// recipients returns to, CC and BCC addresses of e
+func recipients(e emailer.Email) []string {
+	return slices.Concat(e.To, e.CC, e.BCC)
+}
@@ -0,0 +1,103 @@
+package emailtest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+)
+
+func TestRecorder(t *testing.T) {
+	var r Recorder
+	boom := errors.New("boom")
+	r.FailCall(2, boom)
+	r.FailFor("bounce@b.com", boom)
+
+	emails := []emailer.Email{
+		{Subject: "first", To: []string{"b@b.com"}},
+		{Subject: "second", To: []string{"b@b.com"}},
+		{Subject: "third", To: []string{"c@c.com"}, BCC: []string{"bounce@b.com"}},
+		{Subject: "fourth", CC: []string{"d@d.com"}},
+	}
+	var errs []error
+	for _, e := range emails {
+		errs = append(errs, r.Send(context.Background(), e))
+	}
+
+	if diff := cmp.Diff([]error{nil, boom, boom, nil}, errs, cmp.Comparer(errors.Is)); diff != "" {
+		t.Errorf("Send(): errors diff=\n %v", diff)
+	}
+	if diff := cmp.Diff(4, r.Calls()); diff != "" {
+		t.Errorf("Calls(): diff=\n %v", diff)
+	}
+	if diff := cmp.Diff([]emailer.Email{emails[0], emails[3]}, r.Emails()); diff != "" {
+		t.Errorf("Emails(): diff=\n %v", diff)
+	}
+	if diff := cmp.Diff(emails[3], r.LastEmail()); diff != "" {
+		t.Errorf("LastEmail(): diff=\n %v", diff)
+	}
+	r.AssertSentTo(t, "b@b.com")
+	r.AssertSentTo(t, "d@d.com")
+	r.AssertCount(t, 2)
+
+	r.Reset()
+	r.AssertCount(t, 0)
+	if diff := cmp.Diff(emailer.Email{}, r.LastEmail()); diff != "" {
+		t.Errorf("LastEmail(): diff=\n %v", diff)
+	}
+}
+
+func TestRecorder_Concurrent(t *testing.T) {
+	var r Recorder
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Go(func() {
+			if err := r.Send(context.Background(), emailer.Email{To: []string{"b@b.com"}}); err != nil {
+				t.Errorf("Send(): %v", err)
+			}
+		})
+	}
+	wg.Wait()
+	r.AssertCount(t, 50)
+}
+
+func TestRecorder_Delay(t *testing.T) {
+	var r Recorder
+	r.Delay(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := r.Send(ctx, emailer.Email{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Send(): got=%v want=%v", err, context.DeadlineExceeded)
+	}
+	r.AssertCount(t, 0)
+}
+
+func TestRecorder_Handler(t *testing.T) {
+	var r Recorder
+	body := `{"from": "a@a.com", "to": ["b@b.com"], "subject": "sub", "textContent": "text"}`
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/email", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	emailer.HandlerFunc(&r).ServeHTTP(rr, req)
+
+	if diff := cmp.Diff(http.StatusOK, rr.Code); diff != "" {
+		t.Errorf("HandlerFunc(): HTTP code diff=\n %v", diff)
+	}
+	// the call number is returned as message ID
+	if diff := cmp.Diff("1", rr.Header().Get("X-Message-Id")); diff != "" {
+		t.Errorf("HandlerFunc(): X-Message-Id diff=\n %v", diff)
+	}
+	r.AssertCount(t, 1)
+	want := emailer.Email{From: "a@a.com", To: []string{"b@b.com"}, Subject: "sub", TextContent: "text"}
+	if diff := cmp.Diff(want, r.LastEmail()); diff != "" {
+		t.Errorf("HandlerFunc(): sent email diff=\n %v", diff)
+	}
+}
@@ -0,0 +1,147 @@
+package emailtest
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resendMaxRecipients is the recipient limit of each resend address field
+const resendMaxRecipients = 50
+
+// resendPayload is the request body of resend send email
+type resendPayload struct {
+	From        string   `json:"from"`
+	To          []string `json:"to"`
+	BCC         []string `json:"bcc"`
+	CC          []string `json:"cc"`
+	Subject     string   `json:"subject"`
+	HTML        string   `json:"html"`
+	Text        string   `json:"text"`
+	ScheduledAt string   `json:"scheduled_at"`
+	Attachments []struct {
+		Content     string `json:"content"`
+		Filename    string `json:"filename"`
+		ContentType string `json:"content_type"`
+		ContentID   string `json:"content_id"`
+	} `json:"attachments"`
+}
+
+// NewResendServer starts a fake of resend emails API
+func NewResendServer(t testing.TB) *FakeServer {
+	t.Helper()
+	return newFakeServer(t, func(s *FakeServer) http.Handler {
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /emails", func(w http.ResponseWriter, r *http.Request) {
+			if !resendAuthorized(w, r) {
+				return
+			}
+			var p resendPayload
+			if err := decodeStrict(r, &p); err != nil {
+				resendError(w, http.StatusUnprocessableEntity, "validation_error", err.Error())
+				return
+			}
+			if msg := p.validate(); msg != "" {
+				resendError(w, http.StatusUnprocessableEntity, "validation_error", msg)
+				return
+			}
+
+			id := uuid()
+			if p.ScheduledAt != "" {
+				s.schedule(id)
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"id": id})
+		})
+		mux.HandleFunc("POST /emails/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+			if !resendAuthorized(w, r) {
+				return
+			}
+			if !s.unschedule(r.PathValue("id")) {
+				resendError(w, http.StatusNotFound, "not_found", "Email not found")
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"object": "email", "id": r.PathValue("id")})
+		})
+		mux.HandleFunc("PATCH /emails/{id}", func(w http.ResponseWriter, r *http.Request) {
+			if !resendAuthorized(w, r) {
+				return
+			}
+			var p struct {
+				ScheduledAt string `json:"scheduled_at"`
+			}
+			if err := decodeStrict(r, &p); err != nil {
+				resendError(w, http.StatusUnprocessableEntity, "validation_error", err.Error())
+				return
+			}
+			if _, err := time.Parse(time.RFC3339, p.ScheduledAt); err != nil {
+				resendError(w, http.StatusUnprocessableEntity, "validation_error", "scheduled_at is not a valid date")
+				return
+			}
+			if !s.isScheduled(r.PathValue("id")) {
+				resendError(w, http.StatusNotFound, "not_found", "Email not found")
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"object": "email", "id": r.PathValue("id")})
+		})
+		return mux
+	})
+}
+
+// validate returns the first problem of the payload as resend reports it, empty if it is valid
+func (p resendPayload) validate() string {
+	switch {
+	case strings.TrimSpace(p.From) == "":
+		return "Missing `from` field."
+	case len(p.To) == 0:
+		return "Missing `to` field."
+	case strings.TrimSpace(p.Subject) == "":
+		return "Missing `subject` field."
+	case p.HTML == "" && p.Text == "":
+		return "Missing `html` or `text` field."
+	}
+	fields := []struct {
+		name  string
+		addrs []string
+	}{{"to", p.To}, {"cc", p.CC}, {"bcc", p.BCC}}
+	for _, f := range fields {
+		if len(f.addrs) > resendMaxRecipients {
+			return fmt.Sprintf("Too many recipients in `%s` field, the maximum is %d.", f.name, resendMaxRecipients)
+		}
+		if slices.ContainsFunc(f.addrs, func(a string) bool { return !strings.Contains(a, "@") }) {
+			return fmt.Sprintf("Invalid `%s` field. The email address needs to follow the `email@example.com` format.", f.name)
+		}
+	}
+	if p.ScheduledAt != "" {
+		if _, err := time.Parse(time.RFC3339, p.ScheduledAt); err != nil {
+			return "Invalid `scheduled_at` field."
+		}
+	}
+	for _, a := range p.Attachments {
+		if a.Filename == "" || !isBase64(a.Content) {
+			return "Invalid `attachments` field."
+		}
+	}
+	return ""
+}
+
+// resendAuthorized checks the bearer token, it writes the resend error response when it is wrong
+func resendAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		resendError(w, http.StatusUnauthorized, "missing_api_key", "Missing API key in the authorization header.")
+		return false
+	}
+	if auth != "Bearer "+FakeKey {
+		resendError(w, http.StatusForbidden, "invalid_api_key", "API key is invalid.")
+		return false
+	}
+	return true
+}
+
+// resendError writes resend error response
+func resendError(w http.ResponseWriter, code int, name, msg string) {
+	writeJSON(w, code, map[string]any{"statusCode": code, "name": name, "message": msg})
+}
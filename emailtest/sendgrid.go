@@ -0,0 +1,175 @@
+package emailtest
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	// sendgridMaxRecipients is the recipient limit of a single sendgrid mail send
+	sendgridMaxRecipients = 1000
+	// sendgridMaxSchedule is how far in the future sendgrid accepts send_at
+	sendgridMaxSchedule = 72 * time.Hour
+)
+
+// sendgridEmail is an address object of sendgrid mail send
+type sendgridEmail struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+// sendgridPayload is the request body of sendgrid mail send
+type sendgridPayload struct {
+	Personalizations []struct {
+		To  []sendgridEmail `json:"to"`
+		BCC []sendgridEmail `json:"bcc"`
+		CC  []sendgridEmail `json:"cc"`
+	} `json:"personalizations"`
+	From    *sendgridEmail `json:"from"`
+	Subject string         `json:"subject"`
+	Content []struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	} `json:"content"`
+	SendAt      int64  `json:"send_at"`
+	BatchID     string `json:"batch_id"`
+	Attachments []struct {
+		Content     string `json:"content"`
+		Type        string `json:"type"`
+		Filename    string `json:"filename"`
+		Disposition string `json:"disposition"`
+		ContentID   string `json:"content_id"`
+	} `json:"attachments"`
+}
+
+// NewSendgridServer starts a fake of sendgrid mail send API
+func NewSendgridServer(t testing.TB) *FakeServer {
+	t.Helper()
+	return newFakeServer(t, func(s *FakeServer) http.Handler {
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v3/mail/send", func(w http.ResponseWriter, r *http.Request) {
+			if !sendgridAuthorized(w, r) {
+				return
+			}
+			var p sendgridPayload
+			if err := decodeStrict(r, &p); err != nil {
+				sendgridError(w, http.StatusBadRequest, "", err.Error())
+				return
+			}
+			if field, msg := p.validate(); msg != "" {
+				sendgridError(w, http.StatusBadRequest, field, msg)
+				return
+			}
+			if p.BatchID != "" && !s.isScheduled(p.BatchID) {
+				sendgridError(w, http.StatusBadRequest, "batch_id", "The batch ID is not valid.")
+				return
+			}
+
+			w.Header().Set("X-Message-Id", strings.ReplaceAll(uuid(), "-", "")[:22])
+			w.WriteHeader(http.StatusAccepted)
+		})
+		mux.HandleFunc("POST /v3/mail/batch", func(w http.ResponseWriter, r *http.Request) {
+			if !sendgridAuthorized(w, r) {
+				return
+			}
+			id := uuid()
+			s.schedule(id)
+			writeJSON(w, http.StatusCreated, map[string]string{"batch_id": id})
+		})
+		mux.HandleFunc("POST /v3/user/scheduled_sends", func(w http.ResponseWriter, r *http.Request) {
+			if !sendgridAuthorized(w, r) {
+				return
+			}
+			var p struct {
+				BatchID string `json:"batch_id"`
+				Status  string `json:"status"`
+			}
+			if err := decodeStrict(r, &p); err != nil {
+				sendgridError(w, http.StatusBadRequest, "", err.Error())
+				return
+			}
+			if p.Status != "cancel" && p.Status != "pause" {
+				sendgridError(w, http.StatusBadRequest, "status", "status must be either cancel or pause")
+				return
+			}
+			if !s.unschedule(p.BatchID) {
+				sendgridError(w, http.StatusNotFound, "batch_id", "batch id not found")
+				return
+			}
+			writeJSON(w, http.StatusCreated, p)
+		})
+		return mux
+	})
+}
+
+// validate returns the field and the first problem of the payload as sendgrid reports it, empty if it is valid
+func (p sendgridPayload) validate() (string, string) {
+	switch {
+	case len(p.Personalizations) == 0:
+		return "personalizations", "The personalizations field is required and must have at least one personalization."
+	case p.From == nil || strings.TrimSpace(p.From.Email) == "":
+		return "from.email", "The from email does not contain a valid address."
+	case strings.TrimSpace(p.Subject) == "":
+		return "subject", "The subject is required. You can get around this requirement if you use a template with a subject defined or if every personalization has a subject defined."
+	case len(p.Content) == 0:
+		return "content", "Unless a valid template_id is provided, the content parameter is required. There must be at least one defined content block."
+	}
+
+	total := 0
+	for i, pers := range p.Personalizations {
+		if len(pers.To) == 0 {
+			return fmt.Sprintf("personalizations.%d.to", i), "The to array is required for all personalization objects, and must have at least one email object with a valid email address."
+		}
+		addrs := slices.Concat(pers.To, pers.CC, pers.BCC)
+		total += len(addrs)
+		for _, a := range addrs {
+			if !strings.Contains(a.Email, "@") {
+				return fmt.Sprintf("personalizations.%d", i), "Does not contain a valid address."
+			}
+		}
+	}
+	if total > sendgridMaxRecipients {
+		return "personalizations", fmt.Sprintf("The total number of recipients must be less than %d.", sendgridMaxRecipients)
+	}
+	for i, c := range p.Content {
+		if c.Type == "" || c.Value == "" {
+			return fmt.Sprintf("content.%d", i), "The content value must be a string at least one character in length."
+		}
+	}
+	for i, a := range p.Attachments {
+		switch {
+		case a.Filename == "" || !isBase64(a.Content):
+			return fmt.Sprintf("attachments.%d", i), "The attachment content must be base64 encoded and have a filename."
+		case a.Disposition == "inline" && a.ContentID == "":
+			return fmt.Sprintf("attachments.%d.content_id", i), "The content_id parameter is required if disposition is set to inline."
+		}
+	}
+	if p.SendAt != 0 && time.Until(time.Unix(p.SendAt, 0)) > sendgridMaxSchedule {
+		return "send_at", "The send_at parameter can't be scheduled more than 72 hours in advance."
+	}
+	return "", ""
+}
+
+// sendgridAuthorized checks the bearer token, it writes the sendgrid error response when it is wrong
+func sendgridAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Authorization") != "Bearer "+FakeKey {
+		sendgridError(w, http.StatusUnauthorized, "", "The provided authorization grant is invalid, expired, or revoked")
+		return false
+	}
+	return true
+}
+
+// sendgridError writes sendgrid error response
+func sendgridError(w http.ResponseWriter, code int, field, msg string) {
+	var f any
+	if field != "" {
+		f = field
+	}
+	writeJSON(w, code, map[string]any{
+		"errors": []map[string]any{{"message": msg, "field": f, "help": nil}},
+	})
+}
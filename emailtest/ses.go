@@ -0,0 +1,110 @@
+package emailtest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// sesMaxRecipients is the recipient limit of a single SES email across all address fields
+const sesMaxRecipients = 50
+
+// sesContent is text or HTML body, or subject of SES simple email
+type sesContent struct {
+	Data    string `json:"Data"`
+	Charset string `json:"Charset"`
+}
+
+// sesPayload is the request body of SES v2 send email
+type sesPayload struct {
+	FromEmailAddress string `json:"FromEmailAddress"`
+	Destination      struct {
+		ToAddresses  []string `json:"ToAddresses"`
+		CcAddresses  []string `json:"CcAddresses"`
+		BccAddresses []string `json:"BccAddresses"`
+	} `json:"Destination"`
+	Content struct {
+		Simple *struct {
+			Subject sesContent `json:"Subject"`
+			Body    struct {
+				Text *sesContent `json:"Text"`
+				HTML *sesContent `json:"Html"`
+			} `json:"Body"`
+		} `json:"Simple"`
+		Raw *struct {
+			Data string `json:"Data"`
+		} `json:"Raw"`
+	} `json:"Content"`
+}
+
+// NewSESServer starts a fake of SES v2 send email API, it checks the shape of signature v4 authorization but not the signature itself
+func NewSESServer(t testing.TB) *FakeServer {
+	t.Helper()
+	return newFakeServer(t, func(*FakeServer) http.Handler {
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v2/email/outbound-emails", func(w http.ResponseWriter, r *http.Request) {
+			if !sesAuthorized(w, r) {
+				return
+			}
+			var p sesPayload
+			if err := decodeStrict(r, &p); err != nil {
+				sesError(w, http.StatusBadRequest, "BadRequestException", err.Error())
+				return
+			}
+			if msg := p.validate(); msg != "" {
+				sesError(w, http.StatusBadRequest, "BadRequestException", msg)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"MessageId": uuid()})
+		})
+		return mux
+	})
+}
+
+// validate returns the first problem of the payload as SES reports it, empty if it is valid
+func (p sesPayload) validate() string {
+	d := p.Destination
+	switch {
+	case strings.TrimSpace(p.FromEmailAddress) == "":
+		return "Missing required field FromEmailAddress"
+	case len(d.ToAddresses)+len(d.CcAddresses)+len(d.BccAddresses) == 0:
+		return "Missing required field Destination"
+	case len(d.ToAddresses)+len(d.CcAddresses)+len(d.BccAddresses) > sesMaxRecipients:
+		return fmt.Sprintf("Recipient count exceeds %d", sesMaxRecipients)
+	case (p.Content.Simple == nil) == (p.Content.Raw == nil):
+		return "Exactly one of Simple, Raw or Template content must be specified"
+	}
+	if s := p.Content.Simple; s != nil {
+		if strings.TrimSpace(s.Subject.Data) == "" {
+			return "Missing required field Subject"
+		}
+		if s.Body.Text == nil && s.Body.HTML == nil {
+			return "Missing required field Body"
+		}
+	}
+	if p.Content.Raw != nil && !isBase64(p.Content.Raw.Data) {
+		return "Raw message data must be base64 encoded"
+	}
+	return ""
+}
+
+// sesAuthorized checks the signature v4 authorization header, it writes the SES error response when it is wrong
+func sesAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if auth == "" || r.Header.Get("X-Amz-Date") == "" {
+		sesError(w, http.StatusForbidden, "MissingAuthenticationTokenException", "Missing Authentication Token")
+		return false
+	}
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential="+FakeKey+"/") || !strings.Contains(auth, "Signature=") {
+		sesError(w, http.StatusForbidden, "UnrecognizedClientException", "The security token included in the request is invalid.")
+		return false
+	}
+	return true
+}
+
+// sesError writes SES error response, which names the error in a header
+func sesError(w http.ResponseWriter, code int, errType, msg string) {
+	w.Header().Set("X-Amzn-ErrorType", errType)
+	writeJSON(w, code, map[string]string{"message": msg})
+}
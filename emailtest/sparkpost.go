@@ -0,0 +1,107 @@
+package emailtest
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// sparkpostPayload is the request body of sparkpost create transmission
+type sparkpostPayload struct {
+	Recipients []struct {
+		Address *struct {
+			Email    string `json:"email"`
+			Name     string `json:"name"`
+			HeaderTo string `json:"header_to"`
+		} `json:"address"`
+	} `json:"recipients"`
+	Content *struct {
+		From        string            `json:"from"`
+		Subject     string            `json:"subject"`
+		Text        string            `json:"text"`
+		HTML        string            `json:"html"`
+		Headers     map[string]string `json:"headers"`
+		Attachments []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+			Data string `json:"data"`
+		} `json:"attachments"`
+		InlineImages []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+			Data string `json:"data"`
+		} `json:"inline_images"`
+	} `json:"content"`
+	Options map[string]any `json:"options"`
+}
+
+// NewSparkpostServer starts a fake of sparkpost transmissions API
+func NewSparkpostServer(t testing.TB) *FakeServer {
+	t.Helper()
+	return newFakeServer(t, func(*FakeServer) http.Handler {
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /api/v1/transmissions", func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != FakeKey {
+				sparkpostError(w, http.StatusUnauthorized, "Unauthorized.", "", "")
+				return
+			}
+			var p sparkpostPayload
+			if err := decodeStrict(r, &p); err != nil {
+				sparkpostError(w, http.StatusBadRequest, "invalid data format/type", err.Error(), "1300")
+				return
+			}
+			if desc := p.validate(); desc != "" {
+				sparkpostError(w, http.StatusUnprocessableEntity, "invalid data format/type", desc, "1300")
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"results": map[string]any{
+				"total_rejected_recipients": 0,
+				"total_accepted_recipients": len(p.Recipients),
+				"id":                        strconv.FormatUint(rand.Uint64(), 10),
+			}})
+		})
+		return mux
+	})
+}
+
+// validate returns the first problem of the payload as sparkpost describes it, empty if it is valid
+func (p sparkpostPayload) validate() string {
+	switch {
+	case len(p.Recipients) == 0:
+		return "recipients or list_id required"
+	case p.Content == nil:
+		return "content object is required"
+	case !strings.Contains(p.Content.From, "@"):
+		return "content.from is required"
+	case strings.TrimSpace(p.Content.Subject) == "":
+		return "content.subject is required"
+	case p.Content.Text == "" && p.Content.HTML == "":
+		return "At least one of text or html needs to exist in content"
+	}
+	for i, rcpt := range p.Recipients {
+		if rcpt.Address == nil || !strings.Contains(rcpt.Address.Email, "@") {
+			return fmt.Sprintf("Invalid recipient address.email in recipients[%d]", i)
+		}
+	}
+	for _, a := range append(p.Content.Attachments, p.Content.InlineImages...) {
+		if a.Name == "" || a.Type == "" || !isBase64(a.Data) {
+			return "attachment name, type and base64 data are required"
+		}
+	}
+	return ""
+}
+
+// sparkpostError writes sparkpost error response
+func sparkpostError(w http.ResponseWriter, code int, msg, desc, errCode string) {
+	e := map[string]string{"message": msg}
+	if desc != "" {
+		e["description"] = desc
+	}
+	if errCode != "" {
+		e["code"] = errCode
+	}
+	writeJSON(w, code, map[string]any{"errors": []map[string]string{e}})
+}
@@ -0,0 +1,93 @@
+// Package file writes emails as RFC 5322 messages to a directory instead of sending them, the files open in any mail client.
+//
+// Example usage:
+//
+//	 a, err := file.New("/var/mail/archive", file.Maildir)
+//		if err != nil {
+//			//check err
+//		}
+//	 a.Send(ctx, email)
+package file
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mrwormhole/emailer"
+	"github.com/mrwormhole/emailer/mime"
+)
+
+// Format is the layout of the archive directory
+type Format int
+
+const (
+	// EML writes each email as a .eml file right into the directory
+	EML Format = iota
+	// Maildir delivers each email into new subdirectory of a Maildir, see https://cr.yp.to/proto/maildir.html
+	Maildir
+)
+
+// Archive is an email sender that writes every email to a directory
+type Archive struct {
+	dir    string
+	format Format
+}
+
+// New creates an archive of given format in dir, the directory is created when it does not exist
+func New(dir string, format Format) (*Archive, error) {
+	if strings.TrimSpace(dir) == "" {
+		return nil, errors.New("file archive directory is blank")
+	}
+	subdirs := []string{""}
+	if format == Maildir {
+		subdirs = []string{"tmp", "new", "cur"}
+	}
+	for _, sub := range subdirs {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o750); err != nil {
+			return nil, fmt.Errorf("os.MkdirAll(%q): %v", filepath.Join(dir, sub), err)
+		}
+	}
+	return &Archive{dir: dir, format: format}, nil
+}
+
+// Send writes a given email
+func (a *Archive) Send(ctx context.Context, e emailer.Email) error {
+	_, err := a.SendMessage(ctx, e)
+	return err
+}
+
+// SendMessage writes a given email and returns its file name as message ID
+func (a *Archive) SendMessage(_ context.Context, e emailer.Email) (string, error) {
+	now := time.Now()
+	raw, err := mime.New(e).Date(now).KeepBCC().Build()
+	if err != nil {
+		return "", fmt.Errorf("mime.New().Build(): %v", err)
+	}
+
+	// every file is written aside first then renamed, so readers never see half written messages
+	name := fmt.Sprintf("%d.%s", now.UnixNano(), strings.ToLower(rand.Text()))
+	var tmp, dst string
+	if a.format == Maildir {
+		host, _ := os.Hostname()
+		name += "." + strings.NewReplacer("/", `\057`, ":", `\072`).Replace(host)
+		tmp, dst = filepath.Join(a.dir, "tmp", name), filepath.Join(a.dir, "new", name)
+	} else {
+		name += ".eml"
+		tmp, dst = filepath.Join(a.dir, "."+name+".tmp"), filepath.Join(a.dir, name)
+	}
+
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return "", fmt.Errorf("os.WriteFile(%q): %v", tmp, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return "", fmt.Errorf("os.Rename(%q): %v", tmp, err)
+	}
+	return name, nil
+}
@@ -0,0 +1,92 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(" ", EML)
+	want := errors.New("file archive directory is blank")
+	if !cmp.Equal(want.Error(), err.Error()) {
+		t.Errorf("New(): got=%q want=%q", err, want)
+	}
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		subdir string
+	}{
+		{name: "eml", format: EML, subdir: ""},
+		{name: "maildir", format: Maildir, subdir: "new"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "archive")
+			a, err := New(dir, tt.format)
+			if err != nil {
+				t.Fatalf("New(): %v", err)
+			}
+
+			email := emailer.Email{
+				From:        "a@a.com",
+				To:          []string{"b@b.com"},
+				BCC:         []string{"bcc@bcc.com"},
+				Subject:     "sub",
+				TextContent: "text",
+			}
+			name, err := a.SendMessage(context.Background(), email)
+			if err != nil {
+				t.Fatalf("SendMessage(): %v", err)
+			}
+
+			entries, err := os.ReadDir(filepath.Join(dir, tt.subdir))
+			if err != nil {
+				t.Fatalf("os.ReadDir(): %v", err)
+			}
+			var names []string
+			for _, e := range entries {
+				if !e.IsDir() {
+					names = append(names, e.Name())
+				}
+			}
+			if diff := cmp.Diff([]string{name}, names); diff != "" {
+				t.Errorf("SendMessage(): files diff=\n %v", diff)
+			}
+
+			f, err := os.Open(filepath.Join(dir, tt.subdir, name))
+			if err != nil {
+				t.Fatalf("os.Open(): %v", err)
+			}
+			defer f.Close()
+			msg, err := mail.ReadMessage(f)
+			if err != nil {
+				t.Fatalf("mail.ReadMessage(): %v", err)
+			}
+			got := map[string]string{
+				"From":    msg.Header.Get("From"),
+				"To":      msg.Header.Get("To"),
+				"Bcc":     msg.Header.Get("Bcc"),
+				"Subject": msg.Header.Get("Subject"),
+			}
+			want := map[string]string{"From": "a@a.com", "To": "b@b.com", "Bcc": "bcc@bcc.com", "Subject": "sub"}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("SendMessage(): headers diff=\n %v", diff)
+			}
+			if !strings.HasSuffix(msg.Header.Get("Message-ID"), "@a.com>") {
+				t.Errorf("SendMessage(): Message-ID %q is not under sender domain", msg.Header.Get("Message-ID"))
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+// Package generic makes it easy to send emails via HTTP APIs without a package of their own, such as ZeptoMail or an internal
+// mail gateway. The API is described declaratively in JSON or YAML, see Description and testdata/zeptomail.yaml.
+//
+// Example usage:
+//
+//	 email := emailer.Email{
+//		From:        "skywalker@jedi.com",
+//		To:          []string{"vindu@sith.com"},
+//		Subject:     "peace",
+//		TextContent: "peace was never an option",
+//	 }
+//	 d, err := Load("zeptomail.yaml")
+//		if err != nil {
+//			//check err
+//		}
+//	 c, err := New(emailer.Config{Key: "api-key"}, d)
+//		if err != nil {
+//			//check err
+//		}
+//	 c.Send(ctx, email)
+package generic
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/mrwormhole/emailer"
+)
+
+// Auth types of Description
+const (
+	AuthHeader = "header"
+	AuthBasic  = "basic"
+	AuthNone   = "none"
+)
+
+// headerPrefix is the prefix of Response.MessageID that takes the message ID from a response header
+const headerPrefix = "header:"
+
+// Description describes an HTTP email API
+type Description struct {
+	// Name is used in errors, generic unless set
+	Name string `json:"name" yaml:"name"`
+	// URL is where emails are sent, Config.BaseURL replaces its scheme and host when it is set
+	URL string `json:"url" yaml:"url"`
+	// Method is POST unless set
+	Method string `json:"method" yaml:"method"`
+	// ContentType of the body is application/json unless set, JSON bodies are checked to be valid after rendering
+	ContentType string `json:"contentType" yaml:"contentType"`
+	// Headers are sent as they are with every request
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	Auth    Auth              `json:"auth" yaml:"auth"`
+	// Body is a text/template that renders the request body from Data,
+	// it has json, base64 and join functions on top of the builtin ones
+	Body     string   `json:"body" yaml:"body"`
+	Response Response `json:"response" yaml:"response"`
+	// Capabilities describes what the API can honour of an email, durations are written like "72h"
+	Capabilities emailer.Capabilities `json:"capabilities" yaml:"capabilities"`
+}
+
+// Auth describes how Config.Key is sent
+type Auth struct {
+	// Type is AuthHeader unless set. AuthBasic sends Config.Key and Config.Secret as basic auth, AuthNone sends nothing
+	Type string `json:"type" yaml:"type"`
+	// Header carries the key for AuthHeader, Authorization unless set
+	Header string `json:"header" yaml:"header"`
+	// Prefix goes before the key for AuthHeader, such as "Bearer "
+	Prefix string `json:"prefix" yaml:"prefix"`
+}
+
+// Response describes how responses are read
+type Response struct {
+	// Success lists the status codes of successful responses, any 2xx unless set
+	Success []int `json:"success" yaml:"success"`
+	// MessageID is where the message ID is in a successful response,
+	// either "header:<name>" or a dotted JSON path such as "data.0.id" where numbers index arrays
+	MessageID string `json:"messageId" yaml:"messageId"`
+	// Error is the dotted JSON path of the error message in an unsuccessful response, the whole body is reported unless set
+	Error string `json:"error" yaml:"error"`
+}
+
+// Data is what Description.Body is rendered with, the email fields are promoted so templates can use .From or .Subject
+type Data struct {
+	emailer.Email
+	Key string
+}
+
+// Parse parses a JSON or YAML description, unknown fields are rejected
+func Parse(b []byte) (Description, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	var d Description
+	if err := dec.Decode(&d); err != nil {
+		return Description{}, fmt.Errorf("dec.Decode(): %v", err)
+	}
+	return d, nil
+}
+
+// Load reads and parses the JSON or YAML description at path
+func Load(path string) (Description, error) {
+	b, err := os.ReadFile(path) //nolint:gosec //path is configured by the operator
+	if err != nil {
+		return Description{}, fmt.Errorf("os.ReadFile(%q): %v", path, err)
+	}
+	return Parse(b)
+}
+
+// EmailClient is an email client of the described API
+type EmailClient struct {
+	name           string
+	key            string
+	secret         string
+	target         string
+	desc           Description
+	body           *texttemplate.Template
+	markdownLayout *template.Template
+	client         http.Client
+}
+
+// New creates a new email client of given description with given API key and http.Client
+func New(c emailer.Config, d Description) (*EmailClient, error) {
+	name := cmp.Or(d.Name, "generic")
+	d.Method = cmp.Or(strings.ToUpper(d.Method), http.MethodPost)
+	d.ContentType = cmp.Or(d.ContentType, "application/json")
+	d.Auth.Type = cmp.Or(d.Auth.Type, AuthHeader)
+	d.Auth.Header = cmp.Or(d.Auth.Header, "Authorization")
+
+	switch d.Auth.Type {
+	case AuthHeader, AuthBasic:
+		if strings.TrimSpace(c.Key) == "" {
+			return nil, fmt.Errorf("%s API key is blank", name)
+		}
+	case AuthNone:
+	default:
+		return nil, fmt.Errorf("%s auth type %q is unknown", name, d.Auth.Type)
+	}
+
+	target, err := url.Parse(d.URL)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("%s URL %q is not absolute", name, d.URL)
+	}
+	if c.BaseURL != "" {
+		base, err := url.Parse(c.BaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("url.Parse(%q): %v", c.BaseURL, err)
+		}
+		target.Scheme, target.Host = base.Scheme, base.Host
+	}
+
+	if strings.TrimSpace(d.Body) == "" {
+		return nil, fmt.Errorf("%s body template is blank", name)
+	}
+	body, err := texttemplate.New(name).Funcs(funcs).Option("missingkey=error").Parse(d.Body)
+	if err != nil {
+		return nil, fmt.Errorf("template.Parse(): %v", err)
+	}
+
+	e := &EmailClient{
+		name:           name,
+		key:            c.Key,
+		secret:         c.Secret,
+		target:         target.String(),
+		desc:           d,
+		body:           body,
+		markdownLayout: c.MarkdownLayout,
+		client:         c.Client,
+	}
+	return e, nil
+}
+
+// Capabilities returns what the described API can honour of an email
+func (c *EmailClient) Capabilities() emailer.Capabilities {
+	return c.desc.Capabilities
+}
+
+// funcs are the functions of body templates
+var funcs = texttemplate.FuncMap{
+	// json encodes v as JSON, strings are quoted and escaped
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// base64 encodes bytes or a string as standard base64
+	"base64": func(v any) (string, error) {
+		switch v := v.(type) {
+		case []byte:
+			return base64.StdEncoding.EncodeToString(v), nil
+		case string:
+			return base64.StdEncoding.EncodeToString([]byte(v)), nil
+		}
+		return "", fmt.Errorf("base64 of %T", v)
+	},
+	"join": strings.Join,
+}
+
+// Send sends a given email
+func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
+	_, err := c.SendMessage(ctx, email)
+	return err
+}
+
+// SendMessage sends a given email and returns its message ID when the description says where it is
+func (c *EmailClient) SendMessage(ctx context.Context, email emailer.Email) (string, error) {
+	if err := c.Capabilities().Check(email); err != nil {
+		return "", err
+	}
+	email, err := email.RenderMarkdown(c.markdownLayout)
+	if err != nil {
+		return "", fmt.Errorf("email.RenderMarkdown(): %v", err)
+	}
+
+	var body bytes.Buffer
+	if err := c.body.Execute(&body, Data{Email: email, Key: c.key}); err != nil {
+		return "", fmt.Errorf("template.Execute(): %v", err)
+	}
+	if strings.Contains(c.desc.ContentType, "json") && !json.Valid(body.Bytes()) {
+		// the body is not printed since it may carry the key
+		return "", fmt.Errorf("%s body template rendered invalid JSON", c.name)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, c.desc.Method, c.target, &body)
+	if err != nil {
+		return "", fmt.Errorf("http.NewRequestWithContext(): %v", err)
+	}
+	req.Header.Add("accept", "application/json")
+	req.Header.Add("content-type", c.desc.ContentType)
+	for k, v := range c.desc.Headers {
+		req.Header.Set(k, v)
+	}
+	switch c.desc.Auth.Type {
+	case AuthHeader:
+		req.Header.Set(c.desc.Auth.Header, c.desc.Auth.Prefix+c.key)
+	case AuthBasic:
+		req.SetBasicAuth(c.key, c.secret)
+	}
+
+	resp, err := emailer.Do(&c.client, req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("io.ReadAll(): %v", err)
+	}
+	if !c.successful(resp.StatusCode) {
+		return "", emailer.NewStatusError(resp.StatusCode, respBody, func(body []byte) (any, bool) {
+			return lookup(body, c.desc.Response.Error)
+		})
+	}
+
+	if name, ok := strings.CutPrefix(c.desc.Response.MessageID, headerPrefix); ok {
+		return resp.Header.Get(name), nil
+	}
+	id, _ := lookup(respBody, c.desc.Response.MessageID)
+	return id, nil
+}
+
+// successful reports whether code is a successful status code of the description
+func (c *EmailClient) successful(code int) bool {
+	if len(c.desc.Response.Success) == 0 {
+		return code >= 200 && code < 300
+	}
+	return slices.Contains(c.desc.Response.Success, code)
+}
+
+// lookup returns the value at the dotted path of a JSON body as a string, objects and arrays are returned as JSON
+func lookup(body []byte, path string) (string, bool) {
+	if path == "" {
+		return "", false
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return "", false
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			child, ok := node[key]
+			if !ok {
+				return "", false
+			}
+			v = child
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", false
+			}
+			v = node[i]
+		default:
+			return "", false
+		}
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case map[string]any, []any:
+		b, _ := json.Marshal(v)
+		return string(b), true
+	}
+	return fmt.Sprint(v), true
+}
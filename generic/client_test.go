@@ -0,0 +1,274 @@
+package generic
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+	"github.com/mrwormhole/emailer/emailtest"
+)
+
+func TestParse(t *testing.T) {
+	want := Description{
+		Name:     "gateway",
+		URL:      "https://mail.internal/send",
+		Auth:     Auth{Type: AuthBasic},
+		Body:     `{"to": {{json .To}}}`,
+		Response: Response{Success: []int{202}, MessageID: "header:X-Id"},
+	}
+
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{
+			name: "JSON",
+			doc: `{"name": "gateway", "url": "https://mail.internal/send", "auth": {"type": "basic"},
+				"body": "{\"to\": {{json .To}}}", "response": {"success": [202], "messageId": "header:X-Id"}}`,
+		},
+		{
+			name: "YAML",
+			doc: "name: gateway\nurl: https://mail.internal/send\nauth:\n  type: basic\n" +
+				"body: '{\"to\": {{json .To}}}'\nresponse:\n  success: [202]\n  messageId: header:X-Id\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.doc))
+			if err != nil {
+				t.Fatalf("Parse(): %v", err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Parse(): diff=\n %v", diff)
+			}
+		})
+	}
+
+	if _, err := Parse([]byte("name: gateway\nendpoint: https://mail.internal/send\n")); err == nil {
+		t.Error("Parse(): got=nil want=error for unknown field")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	d, err := Load("testdata/zeptomail.yaml")
+	if err != nil {
+		t.Fatalf("Load(): %v", err)
+	}
+	if diff := cmp.Diff(Response{Success: []int{200, 201}, MessageID: "request_id", Error: "error.details.0.message"}, d.Response); diff != "" {
+		t.Errorf("Load(): response diff=\n %v", diff)
+	}
+	if diff := cmp.Diff(emailer.Capabilities{MaxRecipients: 500, MaxAttachmentSize: 15 << 20}, d.Capabilities); diff != "" {
+		t.Errorf("Load(): capabilities diff=\n %v", diff)
+	}
+	if _, err := Load("testdata/missing.yaml"); err == nil {
+		t.Error("Load(): got=nil want=error for missing file")
+	}
+}
+
+func TestNew(t *testing.T) {
+	valid := Description{URL: "https://mail.internal/send", Body: "{}"}
+
+	tests := []struct {
+		name string
+		c    emailer.Config
+		d    func(d Description) Description
+		want string
+	}{
+		{
+			name: "blank key",
+			d:    func(d Description) Description { d.Name = "gateway"; return d },
+			want: "gateway API key is blank",
+		},
+		{
+			name: "unknown auth type",
+			c:    emailer.Config{Key: "key"},
+			d:    func(d Description) Description { d.Auth.Type = "oauth2"; return d },
+			want: `generic auth type "oauth2" is unknown`,
+		},
+		{
+			name: "relative URL",
+			c:    emailer.Config{Key: "key"},
+			d:    func(d Description) Description { d.URL = "/send"; return d },
+			want: `generic URL "/send" is not absolute`,
+		},
+		{
+			name: "blank body",
+			d:    func(d Description) Description { d.Auth.Type, d.Body = AuthNone, " "; return d },
+			want: "generic body template is blank",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.c, tt.d(valid))
+			if err == nil || !cmp.Equal(tt.want, err.Error()) {
+				t.Errorf("New(): got=%v want=%q", err, tt.want)
+			}
+		})
+	}
+}
+
+// recipientPaths are the paths of the request body that hold each recipient
+var recipientPaths = map[string][]string{
+	"to":  {"to.email_address.address"},
+	"cc":  {"cc.email_address.address"},
+	"bcc": {"bcc.email_address.address"},
+}
+
+// errorBody is how the described provider rejects a request
+const errorBody = `{"error":{"code":"TM_3201","details":[{"message":"conformance failure"}]}}`
+
+func TestConformance(t *testing.T) {
+	d, err := Load("testdata/zeptomail.yaml")
+	if err != nil {
+		t.Fatalf("Load(): %v", err)
+	}
+	emailtest.RunSenderConformance(t, func(c emailer.Config) (emailer.Sender, error) {
+		return New(c, d)
+	}, emailtest.Provider{Recipients: recipientPaths, ErrorBody: errorBody})
+}
+
+func TestSendMessage(t *testing.T) {
+	email := emailer.Email{From: "a@a.com", To: []string{"b@b.com"}, Subject: "sub", TextContent: "text"}
+	base := Description{URL: "https://mail.internal/send", Body: `{"to": {{json .To}}, "key": {{json .Key}}}`}
+
+	tests := []struct {
+		name     string
+		d        func(d Description) Description
+		code     int
+		header   http.Header
+		body     string
+		wantID   string
+		wantCode int
+		wantErr  string
+	}{
+		{
+			name:   "message ID from JSON body",
+			d:      func(d Description) Description { d.Response.MessageID = "data.0.id"; return d },
+			code:   http.StatusCreated,
+			body:   `{"data": [{"id": 42}]}`,
+			wantID: "42",
+		},
+		{
+			name:   "message ID from header",
+			d:      func(d Description) Description { d.Response.MessageID = "header:X-Message-Id"; return d },
+			code:   http.StatusAccepted,
+			header: http.Header{"X-Message-Id": {"<id@mail.internal>"}},
+			wantID: "<id@mail.internal>",
+		},
+		{
+			name:     "status code is not listed as success",
+			d:        func(d Description) Description { d.Response.Success = []int{http.StatusAccepted}; return d },
+			code:     http.StatusOK,
+			body:     `{"queued": false}`,
+			wantCode: http.StatusOK,
+			wantErr:  `{"queued": false}`,
+		},
+		{
+			name:     "error message from JSON body",
+			d:        func(d Description) Description { d.Response.Error = "error.details.0.message"; return d },
+			code:     http.StatusBadRequest,
+			body:     `{"error": {"details": [{"message": "from is blank"}]}}`,
+			wantCode: http.StatusBadRequest,
+			wantErr:  "from is blank",
+		},
+		{
+			name:     "error message is missing",
+			d:        func(d Description) Description { d.Response.Error = "error.message"; return d },
+			code:     http.StatusBadGateway,
+			body:     "bad gateway",
+			wantCode: http.StatusBadGateway,
+			wantErr:  "bad gateway",
+		},
+		{
+			name:    "rendered body is not JSON",
+			d:       func(d Description) Description { d.Body = `{"to": {{.To}}}`; return d },
+			wantErr: "generic body template rendered invalid JSON",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req *http.Request
+			var reqBody string
+			tripper := func(r *http.Request) *http.Response {
+				req = r
+				b, _ := io.ReadAll(r.Body)
+				reqBody = string(b)
+				return &http.Response{StatusCode: tt.code, Header: tt.header, Body: io.NopCloser(strings.NewReader(tt.body))}
+			}
+			client, err := New(emailtest.NewConfig(tripper), tt.d(base))
+			if err != nil {
+				t.Fatalf("New(): %v", err)
+			}
+
+			id, err := client.SendMessage(context.Background(), email)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("SendMessage(): got=%v want=%q", err, tt.wantErr)
+				}
+				var statusErr *emailer.StatusError
+				if tt.wantCode != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantCode) {
+					t.Errorf("SendMessage(): error %q is not a status error of %d", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SendMessage(): %v", err)
+			}
+			if diff := cmp.Diff(tt.wantID, id); diff != "" {
+				t.Errorf("SendMessage(): id diff=\n %v", diff)
+			}
+			if diff := cmp.Diff("key", req.Header.Get("Authorization")); diff != "" {
+				t.Errorf("SendMessage(): Authorization diff=\n %v", diff)
+			}
+			if diff := cmp.Diff(`{"to": ["b@b.com"], "key": "key"}`, reqBody); diff != "" {
+				t.Errorf("SendMessage(): body diff=\n %v", diff)
+			}
+		})
+	}
+}
+
+func TestSendMessage_Auth(t *testing.T) {
+	tests := []struct {
+		name string
+		auth Auth
+		want http.Header
+	}{
+		{name: "header with prefix", auth: Auth{Header: "X-Api-Key", Prefix: "Token "}, want: http.Header{"X-Api-Key": {"Token key"}}},
+		{name: "basic", auth: Auth{Type: AuthBasic}, want: http.Header{"Authorization": {"Basic a2V5OnNlY3JldA=="}}},
+		{name: "none", auth: Auth{Type: AuthNone}, want: http.Header{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := http.Header{}
+			tripper := func(r *http.Request) *http.Response {
+				for _, k := range []string{"Authorization", "X-Api-Key"} {
+					if v := r.Header.Get(k); v != "" {
+						got.Set(k, v)
+					}
+				}
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}
+			}
+			d := Description{URL: "https://mail.internal/send", Body: "{}", Auth: tt.auth}
+			client, err := New(emailtest.NewConfig(tripper), d)
+			if err != nil {
+				t.Fatalf("New(): %v", err)
+			}
+			if err := client.Send(context.Background(), emailer.Email{}); err != nil {
+				t.Fatalf("Send(): %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Send(): headers diff=\n %v", diff)
+			}
+		})
+	}
+}
@@ -3,8 +3,15 @@ module github.com/mrwormhole/emailer
 go 1.26
 
 require (
+	github.com/andybalholm/cascadia v1.3.3
 	github.com/google/go-cmp v0.7.0
 	github.com/hashicorp/go-retryablehttp v0.7.8
+	github.com/yuin/goldmark v1.8.2
+	go.yaml.in/yaml/v3 v3.0.4
+	golang.org/x/net v0.57.0
 )
 
-require github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
+require (
+	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
+	golang.org/x/text v0.40.0 // indirect
+)
@@ -0,0 +1,547 @@
+// Package jmap makes it easy to send emails via JMAP servers such as Fastmail. This package follows [jmap spec] strictly.
+// Config needs Key as API token, BaseURL is where the session is discovered from and it is Fastmail unless set.
+//
+// The session, the drafts and sent mailboxes and the identities of the account are discovered with the first email,
+// then every email is created as a draft and submitted within a single API request. Sent emails are moved from drafts to sent,
+// drafts that are not submitted are destroyed.
+//
+// Example usage:
+//
+//	 email := emailer.Email{
+//		From:        "skywalker@jedi.com",
+//		To:          []string{"vindu@sith.com"},
+//		Subject:     "peace",
+//		TextContent: "peace was never an option",
+//	 }
+//	 c, err := New(emailer.Config{Key: "api-token"})
+//		if err != nil {
+//			//check err
+//		}
+//	 c.Send(ctx, email)
+//
+// [jmap spec]: https://www.rfc-editor.org/rfc/rfc8621
+package jmap
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mrwormhole/emailer"
+)
+
+const (
+	baseURL     = "https://api.fastmail.com"
+	sessionPath = "/.well-known/jmap"
+
+	capabilityCore       = "urn:ietf:params:jmap:core"
+	capabilityMail       = "urn:ietf:params:jmap:mail"
+	capabilitySubmission = "urn:ietf:params:jmap:submission"
+
+	// creation IDs of the draft and its submission, the submission refers to the draft with "#draft"
+	draftID      = "draft"
+	submissionID = "send"
+)
+
+// Capabilities describes what JMAP can honour of an email
+var Capabilities = emailer.Capabilities{
+	// JMAP servers announce their own limits, which are checked by the server when the email is sent
+	InlineAttachments: true,
+}
+
+// EmailClient is JMAP email client to interact with emails
+type EmailClient struct {
+	key            string
+	baseURL        string
+	markdownLayout *template.Template
+	client         http.Client
+
+	mu      sync.Mutex
+	account *account
+}
+
+// account is what is discovered about the JMAP account that sends emails
+type account struct {
+	apiURL     string
+	uploadURL  string
+	id         string
+	drafts     string
+	sent       string
+	identities []identity
+}
+
+// New creates a new JMAP email client with given API token and http.Client
+func New(c emailer.Config) (*EmailClient, error) {
+	if strings.TrimSpace(c.Key) == "" {
+		return nil, errors.New("jmap API token is blank")
+	}
+	e := &EmailClient{
+		key:            c.Key,
+		baseURL:        cmp.Or(strings.TrimSuffix(c.BaseURL, "/"), baseURL),
+		markdownLayout: c.MarkdownLayout,
+		client:         c.Client,
+	}
+	return e, nil
+}
+
+func init() {
+	emailer.Register("jmap", emailer.FactoryOf(New))
+}
+
+// Capabilities returns what JMAP can honour of an email
+func (c *EmailClient) Capabilities() emailer.Capabilities {
+	return Capabilities
+}
+
+// session is the JMAP session resource
+type session struct {
+	APIURL          string            `json:"apiUrl"`
+	UploadURL       string            `json:"uploadUrl"`
+	PrimaryAccounts map[string]string `json:"primaryAccounts"`
+}
+
+// request is a JMAP API request, every method call is a name, arguments and call ID triple
+type request struct {
+	Using       []string `json:"using"`
+	MethodCalls [][3]any `json:"methodCalls"`
+}
+
+// response is a JMAP API response, its method responses are in the order of method calls
+type response struct {
+	MethodResponses []methodResponse `json:"methodResponses"`
+}
+
+// methodResponse is a name, arguments and call ID triple, the name is "error" when the method failed
+type methodResponse struct {
+	Name   string
+	Args   json.RawMessage
+	CallID string
+}
+
+func (m *methodResponse) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 3 {
+		return fmt.Errorf("method response has %d elements, want 3", len(raw))
+	}
+	if err := json.Unmarshal(raw[0], &m.Name); err != nil {
+		return err
+	}
+	m.Args = raw[1]
+	return json.Unmarshal(raw[2], &m.CallID)
+}
+
+type mailbox struct {
+	ID   string `json:"id"`
+	Role string `json:"role"`
+}
+
+// identity is an address the account may send from, its email is either an address or "*@domain" for the whole domain
+type identity struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+}
+
+type emailAddress struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email"`
+}
+
+// draft is an email that is created in drafts mailbox. Bcc is not set, those recipients are only in the envelope
+type draft struct {
+	MailboxIDs  map[string]bool      `json:"mailboxIds"`
+	Keywords    map[string]bool      `json:"keywords"`
+	From        []emailAddress       `json:"from"`
+	To          []emailAddress       `json:"to,omitempty"`
+	CC          []emailAddress       `json:"cc,omitempty"`
+	Subject     string               `json:"subject"`
+	BodyValues  map[string]bodyValue `json:"bodyValues"`
+	TextBody    []bodyPart           `json:"textBody,omitempty"`
+	HTMLBody    []bodyPart           `json:"htmlBody,omitempty"`
+	Attachments []bodyPart           `json:"attachments,omitempty"`
+}
+
+type bodyValue struct {
+	Value string `json:"value"`
+}
+
+// bodyPart is either a text part of bodyValues or an uploaded blob
+type bodyPart struct {
+	PartID      string `json:"partId,omitempty"`
+	BlobID      string `json:"blobId,omitempty"`
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Disposition string `json:"disposition,omitempty"`
+	CID         string `json:"cid,omitempty"`
+}
+
+type submission struct {
+	IdentityID string   `json:"identityId"`
+	EmailID    string   `json:"emailId"`
+	Envelope   envelope `json:"envelope"`
+}
+
+type envelope struct {
+	MailFrom emailAddress   `json:"mailFrom"`
+	RcptTo   []emailAddress `json:"rcptTo"`
+}
+
+// setResponse is the response of a /set method, only creations are used
+type setResponse struct {
+	Created    map[string]struct{ ID string } `json:"created"`
+	NotCreated map[string]setError            `json:"notCreated"`
+}
+
+// setError is the reason of a method failure or of a record that is not created
+type setError struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Properties  []string `json:"properties"`
+}
+
+// problem is the problem details of a JMAP request that is rejected as a whole
+type problem struct {
+	Type   string `json:"type"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// MethodError is a method call that the JMAP server rejected, such as an email that is not created or not submitted
+type MethodError struct {
+	Method      string
+	Type        string
+	Description string
+	Properties  []string
+}
+
+func (e *MethodError) Error() string {
+	msg := fmt.Sprintf("jmap %s: %s", e.Method, e.Type)
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	if len(e.Properties) > 0 {
+		msg += fmt.Sprintf(" %v", e.Properties)
+	}
+	return msg
+}
+
+// Send sends a given email
+func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
+	_, err := c.SendMessage(ctx, email)
+	return err
+}
+
+// SendMessage sends a given email and returns the ID of its JMAP email submission
+func (c *EmailClient) SendMessage(ctx context.Context, email emailer.Email) (string, error) {
+	if err := c.Capabilities().Check(email); err != nil {
+		return "", err
+	}
+	email, err := email.RenderMarkdown(c.markdownLayout)
+	if err != nil {
+		return "", fmt.Errorf("email.RenderMarkdown(): %v", err)
+	}
+	acc, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	from := parseAddress(email.From)
+	id, ok := identityFor(acc.identities, from.Email)
+	if !ok {
+		return "", fmt.Errorf("jmap account has no identity for %q", from.Email)
+	}
+
+	d := draft{
+		MailboxIDs: map[string]bool{acc.drafts: true},
+		Keywords:   map[string]bool{"$draft": true, "$seen": true},
+		From:       []emailAddress{from},
+		Subject:    email.Subject,
+		BodyValues: make(map[string]bodyValue),
+	}
+	env := envelope{MailFrom: emailAddress{Email: from.Email}}
+	for _, e := range email.To {
+		a := parseAddress(e)
+		d.To = append(d.To, a)
+		env.RcptTo = append(env.RcptTo, emailAddress{Email: a.Email})
+	}
+	for _, e := range email.CC {
+		a := parseAddress(e)
+		d.CC = append(d.CC, a)
+		env.RcptTo = append(env.RcptTo, emailAddress{Email: a.Email})
+	}
+	for _, e := range email.BCC {
+		env.RcptTo = append(env.RcptTo, emailAddress{Email: parseAddress(e).Email})
+	}
+	if email.TextContent != "" {
+		d.BodyValues["text"] = bodyValue{Value: email.TextContent}
+		d.TextBody = []bodyPart{{PartID: "text", Type: "text/plain"}}
+	}
+	if email.HTMLContent != "" {
+		d.BodyValues["html"] = bodyValue{Value: email.HTMLContent}
+		d.HTMLBody = []bodyPart{{PartID: "html", Type: "text/html"}}
+	}
+	for _, a := range email.Attachments {
+		part := bodyPart{Type: cmp.Or(a.ContentType, "application/octet-stream"), Name: a.Filename, Disposition: "attachment", CID: a.ContentID}
+		if a.ContentID != "" {
+			part.Disposition = "inline"
+		}
+		part.BlobID, err = c.upload(ctx, acc, part.Type, a.Data)
+		if err != nil {
+			return "", err
+		}
+		d.Attachments = append(d.Attachments, part)
+	}
+
+	onSuccess := map[string]any{
+		"accountId": acc.id,
+		"create":    map[string]submission{submissionID: {IdentityID: id, EmailID: "#" + draftID, Envelope: env}},
+	}
+	if acc.sent != "" {
+		onSuccess["onSuccessUpdateEmail"] = map[string]any{"#" + submissionID: map[string]any{
+			"mailboxIds/" + acc.drafts: nil,
+			"mailboxIds/" + acc.sent:   true,
+			"keywords/$draft":          nil,
+		}}
+	} else {
+		// accounts without sent mailbox keep nothing, like most providers
+		onSuccess["onSuccessDestroyEmail"] = []string{"#" + submissionID}
+	}
+	req := request{
+		Using: []string{capabilityCore, capabilityMail, capabilitySubmission},
+		MethodCalls: [][3]any{
+			{"Email/set", map[string]any{"accountId": acc.id, "create": map[string]draft{draftID: d}}, "0"},
+			{"EmailSubmission/set", onSuccess, "1"},
+		},
+	}
+	resp, err := c.call(ctx, acc.apiURL, req)
+	if err != nil {
+		return "", err
+	}
+
+	draftResp, err := created(resp, "Email/set", draftID, "0")
+	if err != nil {
+		return "", err
+	}
+	submissionResp, err := created(resp, "EmailSubmission/set", submissionID, "1")
+	if err != nil {
+		// the draft is left behind by a submission that is not created, so it is destroyed not to pile up in drafts mailbox
+		return "", errors.Join(err, c.destroy(ctx, acc, draftResp.Created[draftID].ID))
+	}
+	return submissionResp.Created[submissionID].ID, nil
+}
+
+// created decodes the /set response of method to the call with callID, a record of creationID that is not created is a MethodError
+func created(resp response, method, creationID, callID string) (setResponse, error) {
+	var r setResponse
+	if err := resp.args(method, callID, &r); err != nil {
+		return setResponse{}, err
+	}
+	if e, ok := r.NotCreated[creationID]; ok {
+		return setResponse{}, &MethodError{Method: method, Type: e.Type, Description: e.Description, Properties: e.Properties}
+	}
+	return r, nil
+}
+
+// destroy destroys the email of given ID such as a draft that is not submitted
+func (c *EmailClient) destroy(ctx context.Context, acc *account, id string) error {
+	req := request{
+		Using:       []string{capabilityCore, capabilityMail},
+		MethodCalls: [][3]any{{"Email/set", map[string]any{"accountId": acc.id, "destroy": []string{id}}, "0"}},
+	}
+	resp, err := c.call(ctx, acc.apiURL, req)
+	if err != nil {
+		return err
+	}
+	var r struct {
+		NotDestroyed map[string]setError `json:"notDestroyed"`
+	}
+	if err := resp.args("Email/set", "0", &r); err != nil {
+		return err
+	}
+	if e, ok := r.NotDestroyed[id]; ok {
+		return &MethodError{Method: "Email/set", Type: e.Type, Description: e.Description, Properties: e.Properties}
+	}
+	return nil
+}
+
+// discover finds the account, its mailboxes and identities once, a failed discovery is tried again with the next email
+func (c *EmailClient) discover(ctx context.Context) (*account, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.account != nil {
+		return c.account, nil
+	}
+
+	var s session
+	if err := c.do(ctx, http.MethodGet, c.baseURL+sessionPath, "", nil, &s); err != nil {
+		return nil, err
+	}
+	acc := &account{apiURL: s.APIURL, uploadURL: s.UploadURL, id: cmp.Or(s.PrimaryAccounts[capabilitySubmission], s.PrimaryAccounts[capabilityMail])}
+	if acc.id == "" || acc.apiURL == "" {
+		return nil, errors.New("jmap session has no account to submit emails")
+	}
+
+	req := request{
+		Using: []string{capabilityCore, capabilityMail, capabilitySubmission},
+		MethodCalls: [][3]any{
+			{"Mailbox/get", map[string]any{"accountId": acc.id, "ids": nil, "properties": []string{"id", "role"}}, "0"},
+			{"Identity/get", map[string]any{"accountId": acc.id, "ids": nil}, "1"},
+		},
+	}
+	resp, err := c.call(ctx, acc.apiURL, req)
+	if err != nil {
+		return nil, err
+	}
+	var mailboxes struct{ List []mailbox }
+	if err := resp.args("Mailbox/get", "0", &mailboxes); err != nil {
+		return nil, err
+	}
+	for _, m := range mailboxes.List {
+		switch m.Role {
+		case "drafts":
+			acc.drafts = m.ID
+		case "sent":
+			acc.sent = m.ID
+		}
+	}
+	if acc.drafts == "" {
+		return nil, errors.New("jmap account has no drafts mailbox")
+	}
+	var identities struct{ List []identity }
+	if err := resp.args("Identity/get", "1", &identities); err != nil {
+		return nil, err
+	}
+	acc.identities = identities.List
+
+	c.account = acc
+	return acc, nil
+}
+
+// upload uploads data as a blob of the account and returns its blob ID
+func (c *EmailClient) upload(ctx context.Context, acc *account, contentType string, data []byte) (string, error) {
+	if acc.uploadURL == "" {
+		return "", errors.New("jmap session has no upload URL for attachments")
+	}
+	var r struct {
+		BlobID string `json:"blobId"`
+	}
+	target := strings.ReplaceAll(acc.uploadURL, "{accountId}", acc.id)
+	if err := c.do(ctx, http.MethodPost, target, contentType, data, &r); err != nil {
+		return "", err
+	}
+	return r.BlobID, nil
+}
+
+// call sends a JMAP API request to given API URL
+func (c *EmailClient) call(ctx context.Context, apiURL string, req request) (response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return response{}, fmt.Errorf("json.Marshal(%v): %v", req, err)
+	}
+	var resp response
+	if err := c.do(ctx, http.MethodPost, apiURL, "application/json", body, &resp); err != nil {
+		return response{}, err
+	}
+	return resp, nil
+}
+
+// args decodes the arguments of the response of method to the call with callID into out, a failed call is a MethodError.
+// Responses are matched by name too, since implicit calls such as Email/set after a submission share its call ID
+func (r response) args(method, callID string, out any) error {
+	i := slices.IndexFunc(r.MethodResponses, func(m methodResponse) bool {
+		return m.CallID == callID && (m.Name == method || m.Name == "error")
+	})
+	if i < 0 {
+		return fmt.Errorf("jmap %s: no response", method)
+	}
+	m := r.MethodResponses[i]
+	if m.Name == "error" {
+		var e setError
+		if err := json.Unmarshal(m.Args, &e); err != nil {
+			return fmt.Errorf("json.Unmarshal(): %v", err)
+		}
+		return &MethodError{Method: method, Type: e.Type, Description: e.Description}
+	}
+	if err := json.Unmarshal(m.Args, out); err != nil {
+		return fmt.Errorf("json.Unmarshal(): %v", err)
+	}
+	return nil
+}
+
+// do sends body with given content type to target, then decodes a successful JSON response into out
+func (c *EmailClient) do(ctx context.Context, method, target, contentType string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("http.NewRequestWithContext(): %v", err)
+	}
+	req.Header.Add("authorization", "Bearer "+c.key)
+	req.Header.Add("accept", "application/json")
+	if contentType != "" {
+		req.Header.Add("content-type", contentType)
+	}
+
+	resp, err := emailer.Do(&c.client, req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("json.NewDecoder().Decode(): %v", err)
+		}
+		return nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("io.ReadAll(): %v", err)
+	}
+	return emailer.NewStatusError(resp.StatusCode, respBody, func(body []byte) (any, bool) {
+		var p problem
+		err := json.Unmarshal(body, &p)
+		return p, err == nil && strings.HasPrefix(p.Type, "urn:ietf:params:jmap:error:")
+	})
+}
+
+// identityFor returns the ID of the identity that may send from addr, exact addresses are preferred over domain wildcards
+func identityFor(identities []identity, addr string) (string, bool) {
+	for _, i := range identities {
+		if strings.EqualFold(i.Email, addr) {
+			return i.ID, true
+		}
+	}
+	_, domain, ok := strings.Cut(addr, "@")
+	if !ok {
+		return "", false
+	}
+	for _, i := range identities {
+		if strings.EqualFold(i.Email, "*@"+domain) {
+			return i.ID, true
+		}
+	}
+	return "", false
+}
+
+// parseAddress splits an address such as "Luke <luke@jedi.com>" into name and email, invalid ones are kept as email
+func parseAddress(s string) emailAddress {
+	a, err := mail.ParseAddress(s)
+	if err != nil {
+		return emailAddress{Email: s}
+	}
+	return emailAddress{Name: a.Name, Email: a.Address}
+}
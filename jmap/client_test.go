@@ -0,0 +1,207 @@
+package jmap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+	"github.com/mrwormhole/emailer/emailtest"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// jsonResponse returns a successful response with given JSON body
+func jsonResponse(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+// conformanceSender answers session discovery itself, so the conformance endpoint only gets the request that sends.
+// The JMAP fake only sends from its own identity, so the empty JSON answer of the conformance endpoint
+// is turned into the method responses of a sent email
+func conformanceSender(c emailer.Config) (emailer.Sender, error) {
+	next := c.Client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	c.Client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case req.URL.Path == sessionPath:
+			apiURL := req.URL.Scheme + "://" + req.URL.Host + "/jmap/api/"
+			return jsonResponse(`{"apiUrl":"` + apiURL + `","primaryAccounts":{"` + capabilitySubmission + `":"A1"}}`), nil
+		case bytes.Contains(body, []byte("Mailbox/get")):
+			return jsonResponse(`{"methodResponses":[["Mailbox/get",{"list":[{"id":"D1","role":"drafts"}]},"0"],` +
+				`["Identity/get",{"list":[{"id":"I1","email":"*@conformance.test"}]},"1"]]}`), nil
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		resp, err := next.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			return resp, err
+		}
+		_ = resp.Body.Close()
+		return jsonResponse(`{"methodResponses":[["Email/set",{"created":{"draft":{"id":"M1"}}},"0"],` +
+			`["EmailSubmission/set",{"created":{"send":{"id":"S1"}}},"1"]]}`), nil
+	})
+	return New(c)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(emailer.Config{Key: " "})
+	if want := "jmap API token is blank"; err == nil || !cmp.Equal(want, err.Error()) {
+		t.Errorf("New(): got=%v want=%q", err, want)
+	}
+}
+
+func TestIdentityFor(t *testing.T) {
+	identities := []identity{{ID: "wildcard", Email: "*@jedi.com"}, {ID: "luke", Email: "Luke@jedi.com"}}
+
+	tests := []struct {
+		name   string
+		addr   string
+		want   string
+		wantOK bool
+	}{
+		{name: "exact address before wildcard", addr: "luke@jedi.com", want: "luke", wantOK: true},
+		{name: "wildcard", addr: "leia@jedi.com", want: "wildcard", wantOK: true},
+		{name: "other domain", addr: "vader@sith.com"},
+		{name: "no domain", addr: "yoda"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := identityFor(identities, tt.addr)
+			if diff := cmp.Diff(tt.want, got); diff != "" || ok != tt.wantOK {
+				t.Errorf("identityFor(): ok=%v diff=\n %v", ok, diff)
+			}
+		})
+	}
+}
+
+// recipientPaths are the paths of the request body that hold each recipient, bcc is only in the envelope
+var recipientPaths = map[string][]string{
+	"to":  {"methodcalls.create.draft.to.email", "methodcalls.create.send.envelope.rcptto.email"},
+	"cc":  {"methodcalls.create.draft.cc.email", "methodcalls.create.send.envelope.rcptto.email"},
+	"bcc": {"methodcalls.create.send.envelope.rcptto.email"},
+}
+
+// errorBody is how JMAP servers reject a request
+const errorBody = `{"type":"urn:ietf:params:jmap:error:notRequest","status":400,"detail":"conformance failure"}`
+
+func TestConformance(t *testing.T) {
+	emailtest.RunSenderConformance(t, conformanceSender, emailtest.Provider{Recipients: recipientPaths, ErrorBody: errorBody})
+}
+
+func TestFakeServer(t *testing.T) {
+	srv := emailtest.NewJMAPServer(t)
+	client, err := New(srv.Config())
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+
+	email := emailer.Email{
+		From:        "Me <" + emailtest.JMAPIdentity + ">",
+		To:          []string{"b@b.com"},
+		BCC:         []string{"bcc@bcc.com"},
+		Subject:     "sub",
+		HTMLContent: "<img src=\"cid:logo\">",
+		Attachments: []emailer.Attachment{{Filename: "logo.png", ContentType: "image/png", ContentID: "logo", Data: []byte("png")}},
+	}
+	id, err := client.SendMessage(context.Background(), email)
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	if id == "" {
+		t.Error("SendMessage(): submission ID is empty")
+	}
+
+	var got request
+	if err := json.Unmarshal(srv.LastRequest().Body, &got); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
+	}
+	if len(got.MethodCalls) != 2 {
+		t.Fatalf("SendMessage(): method calls=%v want Email/set and EmailSubmission/set", got.MethodCalls)
+	}
+	created := got.MethodCalls[0][1].(map[string]any)["create"].(map[string]any)[draftID].(map[string]any)
+	if _, ok := created["bcc"]; ok {
+		t.Error("SendMessage(): draft reveals bcc recipients")
+	}
+	if diff := cmp.Diff([]any{map[string]any{"name": "Me", "email": emailtest.JMAPIdentity}}, created["from"]); diff != "" {
+		t.Errorf("SendMessage(): from diff=\n %v", diff)
+	}
+	attachment := created["attachments"].([]any)[0].(map[string]any)
+	if diff := cmp.Diff("inline", attachment["disposition"]); diff != "" {
+		t.Errorf("SendMessage(): attachment disposition diff=\n %v", diff)
+	}
+	rcptTo := got.MethodCalls[1][1].(map[string]any)["create"].(map[string]any)[submissionID].(map[string]any)["envelope"].(map[string]any)["rcptTo"]
+	want := []any{map[string]any{"email": "b@b.com"}, map[string]any{"email": "bcc@bcc.com"}}
+	if diff := cmp.Diff(want, rcptTo); diff != "" {
+		t.Errorf("SendMessage(): envelope recipients diff=\n %v", diff)
+	}
+
+	// the account is discovered once, then every email is an API request
+	requests := len(srv.Requests())
+	email.Attachments = nil
+	email.To = []string{"b@" + emailtest.JMAPRejected}
+	// the draft of a rejected submission is destroyed, the fake does not destroy unknown emails so the error would be joined
+	err = client.Send(context.Background(), email)
+	var methodErr *MethodError
+	if !errors.As(err, &methodErr) || methodErr.Type != "invalidRecipients" {
+		t.Errorf("Send(): got=%v want=invalidRecipients method error", err)
+	}
+	if diff := cmp.Diff("jmap EmailSubmission/set: invalidRecipients: recipients are rejected", fmt.Sprint(err)); diff != "" {
+		t.Errorf("Send(): error diff=\n %v", diff)
+	}
+	if diff := cmp.Diff(requests+2, len(srv.Requests())); diff != "" {
+		t.Errorf("Send(): requests diff=\n %v", diff)
+	}
+	var destroy request
+	if err := json.Unmarshal(srv.LastRequest().Body, &destroy); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
+	}
+	if len(destroy.MethodCalls) != 1 || destroy.MethodCalls[0][0] != "Email/set" {
+		t.Fatalf("Send(): method calls=%v want Email/set", destroy.MethodCalls)
+	}
+	if ids, _ := destroy.MethodCalls[0][1].(map[string]any)["destroy"].([]any); len(ids) != 1 {
+		t.Errorf("Send(): destroyed=%v want the draft", ids)
+	}
+
+	email.From = "other@jmap.test"
+	if err := client.Send(context.Background(), email); err == nil || !strings.Contains(err.Error(), "no identity") {
+		t.Errorf("Send(): got=%v want=no identity error", err)
+	}
+
+	cfg := srv.Config()
+	cfg.Key = "wrong-key"
+	client, err = New(cfg)
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	var statusErr *emailer.StatusError
+	if err := client.Send(context.Background(), email); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Send(): got=%v want=status code(401)", err)
+	}
+}
@@ -0,0 +1,240 @@
+// Package mailersend makes it easy to send emails via mailersend provider. This package follows [mailersend spec] strictly.
+//
+// Example usage:
+//
+//	 email := emailer.Email{
+//		From:        "skywalker@jedi.com",
+//		To:          []string{"vindu@sith.com"},
+//		Subject:     "peace",
+//		TextContent: "peace was never an option",
+//	 }
+//	 c, err := New(emailer.Config{Key: "api-token"})
+//		if err != nil {
+//			//check err
+//		}
+//	 c.Send(ctx, email)
+//
+// [mailersend spec]: https://developers.mailersend.com/api/v1/email.html#send-an-email
+package mailersend
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mrwormhole/emailer"
+)
+
+const (
+	baseURL       = "https://api.mailersend.com"
+	emailPath     = "/v1/email"
+	schedulesPath = "/v1/message-schedules"
+)
+
+// Capabilities describes what mailersend can honour of an email
+var Capabilities = emailer.Capabilities{
+	// mailersend limits to, cc and bcc to 50, 10 and 10 recipients, and an email to 25MB
+	MaxRecipients:     70,
+	MaxAttachmentSize: 25 << 20,
+	InlineAttachments: true,
+	// mailersend schedules emails up to 72 hours ahead
+	ScheduleHorizon: 72 * time.Hour,
+}
+
+// checkRecipients checks the recipient limit of each field, Capabilities only has their sum
+func checkRecipients(email emailer.Email) error {
+	fields := []struct {
+		name       string
+		recipients []string
+		limit      int
+	}{
+		{name: "to", recipients: email.To, limit: 50},
+		{name: "cc", recipients: email.CC, limit: 10},
+		{name: "bcc", recipients: email.BCC, limit: 10},
+	}
+	for _, f := range fields {
+		if n := len(f.recipients); n > f.limit {
+			return fmt.Errorf("%w: mailersend limits %s to %d recipients, got %d", emailer.ErrIncompatible, f.name, f.limit, n)
+		}
+	}
+	return nil
+}
+
+// EmailClient is mailersend email client to interact with emails
+type EmailClient struct {
+	key            string
+	baseURL        string
+	markdownLayout *template.Template
+	client         http.Client
+}
+
+// New creates a new mailersend email client with given API token and http.Client
+func New(c emailer.Config) (*EmailClient, error) {
+	if strings.TrimSpace(c.Key) == "" {
+		return nil, errors.New("mailersend API token is blank")
+	}
+	e := &EmailClient{
+		key:            c.Key,
+		baseURL:        cmp.Or(strings.TrimSuffix(c.BaseURL, "/"), baseURL),
+		markdownLayout: c.MarkdownLayout,
+		client:         c.Client,
+	}
+	return e, nil
+}
+
+func init() {
+	emailer.Register("mailersend", emailer.FactoryOf(New))
+}
+
+// Capabilities returns what mailersend can honour of an email
+func (c *EmailClient) Capabilities() emailer.Capabilities {
+	return Capabilities
+}
+
+// Detail is additional info about the person such as email and name
+type Detail struct {
+	Email string `json:"email"`
+}
+
+// payload is a request that mailersend uses to send email
+type payload struct {
+	From        Detail       `json:"from"`
+	To          []Detail     `json:"to"`
+	CC          []Detail     `json:"cc,omitempty"`
+	BCC         []Detail     `json:"bcc,omitempty"`
+	Subject     string       `json:"subject"`
+	Text        string       `json:"text,omitempty"`
+	HTML        string       `json:"html,omitempty"`
+	Attachments []attachment `json:"attachments,omitempty"`
+	// SendAt is a unix timestamp
+	SendAt int64 `json:"send_at,omitempty"`
+}
+
+// attachment is a file of mailersend email, inline ones are referred by their ID
+type attachment struct {
+	// Content is base64 encoded by JSON
+	Content     []byte `json:"content"`
+	Filename    string `json:"filename"`
+	Disposition string `json:"disposition"`
+	ID          string `json:"id,omitempty"`
+}
+
+// errorMessage is a response when mailersend encounters a problem, validation errors are keyed by field path such as "to.0.email"
+type errorMessage struct {
+	Message string              `json:"message"`
+	Errors  map[string][]string `json:"errors,omitempty"`
+}
+
+// Send sends a given email
+func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
+	_, err := c.SendMessage(ctx, email)
+	return err
+}
+
+// SendMessage sends a given email and returns its mailersend message ID
+func (c *EmailClient) SendMessage(ctx context.Context, email emailer.Email) (string, error) {
+	if err := c.Capabilities().Check(email); err != nil {
+		return "", err
+	}
+	if err := checkRecipients(email); err != nil {
+		return "", err
+	}
+	email, err := email.RenderMarkdown(c.markdownLayout)
+	if err != nil {
+		return "", fmt.Errorf("email.RenderMarkdown(): %v", err)
+	}
+
+	var p payload
+	p.From.Email = email.From
+	for _, e := range email.To {
+		p.To = append(p.To, Detail{Email: e})
+	}
+	for _, e := range email.CC {
+		p.CC = append(p.CC, Detail{Email: e})
+	}
+	for _, e := range email.BCC {
+		p.BCC = append(p.BCC, Detail{Email: e})
+	}
+	p.Subject = email.Subject
+	p.Text = email.TextContent
+	p.HTML = email.HTMLContent
+	for _, a := range email.Attachments {
+		att := attachment{Content: a.Data, Filename: a.Filename, Disposition: "attachment"}
+		if a.ContentID != "" {
+			att.Disposition, att.ID = "inline", a.ContentID
+		}
+		p.Attachments = append(p.Attachments, att)
+	}
+
+	if !email.SendAt.IsZero() {
+		p.SendAt = email.SendAt.Unix()
+	}
+
+	header, err := c.do(ctx, http.MethodPost, c.baseURL+emailPath, p)
+	if err != nil {
+		return "", err
+	}
+	return header.Get("X-Message-Id"), nil
+}
+
+// Cancel deletes a scheduled email by its mailersend message ID
+func (c *EmailClient) Cancel(ctx context.Context, messageID string) error {
+	_, err := c.do(ctx, http.MethodDelete, c.baseURL+schedulesPath+"/"+url.PathEscape(messageID), nil)
+	return emailer.NotFound(err)
+}
+
+// Reschedule is not supported by mailersend, scheduled emails can only be deleted
+func (c *EmailClient) Reschedule(context.Context, string, time.Time) error {
+	return fmt.Errorf("mailersend can not reschedule: %w", errors.ErrUnsupported)
+}
+
+// do sends body as JSON to given target of mailersend, then returns the headers of a successful response since mailersend answers with none
+func (c *EmailClient) do(ctx context.Context, method, target string, body any) (http.Header, error) {
+	var reqBody io.Reader = http.NoBody
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("json.Marshal(%v): %v", body, err)
+		}
+		reqBody = bytes.NewBuffer(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequestWithContext(): %v", err)
+	}
+	req.Header.Add("Authorization", "Bearer "+c.key)
+	req.Header.Add("accept", "application/json")
+	req.Header.Add("content-type", "application/json")
+
+	resp, err := emailer.Do(&c.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if slices.Contains([]int{http.StatusAccepted, http.StatusOK, http.StatusNoContent}, resp.StatusCode) {
+		return resp.Header, nil
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("io.ReadAll(): %v", err)
+	}
+	return nil, emailer.NewStatusError(resp.StatusCode, raw, func(body []byte) (any, bool) {
+		var m errorMessage
+		err := json.Unmarshal(body, &m)
+		return m, err == nil && m.Message != ""
+	})
+}
@@ -0,0 +1,224 @@
+package mailersend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+	"github.com/mrwormhole/emailer/emailtest"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(emailer.Config{})
+	want := errors.New("mailersend API token is blank")
+	if !cmp.Equal(want.Error(), err.Error()) {
+		t.Errorf("New(): got=%q want=%q", err, want)
+	}
+}
+
+// recipientPaths are the paths of the request body that hold each recipient
+var recipientPaths = map[string][]string{
+	"to":  {"to.email"},
+	"cc":  {"cc.email"},
+	"bcc": {"bcc.email"},
+}
+
+// errorBody is how mailersend rejects a request
+const errorBody = `{"message":"conformance failure","errors":{"from.email":["conformance failure"]}}`
+
+func TestConformance(t *testing.T) {
+	emailtest.RunSenderConformance(t, func(c emailer.Config) (emailer.Sender, error) {
+		return New(c)
+	}, emailtest.Provider{Fake: emailtest.NewMailersendServer, Recipients: recipientPaths, ErrorBody: errorBody})
+}
+
+func TestSend_Schedule(t *testing.T) {
+	var got payload
+	tripper := func(req *http.Request) *http.Response {
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Fatalf("json.NewDecoder().Decode(): %v", err)
+		}
+		return &http.Response{StatusCode: http.StatusAccepted, Header: http.Header{"X-Message-Id": {"id-1"}}, Body: http.NoBody}
+	}
+	client, err := New(emailtest.NewConfig(tripper))
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+
+	sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	email := emailer.Email{
+		From:        "a@a.com",
+		To:          []string{"b@b.com"},
+		Subject:     "sub",
+		TextContent: "text",
+		SendAt:      sendAt,
+	}
+	id, err := client.SendMessage(context.Background(), email)
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	if diff := cmp.Diff("id-1", id); diff != "" {
+		t.Errorf("SendMessage(): ID diff=\n %v", diff)
+	}
+	if diff := cmp.Diff(sendAt.Unix(), got.SendAt); diff != "" {
+		t.Errorf("SendMessage(): SendAt diff=\n %v", diff)
+	}
+
+	email.SendAt = time.Now().Add(Capabilities.ScheduleHorizon + time.Hour)
+	if err := client.Send(context.Background(), email); !errors.Is(err, emailer.ErrScheduleHorizon) {
+		t.Errorf("Send(): got=%v want=%v", err, emailer.ErrScheduleHorizon)
+	}
+	if err := client.Reschedule(context.Background(), "id-1", time.Now()); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Reschedule(): got=%v want=%v", err, errors.ErrUnsupported)
+	}
+}
+
+func TestSend_RecipientLimits(t *testing.T) {
+	recipients := func(n int) []string {
+		addrs := make([]string, n)
+		for i := range addrs {
+			addrs[i] = fmt.Sprintf("r%d@r.com", i)
+		}
+		return addrs
+	}
+
+	tests := []struct {
+		name    string
+		email   emailer.Email
+		wantErr error
+	}{
+		{name: "fields at their limits", email: emailer.Email{To: recipients(50), CC: recipients(10), BCC: recipients(10)}},
+		{name: "too many to", email: emailer.Email{To: recipients(51)}, wantErr: emailer.ErrIncompatible},
+		{name: "too many cc", email: emailer.Email{To: recipients(1), CC: recipients(11)}, wantErr: emailer.ErrIncompatible},
+		{name: "too many bcc", email: emailer.Email{To: recipients(1), BCC: recipients(11)}, wantErr: emailer.ErrIncompatible},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			tripper := func(_ *http.Request) *http.Response {
+				calls++
+				return &http.Response{StatusCode: http.StatusAccepted, Header: http.Header{"X-Message-Id": {"id-1"}}, Body: http.NoBody}
+			}
+			client, err := New(emailtest.NewConfig(tripper))
+			if err != nil {
+				t.Fatalf("New(): %v", err)
+			}
+
+			tt.email.From, tt.email.Subject, tt.email.TextContent = "a@a.com", "sub", "text"
+			err = client.Send(context.Background(), tt.email)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Send(): got=%v want=%v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil && calls != 0 {
+				t.Errorf("Send(): %d requests are sent for a rejected email", calls)
+			}
+		})
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	tripper := func(*http.Request) *http.Response {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader(`{"message":"not found"}`))}
+	}
+	client, err := New(emailtest.NewConfig(tripper))
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+
+	email := emailer.Email{From: "a@a.com", To: []string{"b@b.com"}, Subject: "sub", TextContent: "text"}
+	if err := client.Send(context.Background(), email); err == nil || errors.Is(err, emailer.ErrMessageNotFound) {
+		t.Errorf("Send(): got=%v want status error that is not %v", err, emailer.ErrMessageNotFound)
+	}
+	if err := client.Cancel(context.Background(), "id-1"); !errors.Is(err, emailer.ErrMessageNotFound) {
+		t.Errorf("Cancel(): got=%v want=%v", err, emailer.ErrMessageNotFound)
+	}
+}
+
+func TestFakeServer(t *testing.T) {
+	srv := emailtest.NewMailersendServer(t)
+	client, err := New(srv.Config())
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+
+	email := emailer.Email{
+		From:        "a@a.com",
+		To:          []string{"b@b.com"},
+		BCC:         []string{"bcc@bcc.com"},
+		Subject:     "sub",
+		HTMLContent: "html",
+		Attachments: []emailer.Attachment{{Filename: "logo.png", ContentType: "image/png", ContentID: "logo", Data: []byte("png")}},
+	}
+	id, err := client.SendMessage(context.Background(), email)
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	if id == "" {
+		t.Error("SendMessage(): message ID is empty")
+	}
+	var got payload
+	if err := json.Unmarshal(srv.LastRequest().Body, &got); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
+	}
+	want := payload{
+		From:        Detail{Email: "a@a.com"},
+		To:          []Detail{{Email: "b@b.com"}},
+		BCC:         []Detail{{Email: "bcc@bcc.com"}},
+		Subject:     "sub",
+		HTML:        "html",
+		Attachments: []attachment{{Content: []byte("png"), Filename: "logo.png", Disposition: "inline", ID: "logo"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SendMessage(): payload diff=\n %v", diff)
+	}
+
+	email.SendAt = time.Now().Add(time.Hour)
+	id, err = client.SendMessage(context.Background(), email)
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	if err := client.Cancel(context.Background(), id); err != nil {
+		t.Errorf("Cancel(): %v", err)
+	}
+	if err := client.Cancel(context.Background(), id); !errors.Is(err, emailer.ErrMessageNotFound) {
+		t.Errorf("Cancel(): got=%v want=%v", err, emailer.ErrMessageNotFound)
+	}
+
+	email.SendAt = time.Time{}
+	email.CC = []string{"not-an-address"}
+	email.Subject = ""
+	var statusErr *emailer.StatusError
+	if err := client.Send(context.Background(), email); !errors.As(err, &statusErr) {
+		t.Fatalf("Send(): got=%v want=status error", err)
+	}
+	wantErr := &emailer.StatusError{StatusCode: http.StatusUnprocessableEntity, Detail: errorMessage{
+		Message: "The cc.0.email must be a valid email address. (and 1 more errors)",
+		Errors: map[string][]string{
+			"cc.0.email": {"The cc.0.email must be a valid email address."},
+			"subject":    {"The subject field is required."},
+		},
+	}}
+	if diff := cmp.Diff(wantErr, statusErr); diff != "" {
+		t.Errorf("Send(): error diff=\n %v", diff)
+	}
+
+	cfg := srv.Config()
+	cfg.Key = "wrong-key"
+	client, err = New(cfg)
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	if err := client.Send(context.Background(), email); err == nil || !strings.Contains(err.Error(), "status code(401)") {
+		t.Errorf("Send(): got=%v want=status code(401)", err)
+	}
+}
@@ -0,0 +1,270 @@
+// Package mailjet makes it easy to send emails via mailjet provider. This package follows [mailjet spec] strictly.
+// Mailjet authenticates with a pair, so Config needs Key as API key and Secret as secret key.
+//
+// Example usage:
+//
+//	 email := emailer.Email{
+//		From:        "skywalker@jedi.com",
+//		To:          []string{"vindu@sith.com"},
+//		Subject:     "peace",
+//		TextContent: "peace was never an option",
+//	 }
+//	 c, err := New(emailer.Config{Key: "api-key", Secret: "secret-key"})
+//		if err != nil {
+//			//check err
+//		}
+//	 c.Send(ctx, email)
+//
+// [mailjet spec]: https://dev.mailjet.com/email/reference/send-emails/#v3_1_post_send
+package mailjet
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mrwormhole/emailer"
+)
+
+const (
+	baseURL  = "https://api.mailjet.com"
+	sendPath = "/v3.1/send"
+	// statusSuccess is the status of a message that mailjet accepted
+	statusSuccess = "success"
+)
+
+// Capabilities describes what mailjet can honour of an email
+var Capabilities = emailer.Capabilities{
+	// mailjet limits a message to 50 recipients and 15MB
+	MaxRecipients:     50,
+	MaxAttachmentSize: 15 << 20,
+	InlineAttachments: true,
+}
+
+// EmailClient is mailjet email client to interact with emails
+type EmailClient struct {
+	key            string
+	secret         string
+	baseURL        string
+	markdownLayout *template.Template
+	client         http.Client
+}
+
+// New creates a new mailjet email client with given API key, secret key and http.Client
+func New(c emailer.Config) (*EmailClient, error) {
+	if strings.TrimSpace(c.Key) == "" {
+		return nil, errors.New("mailjet API key is blank")
+	}
+	if strings.TrimSpace(c.Secret) == "" {
+		return nil, errors.New("mailjet secret key is blank")
+	}
+	e := &EmailClient{
+		key:            c.Key,
+		secret:         c.Secret,
+		baseURL:        cmp.Or(strings.TrimSuffix(c.BaseURL, "/"), baseURL),
+		markdownLayout: c.MarkdownLayout,
+		client:         c.Client,
+	}
+	return e, nil
+}
+
+func init() {
+	emailer.Register("mailjet", emailer.FactoryOf(New))
+}
+
+// Capabilities returns what mailjet can honour of an email
+func (c *EmailClient) Capabilities() emailer.Capabilities {
+	return Capabilities
+}
+
+// Detail is additional info about the person such as email and name
+type Detail struct {
+	Email string `json:"Email"`
+}
+
+// payload is a request that mailjet uses to send emails
+type payload struct {
+	Messages []message `json:"Messages"`
+}
+
+// message is a single email of mailjet send request
+type message struct {
+	From               Detail       `json:"From"`
+	To                 []Detail     `json:"To"`
+	CC                 []Detail     `json:"Cc,omitempty"`
+	BCC                []Detail     `json:"Bcc,omitempty"`
+	Subject            string       `json:"Subject"`
+	TextPart           string       `json:"TextPart,omitempty"`
+	HTMLPart           string       `json:"HTMLPart,omitempty"`
+	Attachments        []attachment `json:"Attachments,omitempty"`
+	InlinedAttachments []attachment `json:"InlinedAttachments,omitempty"`
+}
+
+// attachment is a file of mailjet email, the inlined ones have a content ID
+type attachment struct {
+	ContentType string `json:"ContentType"`
+	Filename    string `json:"Filename"`
+	ContentID   string `json:"ContentID,omitempty"`
+	// Base64Content is base64 encoded by JSON
+	Base64Content []byte `json:"Base64Content"`
+}
+
+// result is a response of mailjet with the status of every message in the request order
+type result struct {
+	Messages []messageResult `json:"Messages"`
+}
+
+// messageResult is the status of a single message, successful ones list their recipients with message IDs
+type messageResult struct {
+	Status string         `json:"Status"`
+	Errors []errorMessage `json:"Errors"`
+	To     []recipient    `json:"To"`
+	CC     []recipient    `json:"Cc"`
+	BCC    []recipient    `json:"Bcc"`
+}
+
+type recipient struct {
+	Email       string `json:"Email"`
+	MessageUUID string `json:"MessageUUID"`
+	MessageID   int64  `json:"MessageID"`
+}
+
+// errorMessage is a problem that mailjet reports for a message or for the whole request
+type errorMessage struct {
+	ErrorIdentifier string   `json:"ErrorIdentifier"`
+	ErrorCode       string   `json:"ErrorCode"`
+	StatusCode      int      `json:"StatusCode"`
+	ErrorMessage    string   `json:"ErrorMessage"`
+	ErrorRelatedTo  []string `json:"ErrorRelatedTo"`
+}
+
+// Send sends a given email
+func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
+	_, err := c.SendMessage(ctx, email)
+	return err
+}
+
+// SendMessage sends a given email and returns the mailjet message ID of its first recipient
+func (c *EmailClient) SendMessage(ctx context.Context, email emailer.Email) (string, error) {
+	if err := c.Capabilities().Check(email); err != nil {
+		return "", err
+	}
+	email, err := email.RenderMarkdown(c.markdownLayout)
+	if err != nil {
+		return "", fmt.Errorf("email.RenderMarkdown(): %v", err)
+	}
+
+	var m message
+	m.From.Email = email.From
+	for _, e := range email.To {
+		m.To = append(m.To, Detail{Email: e})
+	}
+	for _, e := range email.CC {
+		m.CC = append(m.CC, Detail{Email: e})
+	}
+	for _, e := range email.BCC {
+		m.BCC = append(m.BCC, Detail{Email: e})
+	}
+	m.Subject = email.Subject
+	m.TextPart = email.TextContent
+	m.HTMLPart = email.HTMLContent
+	for _, a := range email.Attachments {
+		att := attachment{ContentType: cmp.Or(a.ContentType, "application/octet-stream"), Filename: a.Filename, ContentID: a.ContentID, Base64Content: a.Data}
+		if a.ContentID != "" {
+			m.InlinedAttachments = append(m.InlinedAttachments, att)
+			continue
+		}
+		m.Attachments = append(m.Attachments, att)
+	}
+
+	r, err := c.do(ctx, payload{Messages: []message{m}})
+	if err != nil {
+		return "", err
+	}
+	for _, m := range r.Messages {
+		for _, rcpt := range m.To {
+			if rcpt.MessageID != 0 {
+				return strconv.FormatInt(rcpt.MessageID, 10), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// do sends body as JSON to mailjet, then checks the status of every message.
+// Mailjet can accept some messages of a request and reject others, any rejected message fails the request
+func (c *EmailClient) do(ctx context.Context, body payload) (result, error) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return result{}, fmt.Errorf("json.Marshal(%v): %v", body, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+sendPath, bytes.NewBuffer(raw))
+	if err != nil {
+		return result{}, fmt.Errorf("http.NewRequestWithContext(): %v", err)
+	}
+	req.SetBasicAuth(c.key, c.secret)
+	req.Header.Add("accept", "application/json")
+	req.Header.Add("content-type", "application/json")
+
+	resp, err := emailer.Do(&c.client, req)
+	if err != nil {
+		return result{}, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return result{}, fmt.Errorf("io.ReadAll(): %v", err)
+	}
+	var r result
+	decodeErr := json.Unmarshal(respBody, &r)
+	if decodeErr != nil && len(bytes.TrimSpace(respBody)) == 0 {
+		decodeErr = nil
+	}
+	failed := failures(r)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if decodeErr != nil {
+			return result{}, fmt.Errorf("json.Unmarshal(): %v", decodeErr)
+		}
+		if len(failed) > 0 {
+			// a successful response with rejected messages carries their own status codes
+			return result{}, &emailer.StatusError{StatusCode: cmp.Or(failed[0].StatusCode, http.StatusBadRequest), Detail: failed}
+		}
+		return r, nil
+	}
+
+	return result{}, emailer.NewStatusError(resp.StatusCode, respBody, func(body []byte) (any, bool) {
+		if len(failed) > 0 {
+			return failed, true
+		}
+		var m errorMessage
+		err := json.Unmarshal(body, &m)
+		return m, err == nil && m.ErrorMessage != ""
+	})
+}
+
+// failures returns the errors of messages that mailjet did not accept
+func failures(r result) []errorMessage {
+	var failed []errorMessage
+	for _, m := range r.Messages {
+		if m.Status == statusSuccess {
+			continue
+		}
+		failed = append(failed, m.Errors...)
+		if len(m.Errors) == 0 {
+			failed = append(failed, errorMessage{ErrorMessage: "message status is " + strconv.Quote(m.Status)})
+		}
+	}
+	return failed
+}
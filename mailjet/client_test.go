@@ -0,0 +1,187 @@
+package mailjet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+	"github.com/mrwormhole/emailer/emailtest"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		c    emailer.Config
+		want string
+	}{
+		{name: "blank key", c: emailer.Config{Secret: "secret"}, want: "mailjet API key is blank"},
+		{name: "blank secret", c: emailer.Config{Key: "key"}, want: "mailjet secret key is blank"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.c)
+			if err == nil || !cmp.Equal(tt.want, err.Error()) {
+				t.Errorf("New(): got=%v want=%q", err, tt.want)
+			}
+		})
+	}
+}
+
+// recipientPaths are the paths of the request body that hold each recipient
+var recipientPaths = map[string][]string{
+	"to":  {"messages.to.email"},
+	"cc":  {"messages.cc.email"},
+	"bcc": {"messages.bcc.email"},
+}
+
+// errorBody is how mailjet rejects a request
+const errorBody = `{"ErrorIdentifier":"e1","ErrorCode":"mj-0003","StatusCode":400,"ErrorMessage":"conformance failure","ErrorRelatedTo":["Messages"]}`
+
+func TestConformance(t *testing.T) {
+	emailtest.RunSenderConformance(t, func(c emailer.Config) (emailer.Sender, error) {
+		return New(c)
+	}, emailtest.Provider{Fake: emailtest.NewMailjetServer, Recipients: recipientPaths, ErrorBody: errorBody})
+}
+
+func TestSend_MessageStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       int
+		body       string
+		wantID     string
+		wantStatus int
+		wantDetail any
+	}{
+		{
+			name:   "success",
+			code:   http.StatusOK,
+			body:   `{"Messages":[{"Status":"success","To":[{"Email":"b@b.com","MessageUUID":"uuid-1","MessageID":576460752303423488}]}]}`,
+			wantID: "576460752303423488",
+		},
+		{
+			name: "partially failed batch",
+			code: http.StatusBadRequest,
+			body: `{"Messages":[{"Status":"success","To":[{"Email":"b@b.com","MessageID":1}]},` +
+				`{"Status":"error","Errors":[{"ErrorIdentifier":"id-1","ErrorCode":"mj-0013","StatusCode":400,` +
+				`"ErrorMessage":"\"bad\" is an invalid email address.","ErrorRelatedTo":["To[0].Email"]}]}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantDetail: []errorMessage{{
+				ErrorIdentifier: "id-1",
+				ErrorCode:       "mj-0013",
+				StatusCode:      http.StatusBadRequest,
+				ErrorMessage:    `"bad" is an invalid email address.`,
+				ErrorRelatedTo:  []string{"To[0].Email"},
+			}},
+		},
+		{
+			name:       "failed message in successful response",
+			code:       http.StatusOK,
+			body:       `{"Messages":[{"Status":"error","Errors":[{"StatusCode":403,"ErrorMessage":"Sender is blocked"}]}]}`,
+			wantStatus: http.StatusForbidden,
+			wantDetail: []errorMessage{{StatusCode: http.StatusForbidden, ErrorMessage: "Sender is blocked"}},
+		},
+		{
+			name:       "request error",
+			code:       http.StatusUnauthorized,
+			body:       `{"ErrorIdentifier":"id-2","StatusCode":401,"ErrorMessage":"API key authentication/authorization failure."}`,
+			wantStatus: http.StatusUnauthorized,
+			wantDetail: errorMessage{ErrorIdentifier: "id-2", StatusCode: http.StatusUnauthorized, ErrorMessage: "API key authentication/authorization failure."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tripper := func(*http.Request) *http.Response {
+				return &http.Response{StatusCode: tt.code, Body: io.NopCloser(strings.NewReader(tt.body))}
+			}
+			client, err := New(emailtest.NewConfig(tripper))
+			if err != nil {
+				t.Fatalf("New(): %v", err)
+			}
+
+			email := emailer.Email{From: "a@a.com", To: []string{"b@b.com"}, Subject: "sub", TextContent: "text"}
+			id, err := client.SendMessage(context.Background(), email)
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("SendMessage(): %v", err)
+				}
+				if diff := cmp.Diff(tt.wantID, id); diff != "" {
+					t.Errorf("SendMessage(): ID diff=\n %v", diff)
+				}
+				return
+			}
+			var statusErr *emailer.StatusError
+			if !errors.As(err, &statusErr) {
+				t.Fatalf("SendMessage(): got=%v want=status error", err)
+			}
+			if diff := cmp.Diff(&emailer.StatusError{StatusCode: tt.wantStatus, Detail: tt.wantDetail}, statusErr); diff != "" {
+				t.Errorf("SendMessage(): error diff=\n %v", diff)
+			}
+		})
+	}
+}
+
+func TestFakeServer(t *testing.T) {
+	srv := emailtest.NewMailjetServer(t)
+	client, err := New(srv.Config())
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+
+	email := emailer.Email{
+		From:        "a@a.com",
+		To:          []string{"b@b.com"},
+		BCC:         []string{"bcc@bcc.com"},
+		Subject:     "sub",
+		HTMLContent: "html",
+		Attachments: []emailer.Attachment{
+			{Filename: "logo.png", ContentType: "image/png", ContentID: "logo", Data: []byte("png")},
+			{Filename: "report.csv", Data: []byte("a,b")},
+		},
+	}
+	id, err := client.SendMessage(context.Background(), email)
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	if id == "" {
+		t.Error("SendMessage(): message ID is empty")
+	}
+	var got payload
+	if err := json.Unmarshal(srv.LastRequest().Body, &got); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
+	}
+	want := payload{Messages: []message{{
+		From:               Detail{Email: "a@a.com"},
+		To:                 []Detail{{Email: "b@b.com"}},
+		BCC:                []Detail{{Email: "bcc@bcc.com"}},
+		Subject:            "sub",
+		HTMLPart:           "html",
+		Attachments:        []attachment{{ContentType: "application/octet-stream", Filename: "report.csv", Base64Content: []byte("a,b")}},
+		InlinedAttachments: []attachment{{ContentType: "image/png", Filename: "logo.png", ContentID: "logo", Base64Content: []byte("png")}},
+	}}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SendMessage(): payload diff=\n %v", diff)
+	}
+
+	email.CC = []string{"not-an-address"}
+	if err := client.Send(context.Background(), email); err == nil || !strings.Contains(err.Error(), "not-an-address") {
+		t.Errorf("Send(): got=%v want=invalid email address", err)
+	}
+	cfg := srv.Config()
+	cfg.Secret = "wrong-secret"
+	client, err = New(cfg)
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	if err := client.Send(context.Background(), email); err == nil || !strings.Contains(err.Error(), "status code(401)") {
+		t.Errorf("Send(): got=%v want=status code(401)", err)
+	}
+}
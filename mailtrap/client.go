@@ -0,0 +1,219 @@
+// Package mailtrap makes it easy to send emails via mailtrap provider. This package follows [mailtrap spec] strictly.
+// Emails either go to recipients through email sending API, or to a testing inbox through sandbox API so nothing reaches them.
+//
+// Example usage:
+//
+//	 email := emailer.Email{
+//		From:        "skywalker@jedi.com",
+//		To:          []string{"vindu@sith.com"},
+//		Subject:     "peace",
+//		TextContent: "peace was never an option",
+//	 }
+//	 c, err := New(emailer.Config{Key: "api-token"})
+//		if err != nil {
+//			//check err
+//		}
+//	 c.Send(ctx, email)
+//
+//	 staging, err := NewSandbox(emailer.Config{Key: "api-token"}, "2804124")
+//
+// [mailtrap spec]: https://api-docs.mailtrap.io/docs/mailtrap-api-docs/67f1d70aeb62c-send-email-including-templates
+package mailtrap
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mrwormhole/emailer"
+)
+
+const (
+	sendingURL = "https://send.api.mailtrap.io"
+	sandboxURL = "https://sandbox.api.mailtrap.io"
+	sendPath   = "/api/send"
+)
+
+// Capabilities describes what mailtrap can honour of an email
+var Capabilities = emailer.Capabilities{
+	InlineAttachments: true,
+}
+
+// EmailClient is mailtrap email client to interact with emails
+type EmailClient struct {
+	key            string
+	target         string
+	markdownLayout *template.Template
+	client         http.Client
+}
+
+// New creates a new mailtrap email client with given API token and http.Client,
+// it sends to recipients unless InboxID of c is set, see NewSandbox
+func New(c emailer.Config) (*EmailClient, error) {
+	if strings.TrimSpace(c.Key) == "" {
+		return nil, errors.New("mailtrap API token is blank")
+	}
+	target := cmp.Or(strings.TrimSuffix(c.BaseURL, "/"), sendingURL) + sendPath
+	if c.InboxID != "" {
+		target = cmp.Or(strings.TrimSuffix(c.BaseURL, "/"), sandboxURL) + sendPath + "/" + url.PathEscape(c.InboxID)
+	}
+	e := &EmailClient{
+		key:            c.Key,
+		target:         target,
+		markdownLayout: c.MarkdownLayout,
+		client:         c.Client,
+	}
+	return e, nil
+}
+
+func init() {
+	emailer.Register("mailtrap", emailer.FactoryOf(New))
+}
+
+// Capabilities returns what mailtrap can honour of an email
+func (c *EmailClient) Capabilities() emailer.Capabilities {
+	return Capabilities
+}
+
+// NewSandbox creates a new mailtrap email client that delivers into the testing inbox of inboxID instead of recipients
+func NewSandbox(c emailer.Config, inboxID string) (*EmailClient, error) {
+	if strings.TrimSpace(inboxID) == "" {
+		return nil, errors.New("mailtrap inbox ID is blank")
+	}
+	c.InboxID = inboxID
+	return New(c)
+}
+
+// Detail is additional info about the person such as email and name
+type Detail struct {
+	Email string `json:"email"`
+}
+
+// payload is a request that mailtrap uses to send email
+type payload struct {
+	From        Detail       `json:"from"`
+	To          []Detail     `json:"to"`
+	CC          []Detail     `json:"cc,omitempty"`
+	BCC         []Detail     `json:"bcc,omitempty"`
+	Subject     string       `json:"subject"`
+	Text        string       `json:"text,omitempty"`
+	HTML        string       `json:"html,omitempty"`
+	Attachments []attachment `json:"attachments,omitempty"`
+}
+
+// attachment is a file of mailtrap email, the ones with content ID are inline
+type attachment struct {
+	// Content is base64 encoded by JSON
+	Content     []byte `json:"content"`
+	Filename    string `json:"filename"`
+	Type        string `json:"type,omitempty"`
+	Disposition string `json:"disposition"`
+	ContentID   string `json:"content_id,omitempty"`
+}
+
+// result is a response when mailtrap accepts an email
+type result struct {
+	Success    bool     `json:"success"`
+	MessageIDs []string `json:"message_ids"`
+}
+
+// errorMessage is a response when mailtrap encounters a problem while sending email
+type errorMessage struct {
+	Errors []string `json:"errors"`
+}
+
+// Send sends a given email
+func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
+	_, err := c.SendMessage(ctx, email)
+	return err
+}
+
+// SendMessage sends a given email and returns its mailtrap message ID
+func (c *EmailClient) SendMessage(ctx context.Context, email emailer.Email) (string, error) {
+	if err := c.Capabilities().Check(email); err != nil {
+		return "", err
+	}
+	email, err := email.RenderMarkdown(c.markdownLayout)
+	if err != nil {
+		return "", fmt.Errorf("email.RenderMarkdown(): %v", err)
+	}
+
+	var p payload
+	p.From.Email = email.From
+	for _, e := range email.To {
+		p.To = append(p.To, Detail{Email: e})
+	}
+	for _, e := range email.CC {
+		p.CC = append(p.CC, Detail{Email: e})
+	}
+	for _, e := range email.BCC {
+		p.BCC = append(p.BCC, Detail{Email: e})
+	}
+	p.Subject = email.Subject
+	p.Text = email.TextContent
+	p.HTML = email.HTMLContent
+	for _, a := range email.Attachments {
+		disposition := "attachment"
+		if a.ContentID != "" {
+			disposition = "inline"
+		}
+		p.Attachments = append(p.Attachments, attachment{Content: a.Data, Filename: a.Filename, Type: a.ContentType, Disposition: disposition, ContentID: a.ContentID})
+	}
+
+	var r result
+	if err := c.do(ctx, p, &r); err != nil {
+		return "", err
+	}
+	if len(r.MessageIDs) == 0 {
+		return "", nil
+	}
+	return r.MessageIDs[0], nil
+}
+
+// do sends body as JSON to the target of the client, then decodes a successful response into out
+func (c *EmailClient) do(ctx context.Context, body, out any) error {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("json.Marshal(%v): %v", body, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.target, bytes.NewBuffer(raw))
+	if err != nil {
+		return fmt.Errorf("http.NewRequestWithContext(): %v", err)
+	}
+	req.Header.Add("Api-Token", c.key)
+	req.Header.Add("accept", "application/json")
+	req.Header.Add("content-type", "application/json")
+
+	resp, err := emailer.Do(&c.client, req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("json.NewDecoder().Decode(): %v", err)
+		}
+		return nil
+	}
+
+	raw, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("io.ReadAll(): %v", err)
+	}
+	return emailer.NewStatusError(resp.StatusCode, raw, func(body []byte) (any, bool) {
+		var m errorMessage
+		err := json.Unmarshal(body, &m)
+		return m, err == nil && len(m.Errors) > 0
+	})
+}
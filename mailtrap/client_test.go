@@ -0,0 +1,180 @@
+package mailtrap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+	"github.com/mrwormhole/emailer/emailtest"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		newFunc func() (*EmailClient, error)
+		want    string
+	}{
+		{
+			name:    "blank key",
+			newFunc: func() (*EmailClient, error) { return New(emailer.Config{}) },
+			want:    "mailtrap API token is blank",
+		},
+		{
+			name:    "sandbox blank key",
+			newFunc: func() (*EmailClient, error) { return NewSandbox(emailer.Config{}, "1") },
+			want:    "mailtrap API token is blank",
+		},
+		{
+			name:    "sandbox blank inbox",
+			newFunc: func() (*EmailClient, error) { return NewSandbox(emailer.Config{Key: "key"}, " ") },
+			want:    "mailtrap inbox ID is blank",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.newFunc()
+			if err == nil || !cmp.Equal(tt.want, err.Error()) {
+				t.Errorf("New(): got=%v want=%q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew_Target(t *testing.T) {
+	c, err := New(emailer.Config{Key: "key"})
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	if diff := cmp.Diff("https://send.api.mailtrap.io/api/send", c.target); diff != "" {
+		t.Errorf("New(): target diff=\n %v", diff)
+	}
+	c, err = NewSandbox(emailer.Config{Key: "key"}, "2804124")
+	if err != nil {
+		t.Fatalf("NewSandbox(): %v", err)
+	}
+	if diff := cmp.Diff("https://sandbox.api.mailtrap.io/api/send/2804124", c.target); diff != "" {
+		t.Errorf("NewSandbox(): target diff=\n %v", diff)
+	}
+
+	// the registry opens the sandbox from the inbox ID of config
+	s, err := emailer.Open("mailtrap", emailer.Config{Key: "key", InboxID: "2804124"})
+	if err != nil {
+		t.Fatalf("emailer.Open(): %v", err)
+	}
+	if diff := cmp.Diff("https://sandbox.api.mailtrap.io/api/send/2804124", s.(*EmailClient).target); diff != "" {
+		t.Errorf("emailer.Open(): target diff=\n %v", diff)
+	}
+}
+
+// recipientPaths are the paths of the request body that hold each recipient
+var recipientPaths = map[string][]string{
+	"to":  {"to.email"},
+	"cc":  {"cc.email"},
+	"bcc": {"bcc.email"},
+}
+
+// errorBody is how mailtrap rejects a request
+const errorBody = `{"errors":["conformance failure"]}`
+
+func TestConformance(t *testing.T) {
+	t.Run("sending", func(t *testing.T) {
+		emailtest.RunSenderConformance(t, func(c emailer.Config) (emailer.Sender, error) {
+			return New(c)
+		}, emailtest.Provider{Fake: emailtest.NewMailtrapServer, Recipients: recipientPaths, ErrorBody: errorBody})
+	})
+	t.Run("sandbox", func(t *testing.T) {
+		emailtest.RunSenderConformance(t, func(c emailer.Config) (emailer.Sender, error) {
+			return NewSandbox(c, "1")
+		}, emailtest.Provider{Fake: emailtest.NewMailtrapServer, Recipients: recipientPaths, ErrorBody: errorBody})
+	})
+}
+
+func TestFakeServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		newFunc  func(c emailer.Config) (*EmailClient, error)
+		wantPath string
+	}{
+		{
+			name:     "sending",
+			newFunc:  New,
+			wantPath: "/api/send",
+		},
+		{
+			name:     "sandbox",
+			newFunc:  func(c emailer.Config) (*EmailClient, error) { return NewSandbox(c, "2804124") },
+			wantPath: "/api/send/2804124",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := emailtest.NewMailtrapServer(t)
+			client, err := tt.newFunc(srv.Config())
+			if err != nil {
+				t.Fatalf("New(): %v", err)
+			}
+
+			email := emailer.Email{
+				From:        "a@a.com",
+				To:          []string{"b@b.com"},
+				BCC:         []string{"bcc@bcc.com"},
+				Subject:     "sub",
+				HTMLContent: "html",
+				Attachments: []emailer.Attachment{{Filename: "logo.png", ContentType: "image/png", ContentID: "logo", Data: []byte("png")}},
+			}
+			id, err := client.SendMessage(context.Background(), email)
+			if err != nil {
+				t.Fatalf("SendMessage(): %v", err)
+			}
+			if id == "" {
+				t.Error("SendMessage(): message ID is empty")
+			}
+			req := srv.LastRequest()
+			if diff := cmp.Diff(tt.wantPath, req.Path); diff != "" {
+				t.Errorf("SendMessage(): path diff=\n %v", diff)
+			}
+			var got payload
+			if err := json.Unmarshal(req.Body, &got); err != nil {
+				t.Fatalf("json.Unmarshal(): %v", err)
+			}
+			want := payload{
+				From:        Detail{Email: "a@a.com"},
+				To:          []Detail{{Email: "b@b.com"}},
+				BCC:         []Detail{{Email: "bcc@bcc.com"}},
+				Subject:     "sub",
+				HTML:        "html",
+				Attachments: []attachment{{Content: []byte("png"), Filename: "logo.png", Type: "image/png", Disposition: "inline", ContentID: "logo"}},
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("SendMessage(): payload diff=\n %v", diff)
+			}
+
+			email.CC = []string{"not-an-address"}
+			var statusErr *emailer.StatusError
+			if err := client.Send(context.Background(), email); !errors.As(err, &statusErr) {
+				t.Fatalf("Send(): got=%v want=status error", err)
+			}
+			want400 := &emailer.StatusError{StatusCode: 400, Detail: errorMessage{Errors: []string{"'cc' address 'not-an-address' is invalid"}}}
+			if diff := cmp.Diff(want400, statusErr); diff != "" {
+				t.Errorf("Send(): error diff=\n %v", diff)
+			}
+
+			cfg := srv.Config()
+			cfg.Key = "wrong-key"
+			client, err = tt.newFunc(cfg)
+			if err != nil {
+				t.Fatalf("New(): %v", err)
+			}
+			if err := client.Send(context.Background(), email); err == nil || !strings.Contains(err.Error(), "status code(401)") {
+				t.Errorf("Send(): got=%v want=status code(401)", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+// Package mandrill makes it easy to send emails via Mailchimp Transactional (mandrill) provider. This package follows [mandrill spec] strictly.
+//
+// Example usage:
+//
+//	 email := emailer.Email{
+//		From:        "skywalker@jedi.com",
+//		To:          []string{"vindu@sith.com"},
+//		Subject:     "peace",
+//		TextContent: "peace was never an option",
+//	 }
+//	 c, err := New(emailer.Config{Key: "api-key"})
+//		if err != nil {
+//			//check err
+//		}
+//	 c.Send(ctx, email)
+//
+// [mandrill spec]: https://mailchimp.com/developer/transactional/api/messages/send-new-message/
+package mandrill
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mrwormhole/emailer"
+)
+
+const (
+	baseURL  = "https://mandrillapp.com"
+	sendPath = "/api/1.0/messages/send"
+)
+
+// Recipient types of mandrill
+const (
+	typeTo  = "to"
+	typeCC  = "cc"
+	typeBCC = "bcc"
+)
+
+// Recipient statuses of mandrill, the others are rejected or invalid
+const (
+	StatusSent      = "sent"
+	StatusQueued    = "queued"
+	StatusScheduled = "scheduled"
+)
+
+// RejectError is returned when mandrill accepts the request but does not deliver to some recipients
+type RejectError struct {
+	// Results are the recipients with rejected or invalid status
+	Results []Result
+}
+
+// Error returns the recipients and the reasons they are not delivered
+func (e *RejectError) Error() string {
+	reasons := make([]string, 0, len(e.Results))
+	for _, r := range e.Results {
+		reasons = append(reasons, fmt.Sprintf("%s %s(%s)", r.Email, r.Status, r.RejectReason))
+	}
+	return "mandrill did not deliver to " + strings.Join(reasons, ", ")
+}
+
+// Unwrap returns emailer.ErrRejected, the other recipients are delivered so the email must not be sent again
+func (e *RejectError) Unwrap() error {
+	return emailer.ErrRejected
+}
+
+// Capabilities describes what mandrill can honour of an email
+var Capabilities = emailer.Capabilities{
+	// mandrill limits a message to 25MB
+	MaxAttachmentSize: 25 << 20,
+	InlineAttachments: true,
+}
+
+// EmailClient is mandrill email client to interact with emails
+type EmailClient struct {
+	key            string
+	baseURL        string
+	markdownLayout *template.Template
+	client         http.Client
+}
+
+// New creates a new mandrill email client with given API key and http.Client
+func New(c emailer.Config) (*EmailClient, error) {
+	if strings.TrimSpace(c.Key) == "" {
+		return nil, errors.New("mandrill API key is blank")
+	}
+	e := &EmailClient{
+		key:            c.Key,
+		baseURL:        cmp.Or(strings.TrimSuffix(c.BaseURL, "/"), baseURL),
+		markdownLayout: c.MarkdownLayout,
+		client:         c.Client,
+	}
+	return e, nil
+}
+
+func init() {
+	emailer.Register("mandrill", emailer.FactoryOf(New))
+}
+
+// Capabilities returns what mandrill can honour of an email
+func (c *EmailClient) Capabilities() emailer.Capabilities {
+	return Capabilities
+}
+
+// payload is a request that mandrill uses to send email, the key is a body field
+type payload struct {
+	Key     string  `json:"key"`
+	Message message `json:"message"`
+}
+
+type message struct {
+	FromEmail string      `json:"from_email"`
+	To        []recipient `json:"to"`
+	Subject   string      `json:"subject"`
+	HTML      string      `json:"html,omitempty"`
+	Text      string      `json:"text,omitempty"`
+	// PreserveRecipients shows to and cc recipients to each other like a regular email does
+	PreserveRecipients bool         `json:"preserve_recipients"`
+	Attachments        []attachment `json:"attachments,omitempty"`
+	Images             []attachment `json:"images,omitempty"`
+}
+
+// recipient is a recipient of mandrill email, its type tells to, cc or bcc
+type recipient struct {
+	Email string `json:"email"`
+	Type  string `json:"type"`
+}
+
+// attachment is a file of mandrill email, images are inline and named by their content ID
+type attachment struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// Content is base64 encoded by JSON
+	Content []byte `json:"content"`
+}
+
+// Result is the status of a single recipient that mandrill reports
+type Result struct {
+	Email        string `json:"email"`
+	Status       string `json:"status"`
+	RejectReason string `json:"reject_reason"`
+	ID           string `json:"_id"`
+}
+
+// errorMessage is a response when mandrill encounters a problem with the request
+type errorMessage struct {
+	Status  string `json:"status"`
+	Code    int    `json:"code"`
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// Send sends a given email
+func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
+	_, err := c.SendMessage(ctx, email)
+	return err
+}
+
+// SendMessage sends a given email and returns the mandrill ID of its first recipient.
+// It fails with RejectError when any recipient is rejected or invalid, even though the others may be delivered
+func (c *EmailClient) SendMessage(ctx context.Context, email emailer.Email) (string, error) {
+	if err := c.Capabilities().Check(email); err != nil {
+		return "", err
+	}
+	email, err := email.RenderMarkdown(c.markdownLayout)
+	if err != nil {
+		return "", fmt.Errorf("email.RenderMarkdown(): %v", err)
+	}
+
+	p := payload{Key: c.key}
+	m := &p.Message
+	m.FromEmail = email.From
+	for _, rcpts := range []struct {
+		typ   string
+		addrs []string
+	}{{typeTo, email.To}, {typeCC, email.CC}, {typeBCC, email.BCC}} {
+		for _, e := range rcpts.addrs {
+			m.To = append(m.To, recipient{Email: e, Type: rcpts.typ})
+		}
+	}
+	m.Subject = email.Subject
+	m.HTML = email.HTMLContent
+	m.Text = email.TextContent
+	m.PreserveRecipients = true
+	for _, a := range email.Attachments {
+		contentType := cmp.Or(a.ContentType, "application/octet-stream")
+		if a.ContentID != "" {
+			m.Images = append(m.Images, attachment{Type: contentType, Name: a.ContentID, Content: a.Data})
+			continue
+		}
+		m.Attachments = append(m.Attachments, attachment{Type: contentType, Name: a.Filename, Content: a.Data})
+	}
+
+	var results []Result
+	if err := c.do(ctx, c.baseURL+sendPath, p, &results); err != nil {
+		return "", err
+	}
+	// mandrill answers every recipient, so no results means the email was not taken
+	if len(results) == 0 {
+		return "", errors.New("mandrill answered without recipient results")
+	}
+	var id string
+	var rejected []Result
+	for _, r := range results {
+		switch r.Status {
+		case StatusSent, StatusQueued, StatusScheduled:
+			id = cmp.Or(id, r.ID)
+		default:
+			rejected = append(rejected, r)
+		}
+	}
+	if len(rejected) > 0 {
+		return "", &RejectError{Results: rejected}
+	}
+	return id, nil
+}
+
+// do sends body as JSON to given target of mandrill, then decodes a successful response into out
+func (c *EmailClient) do(ctx context.Context, target string, body, out any) error {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("json.Marshal(): %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewBuffer(raw))
+	if err != nil {
+		return fmt.Errorf("http.NewRequestWithContext(): %v", err)
+	}
+	req.Header.Add("accept", "application/json")
+	req.Header.Add("content-type", "application/json")
+
+	resp, err := emailer.Do(&c.client, req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("json.NewDecoder().Decode(): %v", err)
+		}
+		return nil
+	}
+
+	raw, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("io.ReadAll(): %v", err)
+	}
+	return emailer.NewStatusError(resp.StatusCode, raw, func(body []byte) (any, bool) {
+		var m errorMessage
+		err := json.Unmarshal(body, &m)
+		return m, err == nil
+	})
+}
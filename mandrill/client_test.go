@@ -0,0 +1,182 @@
+package mandrill
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+	"github.com/mrwormhole/emailer/emailtest"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(emailer.Config{})
+	want := errors.New("mandrill API key is blank")
+	if !cmp.Equal(want.Error(), err.Error()) {
+		t.Errorf("New(): got=%q want=%q", err, want)
+	}
+}
+
+// recipientPaths are the paths of the request body that hold each recipient,
+// mandrill tells them apart by their type which TestFakeServer checks
+var recipientPaths = map[string][]string{
+	"to":  {"message.to.email"},
+	"cc":  {"message.to.email"},
+	"bcc": {"message.to.email"},
+}
+
+// errorBody is how mandrill rejects a request
+const errorBody = `{"status":"error","code":-2,"name":"ValidationError","message":"conformance failure"}`
+
+func TestConformance(t *testing.T) {
+	emailtest.RunSenderConformance(t, func(c emailer.Config) (emailer.Sender, error) {
+		return New(c)
+	}, emailtest.Provider{Fake: emailtest.NewMandrillServer, Recipients: recipientPaths, ErrorBody: errorBody})
+}
+
+func TestSend_Results(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantID       string
+		wantRejected []Result
+		wantErr      string
+	}{
+		{
+			name:   "sent and queued",
+			body:   `[{"email":"b@b.com","status":"sent","_id":"id-1"},{"email":"c@c.com","status":"queued","_id":"id-2"}]`,
+			wantID: "id-1",
+		},
+		{
+			name:         "rejected in successful response",
+			body:         `[{"email":"b@b.com","status":"sent","_id":"id-1"},{"email":"c@c.com","status":"rejected","reject_reason":"unsub","_id":"id-2"}]`,
+			wantRejected: []Result{{Email: "c@c.com", Status: "rejected", RejectReason: "unsub", ID: "id-2"}},
+		},
+		{
+			name:         "invalid in successful response",
+			body:         `[{"email":"b@","status":"invalid","_id":"id-1"}]`,
+			wantRejected: []Result{{Email: "b@", Status: "invalid", ID: "id-1"}},
+		},
+		{
+			name:    "no results",
+			body:    `[]`,
+			wantErr: "mandrill answered without recipient results",
+		},
+		{
+			name:    "empty body",
+			wantErr: "mandrill answered without recipient results",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tripper := func(*http.Request) *http.Response {
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(tt.body))}
+			}
+			client, err := New(emailtest.NewConfig(tripper))
+			if err != nil {
+				t.Fatalf("New(): %v", err)
+			}
+
+			email := emailer.Email{From: "a@a.com", To: []string{"b@b.com"}, Subject: "sub", TextContent: "text"}
+			id, err := client.SendMessage(context.Background(), email)
+			if tt.wantErr != "" {
+				if err == nil || !cmp.Equal(tt.wantErr, err.Error()) {
+					t.Errorf("SendMessage(): got=%v want=%q", err, tt.wantErr)
+				}
+				return
+			}
+			var rejectErr *RejectError
+			if errors.As(err, &rejectErr) {
+				if diff := cmp.Diff(tt.wantRejected, rejectErr.Results); diff != "" {
+					t.Errorf("SendMessage(): rejected diff=\n %v", diff)
+				}
+			} else if err != nil || tt.wantRejected != nil {
+				t.Fatalf("SendMessage(): got=%v want rejected=%v", err, tt.wantRejected)
+			}
+			if diff := cmp.Diff(tt.wantID, id); diff != "" {
+				t.Errorf("SendMessage(): ID diff=\n %v", diff)
+			}
+		})
+	}
+}
+
+func TestFakeServer(t *testing.T) {
+	srv := emailtest.NewMandrillServer(t)
+	client, err := New(srv.Config())
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+
+	email := emailer.Email{
+		From:        "a@a.com",
+		To:          []string{"b@b.com"},
+		CC:          []string{"cc@cc.com"},
+		BCC:         []string{"bcc@bcc.com"},
+		Subject:     "sub",
+		HTMLContent: "html",
+		Attachments: []emailer.Attachment{
+			{Filename: "logo.png", ContentType: "image/png", ContentID: "logo", Data: []byte("png")},
+			{Filename: "report.csv", ContentType: "text/csv", Data: []byte("a,b")},
+		},
+	}
+	id, err := client.SendMessage(context.Background(), email)
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	if id == "" {
+		t.Error("SendMessage(): message ID is empty")
+	}
+	var got payload
+	if err := json.Unmarshal(srv.LastRequest().Body, &got); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
+	}
+	want := payload{
+		Key: emailtest.FakeKey,
+		Message: message{
+			FromEmail:          "a@a.com",
+			To:                 []recipient{{Email: "b@b.com", Type: "to"}, {Email: "cc@cc.com", Type: "cc"}, {Email: "bcc@bcc.com", Type: "bcc"}},
+			Subject:            "sub",
+			HTML:               "html",
+			PreserveRecipients: true,
+			Attachments:        []attachment{{Type: "text/csv", Name: "report.csv", Content: []byte("a,b")}},
+			Images:             []attachment{{Type: "image/png", Name: "logo", Content: []byte("png")}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SendMessage(): payload diff=\n %v", diff)
+	}
+
+	email.BCC = []string{"bounced@" + emailtest.MandrillRejected}
+	var rejectErr *RejectError
+	if err := client.Send(context.Background(), email); !errors.As(err, &rejectErr) {
+		t.Fatalf("Send(): got=%v want=RejectError", err)
+	}
+	if !errors.Is(rejectErr, emailer.ErrRejected) {
+		t.Errorf("Send(): error %q is not %v", rejectErr, emailer.ErrRejected)
+	}
+	if diff := cmp.Diff("bounced@"+emailtest.MandrillRejected+" rejected(hard-bounce)", strings.TrimPrefix(rejectErr.Error(), "mandrill did not deliver to ")); diff != "" {
+		t.Errorf("Send(): error diff=\n %v", diff)
+	}
+
+	cfg := srv.Config()
+	cfg.Key = "wrong-key"
+	client, err = New(cfg)
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	var statusErr *emailer.StatusError
+	if err := client.Send(context.Background(), email); !errors.As(err, &statusErr) {
+		t.Fatalf("Send(): got=%v want=status error", err)
+	}
+	wantDetail := errorMessage{Status: "error", Code: -1, Name: "Invalid_Key", Message: "Invalid API key"}
+	if diff := cmp.Diff(wantDetail, statusErr.Detail); diff != "" {
+		t.Errorf("Send(): error detail diff=\n %v", diff)
+	}
+}
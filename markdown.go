@@ -0,0 +1,176 @@
+package emailer
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// DefaultMarkdownLayout is the HTML layout that wraps rendered markdown content, it receives [MarkdownLayoutData]
+var DefaultMarkdownLayout = template.Must(template.New("layout").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Subject}}</title>
+</head>
+<body style="margin: 0; padding: 24px; background-color: #f6f6f6; font-family: -apple-system, 'Segoe UI', Helvetica, Arial, sans-serif; font-size: 16px; line-height: 1.5; color: #222222">
+<div style="max-width: 600px; margin: 0 auto; padding: 24px; background-color: #ffffff; border-radius: 4px">
+{{.Body}}
+</div>
+</body>
+</html>
+`))
+
+// MarkdownLayoutData is passed to markdown layouts while rendering
+type MarkdownLayoutData struct {
+	Subject string
+	Body    template.HTML
+}
+
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// RenderMarkdown renders MarkdownContent into HTMLContent wrapped by given layout and into plain TextContent.
+// Nil layout falls back to DefaultMarkdownLayout. Email without MarkdownContent is returned as is.
+func (e Email) RenderMarkdown(layout *template.Template) (Email, error) {
+	if strings.TrimSpace(e.MarkdownContent) == "" {
+		return e, nil
+	}
+	if layout == nil {
+		layout = DefaultMarkdownLayout
+	}
+
+	source := []byte(e.MarkdownContent)
+	doc := markdown.Parser().Parse(text.NewReader(source))
+
+	var body bytes.Buffer
+	if err := markdown.Renderer().Render(&body, source, doc); err != nil {
+		return e, fmt.Errorf("markdown.Renderer().Render(): %v", err)
+	}
+	var h bytes.Buffer
+	data := MarkdownLayoutData{Subject: e.Subject, Body: template.HTML(body.String())} //nolint:gosec //goldmark escapes raw HTML by default
+	if err := layout.Execute(&h, data); err != nil {
+		return e, fmt.Errorf("layout.Execute(): %v", err)
+	}
+
+	var t strings.Builder
+	writePlain(&t, doc, source, "")
+
+	e.HTMLContent = h.String()
+	e.TextContent = strings.TrimSpace(t.String()) + "\n"
+	e.MarkdownContent = ""
+	return e, nil
+}
+
+// writePlain writes plain text representation of markdown node n, prefix is written at the start of every line
+func writePlain(w *strings.Builder, n ast.Node, source []byte, prefix string) {
+	switch n := n.(type) {
+	case *ast.Document:
+		writeBlocks(w, n, source, prefix, false)
+	case *ast.Heading, *ast.Paragraph, *ast.TextBlock:
+		w.WriteString(prefix)
+		writeInlines(w, n, source, prefix)
+		w.WriteString("\n")
+	case *ast.HTMLBlock:
+	case *ast.FencedCodeBlock, *ast.CodeBlock:
+		lines := n.Lines()
+		for i := range lines.Len() {
+			seg := lines.At(i)
+			w.WriteString(prefix)
+			w.Write(seg.Value(source))
+		}
+	case *east.TableHeader, *east.TableRow:
+		w.WriteString(prefix)
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			if c != n.FirstChild() {
+				w.WriteString(" | ")
+			}
+			writeInlines(w, c, source, prefix)
+		}
+		w.WriteString("\n")
+	case *ast.ThematicBreak:
+		w.WriteString(prefix + "---\n")
+	case *ast.Blockquote:
+		writeBlocks(w, n, source, prefix+"> ", false)
+	case *ast.List:
+		i := n.Start
+		for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+			if item != n.FirstChild() && !n.IsTight {
+				w.WriteString(strings.TrimRight(prefix, " ") + "\n")
+			}
+			marker := "- "
+			if n.IsOrdered() {
+				marker = fmt.Sprintf("%d. ", i)
+				i++
+			}
+			var b strings.Builder
+			writeBlocks(&b, item, source, "", n.IsTight)
+			lines := strings.Split(strings.TrimRight(b.String(), "\n"), "\n")
+			for j, line := range lines {
+				if j == 0 {
+					w.WriteString(prefix + marker + line + "\n")
+					continue
+				}
+				w.WriteString(prefix + strings.Repeat(" ", len(marker)) + line + "\n")
+			}
+		}
+	default:
+		writeBlocks(w, n, source, prefix, true)
+	}
+}
+
+// writeBlocks writes children of n as blocks, blocks are separated with an empty line unless they are tight
+func writeBlocks(w *strings.Builder, n ast.Node, source []byte, prefix string, tight bool) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if c != n.FirstChild() && !tight {
+			w.WriteString(strings.TrimRight(prefix, " ") + "\n")
+		}
+		writePlain(w, c, source, prefix)
+	}
+}
+
+// writeInlines writes inline children of n as plain text
+func writeInlines(w *strings.Builder, n ast.Node, source []byte, prefix string) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c := c.(type) {
+		case *ast.Text:
+			w.Write(c.Value(source))
+			if c.SoftLineBreak() || c.HardLineBreak() {
+				w.WriteString("\n" + prefix)
+			}
+		case *ast.String:
+			w.Write(c.Value)
+		case *ast.CodeSpan:
+			w.WriteString("`")
+			writeInlines(w, c, source, prefix)
+			w.WriteString("`")
+		case *ast.Link:
+			var label strings.Builder
+			writeInlines(&label, c, source, prefix)
+			w.WriteString(label.String())
+			if dest := string(c.Destination); dest != label.String() {
+				w.WriteString(" (" + dest + ")")
+			}
+		case *ast.AutoLink:
+			w.Write(c.URL(source))
+		case *ast.Image:
+			writeInlines(w, c, source, prefix)
+		case *east.TaskCheckBox:
+			if c.IsChecked {
+				w.WriteString("[x] ")
+			} else {
+				w.WriteString("[ ] ")
+			}
+		case *ast.RawHTML:
+		default:
+			writeInlines(w, c, source, prefix)
+		}
+	}
+}
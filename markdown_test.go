@@ -0,0 +1,65 @@
+package emailer
+
+import (
+	"html/template"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	layout := template.Must(template.New("layout").Parse(`<h1>{{.Subject}}</h1>{{.Body}}`))
+	tests := []struct {
+		name     string
+		markdown string
+		wantHTML string
+		wantText string
+	}{
+		{
+			name:     "inlines",
+			markdown: "Disk **usage** is at `95%` on [db-1](https://grafana.local/d/1).\nSecond line",
+			wantHTML: "<h1>subj</h1><p>Disk <strong>usage</strong> is at <code>95%</code> on <a href=\"https://grafana.local/d/1\">db-1</a>.\nSecond line</p>\n",
+			wantText: "Disk usage is at `95%` on db-1 (https://grafana.local/d/1).\nSecond line\n",
+		},
+		{
+			name:     "blocks",
+			markdown: "# Alert\n\n- one\n- two\n  1. nested\n\n> quoted\n> more\n\n```\ncode here\n```\n\n| a | b |\n|---|---|\n| 1 | 2 |\n",
+			wantHTML: "<h1>subj</h1><h1>Alert</h1>\n<ul>\n<li>one</li>\n<li>two\n<ol>\n<li>nested</li>\n</ol>\n</li>\n</ul>\n<blockquote>\n<p>quoted\nmore</p>\n</blockquote>\n<pre><code>code here\n</code></pre>\n<table>\n<thead>\n<tr>\n<th>a</th>\n<th>b</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td>1</td>\n<td>2</td>\n</tr>\n</tbody>\n</table>\n",
+			wantText: "Alert\n\n- one\n- two\n  1. nested\n\n> quoted\n> more\n\ncode here\n\na | b\n1 | 2\n",
+		},
+		{
+			name:     "raw html is omitted",
+			markdown: "<script>alert(1)</script>\n\nhi <b>there</b>",
+			wantHTML: "<h1>subj</h1><!-- raw HTML omitted -->\n<p>hi <!-- raw HTML omitted -->there<!-- raw HTML omitted --></p>\n",
+			wantText: "hi there\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Email{Subject: "subj", MarkdownContent: tt.markdown}.RenderMarkdown(layout)
+			if err != nil {
+				t.Fatalf("RenderMarkdown(): %v", err)
+			}
+			if diff := cmp.Diff(tt.wantHTML, got.HTMLContent); diff != "" {
+				t.Errorf("RenderMarkdown(): HTML diff=\n %v", diff)
+			}
+			if diff := cmp.Diff(tt.wantText, got.TextContent); diff != "" {
+				t.Errorf("RenderMarkdown(): text diff=\n %v", diff)
+			}
+			if got.MarkdownContent != "" {
+				t.Errorf("RenderMarkdown(): markdown content is not cleared")
+			}
+		})
+	}
+}
+
+func TestRenderMarkdown_NoMarkdown(t *testing.T) {
+	e := Email{Subject: "subj", HTMLContent: "html"}
+	got, err := e.RenderMarkdown(nil)
+	if err != nil {
+		t.Fatalf("RenderMarkdown(): %v", err)
+	}
+	if diff := cmp.Diff(e, got); diff != "" {
+		t.Errorf("RenderMarkdown(): diff=\n %v", diff)
+	}
+}
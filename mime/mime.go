@@ -0,0 +1,392 @@
+// Package mime builds RFC 5322 messages out of emails, for senders that hand over whole messages such as SMTP, sendmail or .eml files.
+//
+// Example usage:
+//
+//	 raw, err := mime.New(email).
+//		Attach(mime.Attachment{Filename: "invoice.pdf", Data: pdf}).
+//		Build()
+//		if err != nil {
+//			//check err
+//		}
+package mime
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	stdmime "mime"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mrwormhole/emailer"
+)
+
+const (
+	// maxLineLength is the line length that encoded bodies and folded headers are kept under, see RFC 5322 section 2.1.1
+	maxLineLength = 76
+	// crlf is the line break of messages
+	crlf = "\r\n"
+)
+
+// Attachment is a file attached to a message, it is shown inline when it has a content ID
+type Attachment = emailer.Attachment
+
+// header is a single header field of an entity
+type header struct {
+	key, value string
+}
+
+// entity is a leaf part with an encoded body or a multipart container of other entities
+type entity struct {
+	headers  []header
+	body     []byte
+	boundary string
+	parts    []entity
+}
+
+// Builder builds a message out of an email
+type Builder struct {
+	email       emailer.Email
+	attachments []Attachment
+	messageID   string
+	date        time.Time
+	keepBCC     bool
+	headers     []header
+}
+
+// New creates a builder for e with its attachments, markdown content is rendered with the default layout unless it is rendered already
+func New(e emailer.Email) *Builder {
+	return &Builder{email: e, attachments: slices.Clone(e.Attachments)}
+}
+
+// Attach adds attachments, the ones with a content ID are placed next to the HTML content as inline parts
+func (b *Builder) Attach(a ...Attachment) *Builder {
+	b.attachments = append(b.attachments, a...)
+	return b
+}
+
+// MessageID sets Message-ID header, a new one under the sender domain is generated when it is not set
+func (b *Builder) MessageID(id string) *Builder {
+	b.messageID = id
+	return b
+}
+
+// Date sets Date header, the build time is used when it is not set
+func (b *Builder) Date(t time.Time) *Builder {
+	b.date = t
+	return b
+}
+
+// KeepBCC keeps Bcc header in the message for archives and sendmail -t, it is left out otherwise since every recipient would see it
+func (b *Builder) KeepBCC() *Builder {
+	b.keepBCC = true
+	return b
+}
+
+// Header adds an extra header such as Reply-To, non-ASCII values are encoded
+func (b *Builder) Header(key, value string) *Builder {
+	b.headers = append(b.headers, header{key: key, value: value})
+	return b
+}
+
+// Build returns the message
+func (b *Builder) Build() ([]byte, error) {
+	e, err := b.email.RenderMarkdown(nil)
+	if err != nil {
+		return nil, fmt.Errorf("email.RenderMarkdown(): %v", err)
+	}
+	if e.TextContent == "" && e.HTMLContent == "" {
+		return nil, errors.New("message has no text or HTML content")
+	}
+
+	var top []header
+	add := func(key, value string) {
+		if value != "" {
+			top = append(top, header{key: key, value: value})
+		}
+	}
+	id := b.messageID
+	if id == "" {
+		id = NewMessageID(e.From)
+	}
+	date := b.date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	add("Message-ID", id)
+	add("Date", date.Format(time.RFC1123Z))
+	for _, f := range []struct {
+		key   string
+		addrs []string
+	}{{"From", []string{e.From}}, {"To", e.To}, {"Cc", e.CC}, {"Bcc", e.BCC}} {
+		if f.key == "Bcc" && !b.keepBCC {
+			continue
+		}
+		v, err := formatAddresses(f.addrs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.key, err)
+		}
+		add(f.key, v)
+	}
+	add("Subject", encodeWord(e.Subject))
+	for _, h := range b.headers {
+		if strings.ContainsAny(h.key, ":\r\n ") {
+			return nil, fmt.Errorf("header key %q is not valid", h.key)
+		}
+		add(h.key, encodeWord(h.value))
+	}
+	add("MIME-Version", "1.0")
+	for _, h := range top {
+		if strings.ContainsAny(h.value, "\r\n") {
+			return nil, fmt.Errorf("%s header contains a line break", h.key)
+		}
+	}
+
+	body, err := b.body(e)
+	if err != nil {
+		return nil, err
+	}
+	body.headers = append(top, body.headers...)
+
+	var buf bytes.Buffer
+	body.write(&buf)
+	return buf.Bytes(), nil
+}
+
+// body returns the body entity, which is multipart/mixed around multipart/alternative around multipart/related as needed
+func (b *Builder) body(e emailer.Email) (entity, error) {
+	var inline, attached []entity
+	for _, a := range b.attachments {
+		part, err := attachment(a)
+		if err != nil {
+			return entity{}, err
+		}
+		if a.ContentID != "" {
+			inline = append(inline, part)
+			continue
+		}
+		attached = append(attached, part)
+	}
+
+	var content entity
+	var html entity
+	if e.HTMLContent != "" {
+		html = text("text/html", e.HTMLContent)
+		if len(inline) > 0 {
+			html = container("related", append([]entity{html}, inline...))
+		}
+	}
+	switch {
+	case e.TextContent != "" && e.HTMLContent != "":
+		content = container("alternative", []entity{text("text/plain", e.TextContent), html})
+	case e.HTMLContent != "":
+		content = html
+	default:
+		content = text("text/plain", e.TextContent)
+	}
+
+	if len(attached) == 0 {
+		return content, nil
+	}
+	return container("mixed", append([]entity{content}, attached...)), nil
+}
+
+// NewMessageID creates a unique Message-ID under the domain of from address
+func NewMessageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if _, d, ok := strings.Cut(addr.Address, "@"); ok && d != "" {
+			domain = d
+		}
+	}
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), strings.ToLower(rand.Text()), domain)
+}
+
+// text creates a text part of given media type, it picks the transfer encoding that keeps the body smallest and readable
+func text(mediaType, s string) entity {
+	headers := []header{{"Content-Type", mediaType + "; charset=utf-8"}}
+	switch {
+	case is7bit(s):
+		headers = append(headers, header{"Content-Transfer-Encoding", "7bit"})
+		return entity{headers: headers, body: []byte(strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", crlf))}
+	case nonASCIIRatio(s) > 1.0/3:
+		headers = append(headers, header{"Content-Transfer-Encoding", "base64"})
+		return entity{headers: headers, body: encodeBase64([]byte(s))}
+	default:
+		headers = append(headers, header{"Content-Transfer-Encoding", "quoted-printable"})
+		return entity{headers: headers, body: encodeQP(s)}
+	}
+}
+
+// attachment creates a base64 part of a
+func attachment(a Attachment) (entity, error) {
+	if strings.TrimSpace(a.Filename) == "" {
+		return entity{}, errors.New("attachment filename is blank")
+	}
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = stdmime.TypeByExtension(filepath.Ext(a.Filename))
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(a.Data)
+	}
+	mediaType, params, err := stdmime.ParseMediaType(contentType)
+	if err != nil {
+		return entity{}, fmt.Errorf("mime.ParseMediaType(%q): %v", contentType, err)
+	}
+	params["name"] = a.Filename
+
+	disposition := "attachment"
+	headers := []header{{"Content-Type", stdmime.FormatMediaType(mediaType, params)}}
+	if a.ContentID != "" {
+		disposition = "inline"
+		headers = append(headers, header{"Content-ID", "<" + strings.Trim(a.ContentID, "<>") + ">"})
+	}
+	headers = append(headers,
+		header{"Content-Disposition", stdmime.FormatMediaType(disposition, map[string]string{"filename": a.Filename})},
+		header{"Content-Transfer-Encoding", "base64"},
+	)
+	for _, h := range headers {
+		if h.value == "" || strings.ContainsAny(h.value, "\r\n") {
+			return entity{}, fmt.Errorf("attachment %q has invalid %s", a.Filename, h.key)
+		}
+	}
+	return entity{headers: headers, body: encodeBase64(a.Data)}, nil
+}
+
+// container creates a multipart container of given subtype
+func container(subtype string, parts []entity) entity {
+	boundary := "=_" + rand.Text()
+	return entity{
+		headers:  []header{{"Content-Type", fmt.Sprintf("multipart/%s; boundary=%q", subtype, boundary)}},
+		boundary: boundary,
+		parts:    parts,
+	}
+}
+
+// write writes headers and body of the entity
+func (e entity) write(w *bytes.Buffer) {
+	for _, h := range e.headers {
+		w.WriteString(fold(h.key + ": " + h.value))
+		w.WriteString(crlf)
+	}
+	w.WriteString(crlf)
+	if e.parts == nil {
+		w.Write(e.body)
+		return
+	}
+
+	for _, p := range e.parts {
+		w.WriteString("--" + e.boundary + crlf)
+		p.write(w)
+		// the line break before a boundary belongs to the boundary, so part bodies keep their own last line break
+		w.WriteString(crlf)
+	}
+	w.WriteString("--" + e.boundary + "--" + crlf)
+}
+
+// formatAddresses formats addrs as an address list, non-ASCII display names are encoded
+func formatAddresses(addrs []string) (string, error) {
+	var formatted []string
+	for _, a := range addrs {
+		if strings.TrimSpace(a) == "" {
+			continue
+		}
+		addr, err := mail.ParseAddress(a)
+		if err != nil {
+			return "", fmt.Errorf("mail.ParseAddress(%q): %v", a, err)
+		}
+		if addr.Name == "" {
+			formatted = append(formatted, addr.Address)
+			continue
+		}
+		formatted = append(formatted, addr.String())
+	}
+	return strings.Join(formatted, ", "), nil
+}
+
+// encodeWord encodes s as RFC 2047 encoded words when it is not printable ASCII
+func encodeWord(s string) string {
+	if nonASCIIRatio(s) > 1.0/3 {
+		return stdmime.BEncoding.Encode("utf-8", s)
+	}
+	return stdmime.QEncoding.Encode("utf-8", s)
+}
+
+// fold folds a header line at spaces, so its lines stay under the maximum length where possible
+func fold(line string) string {
+	if len(line) <= maxLineLength {
+		return line
+	}
+	var b strings.Builder
+	lineLen := 0
+	for i, word := range strings.Split(line, " ") {
+		if i > 0 {
+			if lineLen+1+len(word) > maxLineLength {
+				b.WriteString(crlf)
+				lineLen = 0
+			}
+			b.WriteString(" ")
+			lineLen++
+		}
+		b.WriteString(word)
+		lineLen += len(word)
+	}
+	return b.String()
+}
+
+// is7bit reports whether s can be sent without any transfer encoding
+func is7bit(s string) bool {
+	for line := range strings.Lines(s) {
+		if len(strings.TrimRight(line, "\r\n")) > maxLineLength {
+			return false
+		}
+	}
+	return !strings.ContainsFunc(s, func(r rune) bool {
+		return r > '~' || (r < ' ' && r != '\n' && r != '\r' && r != '\t')
+	})
+}
+
+// nonASCIIRatio returns the ratio of non-ASCII runes in s
+func nonASCIIRatio(s string) float64 {
+	n := utf8.RuneCountInString(s)
+	if n == 0 {
+		return 0
+	}
+	count := 0
+	for _, r := range s {
+		if r > '~' {
+			count++
+		}
+	}
+	return float64(count) / float64(n)
+}
+
+// encodeQP encodes s as quoted-printable with CRLF line breaks
+func encodeQP(s string) []byte {
+	var b bytes.Buffer
+	qp := quotedprintable.NewWriter(&b)
+	_, _ = io.WriteString(qp, s)
+	_ = qp.Close()
+	return b.Bytes()
+}
+
+// encodeBase64 encodes data as base64 wrapped at the maximum line length
+func encodeBase64(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b bytes.Buffer
+	for chunk := range slices.Chunk([]byte(encoded), maxLineLength) {
+		b.Write(chunk)
+		b.WriteString(crlf)
+	}
+	return b.Bytes()
+}
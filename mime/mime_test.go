@@ -0,0 +1,271 @@
+package mime
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	stdmime "mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+)
+
+// structure returns the media type tree of an entity, with decoded text bodies
+func structure(t *testing.T, contentType, encoding string, body io.Reader) string {
+	t.Helper()
+	mediaType, params, err := stdmime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatalf("mime.ParseMediaType(%q): %v", contentType, err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		switch encoding {
+		case "base64":
+			body = base64.NewDecoder(base64.StdEncoding, body)
+		case "quoted-printable":
+			body = quotedprintable.NewReader(body)
+		}
+		raw, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("io.ReadAll(): %v", err)
+		}
+		if strings.HasPrefix(mediaType, "text/") {
+			return mediaType + "(" + string(raw) + ")"
+		}
+		return mediaType
+	}
+
+	var parts []string
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := mr.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("mr.NextRawPart(): %v", err)
+		}
+		parts = append(parts, structure(t, p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p))
+	}
+	return mediaType + "[" + strings.Join(parts, ",") + "]"
+}
+
+func TestBuild(t *testing.T) {
+	email := emailer.Email{
+		From:        "Jöhn <a@a.com>",
+		To:          []string{"b@b.com", "Ünal <c@c.com>"},
+		BCC:         []string{"bcc@bcc.com"},
+		Subject:     "héllo",
+		TextContent: "text",
+		HTMLContent: `<img src="cid:logo">`,
+	}
+	pdf := Attachment{Filename: "invoice.pdf", Data: []byte("%PDF-1.4")}
+	logo := Attachment{Filename: "logo.png", ContentID: "logo", Data: []byte("\x89PNG\r\n\x1a\n")}
+
+	tests := []struct {
+		name        string
+		email       emailer.Email
+		attachments []Attachment
+		want        string
+	}{
+		{
+			name:  "text only",
+			email: emailer.Email{From: "a@a.com", To: []string{"b@b.com"}, Subject: "sub", TextContent: "text"},
+			want:  "text/plain(text)",
+		},
+		{
+			name:  "alternative",
+			email: email,
+			want:  `multipart/alternative[text/plain(text),text/html(<img src="cid:logo">)]`,
+		},
+		{
+			name:        "related",
+			email:       emailer.Email{From: "a@a.com", To: []string{"b@b.com"}, Subject: "sub", HTMLContent: "html"},
+			attachments: []Attachment{logo},
+			want:        "multipart/related[text/html(html),image/png]",
+		},
+		{
+			name:        "mixed",
+			email:       email,
+			attachments: []Attachment{pdf, logo},
+			want:        `multipart/mixed[multipart/alternative[text/plain(text),multipart/related[text/html(<img src="cid:logo">),image/png]],application/pdf]`,
+		},
+		{
+			name:  "non-ASCII text",
+			email: emailer.Email{From: "a@a.com", To: []string{"b@b.com"}, Subject: "sub", TextContent: "こんにちは世界", HTMLContent: "<p>héllo</p>"},
+			want:  "multipart/alternative[text/plain(こんにちは世界),text/html(<p>héllo</p>)]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := New(tt.email).Attach(tt.attachments...).Build()
+			if err != nil {
+				t.Fatalf("Build(): %v", err)
+			}
+			msg, err := mail.ReadMessage(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatalf("mail.ReadMessage(): %v", err)
+			}
+			got := structure(t, msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Build(): structure diff=\n %v", diff)
+			}
+		})
+	}
+}
+
+func TestBuild_Headers(t *testing.T) {
+	email := emailer.Email{
+		From:        "Jöhn <a@a.com>",
+		To:          []string{"b@b.com", "Ünal <c@c.com>"},
+		BCC:         []string{"bcc@bcc.com"},
+		Subject:     "héllo wörld",
+		TextContent: "text",
+	}
+	date := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		builder *Builder
+		want    map[string]string
+	}{
+		{
+			name:    "default",
+			builder: New(email).MessageID("<id@a.com>").Date(date),
+			want: map[string]string{
+				"Message-Id": "<id@a.com>",
+				"Date":       "Fri, 02 Jan 2026 03:04:05 +0000",
+				"From":       "Jöhn <a@a.com>",
+				"To":         "b@b.com, Ünal <c@c.com>",
+				"Bcc":        "",
+				"Subject":    "héllo wörld",
+				"Reply-To":   "",
+			},
+		},
+		{
+			name:    "keep bcc and extra header",
+			builder: New(email).MessageID("<id@a.com>").Date(date).KeepBCC().Header("Reply-To", "reply@a.com"),
+			want: map[string]string{
+				"Message-Id": "<id@a.com>",
+				"Date":       "Fri, 02 Jan 2026 03:04:05 +0000",
+				"From":       "Jöhn <a@a.com>",
+				"To":         "b@b.com, Ünal <c@c.com>",
+				"Bcc":        "bcc@bcc.com",
+				"Subject":    "héllo wörld",
+				"Reply-To":   "reply@a.com",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := tt.builder.Build()
+			if err != nil {
+				t.Fatalf("Build(): %v", err)
+			}
+			if !isASCII(raw) {
+				t.Errorf("Build(): message has non-ASCII bytes")
+			}
+			msg, err := mail.ReadMessage(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatalf("mail.ReadMessage(): %v", err)
+			}
+
+			dec := new(stdmime.WordDecoder)
+			got := make(map[string]string)
+			for k := range tt.want {
+				v, err := dec.DecodeHeader(msg.Header.Get(k))
+				if err != nil {
+					t.Fatalf("DecodeHeader(%q): %v", k, err)
+				}
+				got[k] = v
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Build(): headers diff=\n %v", diff)
+			}
+		})
+	}
+}
+
+func TestBuild_LongLines(t *testing.T) {
+	email := emailer.Email{
+		From:        "a@a.com",
+		To:          []string{"b@b.com", "c@c.com", "d@d.com", "e@e.com", "f@f.com", "g@g.com", "h@h.com", "i@i.com", "j@j.com"},
+		Subject:     strings.Repeat("ünïcödé ", 20),
+		TextContent: strings.Repeat("word ", 100),
+	}
+	raw, err := New(email).Attach(Attachment{Filename: "data.bin", Data: bytes.Repeat([]byte{0xff}, 500)}).Build()
+	if err != nil {
+		t.Fatalf("Build(): %v", err)
+	}
+	for line := range strings.Lines(string(raw)) {
+		if !strings.HasSuffix(line, "\r\n") && strings.HasSuffix(line, "\n") {
+			t.Errorf("Build(): line %q does not end with CRLF", line)
+		}
+		if len(strings.TrimRight(line, "\r\n")) > maxLineLength+2 {
+			t.Errorf("Build(): line %q is longer than %d", line, maxLineLength)
+		}
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("mail.ReadMessage(): %v", err)
+	}
+	subject, err := new(stdmime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("DecodeHeader(): %v", err)
+	}
+	if diff := cmp.Diff(strings.TrimSpace(email.Subject), strings.TrimSpace(subject)); diff != "" {
+		t.Errorf("Build(): subject diff=\n %v", diff)
+	}
+}
+
+func TestBuild_HeaderInjection(t *testing.T) {
+	email := emailer.Email{From: "a@a.com", To: []string{"b@b.com"}, Subject: "sub\r\nBcc: evil@evil.com", TextContent: "text"}
+	raw, err := New(email).Header("X-Campaign", "c\r\nBcc: evil@evil.com").Build()
+	if err != nil {
+		t.Fatalf("Build(): %v", err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("mail.ReadMessage(): %v", err)
+	}
+	if bcc := msg.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("Build(): injected Bcc header %q", bcc)
+	}
+}
+
+func TestBuild_Invalid(t *testing.T) {
+	email := emailer.Email{From: "a@a.com", To: []string{"b@b.com"}, Subject: "sub", TextContent: "text"}
+	tests := []struct {
+		name    string
+		builder *Builder
+	}{
+		{name: "no content", builder: New(emailer.Email{From: "a@a.com", To: []string{"b@b.com"}})},
+		{name: "invalid address", builder: New(emailer.Email{From: "a@a.com", To: []string{"b@b.com\r\nBcc: evil@evil.com"}, TextContent: "text"})},
+		{name: "invalid header key", builder: New(email).Header("Reply To", "a@a.com")},
+		{name: "blank attachment filename", builder: New(email).Attach(Attachment{Data: []byte("data")})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.builder.Build(); err == nil {
+				t.Error("Build(): expected error, got nil")
+			}
+		})
+	}
+}
+
+// isASCII reports whether b is 7-bit ASCII
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c > 127 {
+			return false
+		}
+	}
+	return true
+}
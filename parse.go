@@ -0,0 +1,178 @@
+package emailer
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// maxMIMEDepth is how deep multipart entities can nest, real messages rarely go beyond 4
+const maxMIMEDepth = 16
+
+// wordDecoder decodes RFC 2047 encoded words of any charset
+var wordDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+// ParseMIME parses a raw RFC 5322 message into an email.
+// The first text/plain and text/html parts become the content, other parts become attachments
+// and the ones with a content ID stay inline.
+func ParseMIME(r io.Reader) (Email, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return Email{}, fmt.Errorf("mail.ReadMessage(): %v", err)
+	}
+
+	var e Email
+	from, err := addresses(msg.Header, "From")
+	if err != nil {
+		return Email{}, err
+	}
+	if len(from) > 0 {
+		e.From = from[0]
+	}
+	if e.To, err = addresses(msg.Header, "To"); err != nil {
+		return Email{}, err
+	}
+	if e.CC, err = addresses(msg.Header, "Cc"); err != nil {
+		return Email{}, err
+	}
+	if e.BCC, err = addresses(msg.Header, "Bcc"); err != nil {
+		return Email{}, err
+	}
+	if e.Subject, err = wordDecoder.DecodeHeader(msg.Header.Get("Subject")); err != nil {
+		return Email{}, fmt.Errorf("wordDecoder.DecodeHeader(Subject): %v", err)
+	}
+
+	if err := parseEntity(&e, textproto.MIMEHeader(msg.Header), msg.Body, 0); err != nil {
+		return Email{}, err
+	}
+	return e, nil
+}
+
+// addresses returns bare addresses of the address list header, none when the header is missing
+func addresses(h mail.Header, key string) ([]string, error) {
+	if h.Get(key) == "" {
+		return nil, nil
+	}
+	list, err := (&mail.AddressParser{WordDecoder: wordDecoder}).ParseList(h.Get(key))
+	if err != nil {
+		return nil, fmt.Errorf("mail.ParseList(%s): %v", key, err)
+	}
+	addrs := make([]string, 0, len(list))
+	for _, a := range list {
+		addrs = append(addrs, a.Address)
+	}
+	return addrs, nil
+}
+
+// parseEntity walks the entity with given header and body, it fills content and attachments of e
+func parseEntity(e *Email, h textproto.MIMEHeader, body io.Reader, depth int) error {
+	if depth > maxMIMEDepth {
+		return fmt.Errorf("MIME entities are nested deeper than %d", maxMIMEDepth)
+	}
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain; charset=us-ascii"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("mime.ParseMediaType(%q): %v", contentType, err)
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("mr.NextRawPart(): %v", err)
+			}
+			if err := parseEntity(e, p.Header, p, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(decodeTransfer(h.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return fmt.Errorf("io.ReadAll(): %v", err)
+	}
+	disposition, dispParams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := cmp.Or(dispParams["filename"], params["name"])
+	if filename != "" {
+		if filename, err = wordDecoder.DecodeHeader(filename); err != nil {
+			return fmt.Errorf("wordDecoder.DecodeHeader(filename): %v", err)
+		}
+	}
+
+	isText := mediaType == "text/plain" || mediaType == "text/html"
+	if isText && disposition != "attachment" && filename == "" {
+		text, err := decodeCharset(data, params["charset"])
+		if err != nil {
+			return err
+		}
+		switch {
+		case mediaType == "text/plain" && e.TextContent == "":
+			e.TextContent = text
+			return nil
+		case mediaType == "text/html" && e.HTMLContent == "":
+			e.HTMLContent = text
+			return nil
+		}
+	}
+
+	if filename == "" {
+		exts, _ := mime.ExtensionsByType(mediaType)
+		filename = fmt.Sprintf("part-%d", len(e.Attachments)+1)
+		if len(exts) > 0 {
+			filename += exts[0]
+		}
+	}
+	e.Attachments = append(e.Attachments, Attachment{
+		Filename:    filename,
+		ContentType: mediaType,
+		ContentID:   strings.Trim(h.Get("Content-Id"), "<> "),
+		Data:        data,
+	})
+	return nil
+}
+
+// decodeTransfer decodes body of given Content-Transfer-Encoding, unknown encodings are read as they are
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// decodeCharset converts text of given charset into UTF-8
+func decodeCharset(data []byte, label string) (string, error) {
+	if label == "" || strings.EqualFold(label, "utf-8") || strings.EqualFold(label, "us-ascii") {
+		return string(data), nil
+	}
+	r, err := charset.NewReaderLabel(label, bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("charset.NewReaderLabel(%q): %v", label, err)
+	}
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("io.ReadAll(): %v", err)
+	}
+	return string(text), nil
+}
@@ -0,0 +1,130 @@
+package emailer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseMIME(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want Email
+	}{
+		{
+			name: "plain text",
+			raw: "From: John <a@a.com>\r\n" +
+				"To: b@b.com, \"Ünal\" <c@c.com>\r\n" +
+				"Cc: cc@cc.com\r\n" +
+				"Subject: =?utf-8?q?h=C3=A9llo?=\r\n" +
+				"\r\n" +
+				"text\r\n",
+			want: Email{
+				From:        "a@a.com",
+				To:          []string{"b@b.com", "c@c.com"},
+				CC:          []string{"cc@cc.com"},
+				Subject:     "héllo",
+				TextContent: "text\r\n",
+			},
+		},
+		{
+			name: "alternative with legacy charset",
+			raw: "From: a@a.com\r\n" +
+				"To: b@b.com\r\n" +
+				"Subject: =?iso-8859-1?q?caf=E9?=\r\n" +
+				"MIME-Version: 1.0\r\n" +
+				"Content-Type: multipart/alternative; boundary=\"b1\"\r\n" +
+				"\r\n" +
+				"--b1\r\n" +
+				"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+				"Content-Transfer-Encoding: quoted-printable\r\n" +
+				"\r\n" +
+				"caf=E9\r\n" +
+				"--b1\r\n" +
+				"Content-Type: text/html; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"\r\n" +
+				"PHA+Y2Fmw6k8L3A+\r\n" +
+				"--b1--\r\n",
+			want: Email{
+				From:        "a@a.com",
+				To:          []string{"b@b.com"},
+				Subject:     "café",
+				TextContent: "café",
+				HTMLContent: "<p>café</p>",
+			},
+		},
+		{
+			name: "attachments and inline parts",
+			raw: "From: a@a.com\r\n" +
+				"To: b@b.com\r\n" +
+				"Bcc: bcc@bcc.com\r\n" +
+				"Subject: files\r\n" +
+				"MIME-Version: 1.0\r\n" +
+				"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+				"\r\n" +
+				"--b1\r\n" +
+				"Content-Type: multipart/related; boundary=\"b2\"\r\n" +
+				"\r\n" +
+				"--b2\r\n" +
+				"Content-Type: text/html\r\n" +
+				"\r\n" +
+				"<img src=\"cid:logo\">\r\n" +
+				"--b2\r\n" +
+				"Content-Type: image/png\r\n" +
+				"Content-ID: <logo>\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"\r\n" +
+				"iVBORw==\r\n" +
+				"--b2--\r\n" +
+				"--b1\r\n" +
+				"Content-Type: text/plain; name=\"notes.txt\"\r\n" +
+				"Content-Disposition: attachment; filename*=utf-8''n%C3%B6tes.txt\r\n" +
+				"\r\n" +
+				"attached text\r\n" +
+				"--b1--\r\n",
+			want: Email{
+				From:        "a@a.com",
+				To:          []string{"b@b.com"},
+				BCC:         []string{"bcc@bcc.com"},
+				Subject:     "files",
+				HTMLContent: "<img src=\"cid:logo\">",
+				Attachments: []Attachment{
+					{Filename: "part-1.png", ContentType: "image/png", ContentID: "logo", Data: []byte("\x89PNG")},
+					{Filename: "nötes.txt", ContentType: "text/plain", Data: []byte("attached text")},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMIME(strings.NewReader(tt.raw))
+			if err != nil {
+				t.Fatalf("ParseMIME(): %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("ParseMIME(): diff=\n %v", diff)
+			}
+		})
+	}
+}
+
+func TestParseMIME_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "no headers", raw: "just text"},
+		{name: "invalid address", raw: "From: a@a.com\r\nTo: <<b@b.com\r\n\r\ntext"},
+		{name: "invalid content type", raw: "From: a@a.com\r\nContent-Type: text/plain; =\r\n\r\ntext"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseMIME(strings.NewReader(tt.raw)); err == nil {
+				t.Error("ParseMIME(): expected error, got nil")
+			}
+		})
+	}
+}
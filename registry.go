@@ -0,0 +1,66 @@
+package emailer
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownProvider is returned by Open when no provider is registered with the name
+var ErrUnknownProvider = errors.New("unknown provider")
+
+// Factory creates a sender of a provider from given config
+type Factory func(c Config) (Sender, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a provider available by name to Open, names are case-insensitive.
+// Provider packages register themselves when they are imported, like database/sql drivers.
+// It panics when factory is nil or name is already registered
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	name = strings.ToLower(name)
+	if factory == nil {
+		panic("emailer: Register factory is nil for provider " + name)
+	}
+	if _, dup := factories[name]; dup {
+		panic("emailer: Register called twice for provider " + name)
+	}
+	factories[name] = factory
+}
+
+// Open creates a sender of the provider registered with given name, its package must be imported to register it
+func Open(name string, c Config) (Sender, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[strings.ToLower(name)]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, name)
+	}
+	return factory(c)
+}
+
+// Providers returns the sorted names of registered providers
+func Providers() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	return slices.Sorted(maps.Keys(factories))
+}
+
+// FactoryOf adapts the constructor of a provider to Factory, so a failed constructor never yields a non-nil sender
+func FactoryOf[S Sender](newFunc func(c Config) (S, error)) Factory {
+	return func(c Config) (Sender, error) {
+		s, err := newFunc(c)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+}
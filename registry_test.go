@@ -0,0 +1,79 @@
+package emailer
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// keySender is a sender that needs a key
+type keySender struct {
+	key string
+}
+
+func (s *keySender) Send(context.Context, Email) error {
+	return nil
+}
+
+func newKeySender(c Config) (*keySender, error) {
+	if c.Key == "" {
+		return nil, errors.New("key is blank")
+	}
+	return &keySender{key: c.Key}, nil
+}
+
+func TestRegistry(t *testing.T) {
+	Register("Registry-Test", FactoryOf(newKeySender))
+
+	sender, err := Open("registry-test", Config{Key: "key"})
+	if err != nil {
+		t.Fatalf("Open(): %v", err)
+	}
+	if diff := cmp.Diff(&keySender{key: "key"}, sender, cmp.AllowUnexported(keySender{})); diff != "" {
+		t.Errorf("Open(): diff=\n %v", diff)
+	}
+
+	sender, err = Open("REGISTRY-TEST", Config{})
+	if err == nil || sender != nil {
+		t.Errorf("Open(): got=(%v, %v) want=(nil, error) for a failed factory", sender, err)
+	}
+
+	if _, err := Open("registry-missing", Config{}); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Open(): got=%v want=%v", err, ErrUnknownProvider)
+	}
+
+	providers := Providers()
+	if !slices.IsSorted(providers) {
+		t.Errorf("Providers(): %v is not sorted", providers)
+	}
+	if !slices.Contains(providers, "registry-test") {
+		t.Errorf("Providers(): %v does not contain %q", providers, "registry-test")
+	}
+}
+
+func TestRegister_Panics(t *testing.T) {
+	Register("registry-dup", FactoryOf(newKeySender))
+
+	tests := []struct {
+		name    string
+		factory Factory
+		regName string
+	}{
+		{name: "duplicate", regName: "Registry-Dup", factory: FactoryOf(newKeySender)},
+		{name: "nil factory", regName: "registry-nil"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register(%q): expected panic", tt.regName)
+				}
+			}()
+			Register(tt.regName, tt.factory)
+		})
+	}
+}
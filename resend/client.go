@@ -19,24 +19,43 @@ package resend
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
 	"net/http"
-	"net/http/httputil"
+	"net/url"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/mrwormhole/emailer"
 )
 
-const endpoint = "https://api.resend.com/emails"
+const (
+	baseURL    = "https://api.resend.com"
+	emailsPath = "/emails"
+)
+
+// Capabilities describes what resend can honour of an email
+var Capabilities = emailer.Capabilities{
+	// resend limits an email to 50 recipients and 40MB once attachments are base64 encoded
+	MaxRecipients:     50,
+	MaxAttachmentSize: 30 << 20,
+	InlineAttachments: true,
+	// resend schedules emails up to 30 days ahead
+	ScheduleHorizon: 30 * 24 * time.Hour,
+}
 
 // EmailClient is resend email client to interact with emails
 type EmailClient struct {
-	key    string
-	client http.Client
+	key            string
+	baseURL        string
+	markdownLayout *template.Template
+	client         http.Client
 }
 
 // New creates a new resend email client with given API key and http.Client
@@ -45,21 +64,48 @@ func New(c emailer.Config) (*EmailClient, error) {
 		return nil, errors.New("resend API key is blank")
 	}
 	e := &EmailClient{
-		key:    c.Key,
-		client: c.Client,
+		key:            c.Key,
+		baseURL:        cmp.Or(strings.TrimSuffix(c.BaseURL, "/"), baseURL),
+		markdownLayout: c.MarkdownLayout,
+		client:         c.Client,
 	}
 	return e, nil
 }
 
+func init() {
+	emailer.Register("resend", emailer.FactoryOf(New))
+}
+
+// Capabilities returns what resend can honour of an email
+func (c *EmailClient) Capabilities() emailer.Capabilities {
+	return Capabilities
+}
+
 // payload is a request that resend uses to send email
 type payload struct {
-	From        string   `json:"from"`
-	To          []string `json:"to"`
-	BCC         []string `json:"bcc"`
-	CC          []string `json:"cc"`
-	Subject     string   `json:"subject"`
-	HTMLContent string   `json:"html,omitempty"`
-	TextContent string   `json:"text,omitempty"`
+	From        string       `json:"from"`
+	To          []string     `json:"to"`
+	BCC         []string     `json:"bcc"`
+	CC          []string     `json:"cc"`
+	Subject     string       `json:"subject"`
+	HTMLContent string       `json:"html,omitempty"`
+	TextContent string       `json:"text,omitempty"`
+	ScheduledAt string       `json:"scheduled_at,omitempty"`
+	Attachments []attachment `json:"attachments,omitempty"`
+}
+
+// attachment is a file of resend email, the ones with content ID are inline
+type attachment struct {
+	// Content is base64 encoded by JSON
+	Content     []byte `json:"content"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"`
+	ContentID   string `json:"content_id,omitempty"`
+}
+
+// result is a response when resend accepts an email
+type result struct {
+	ID string `json:"id"`
 }
 
 type errorMessage struct {
@@ -70,6 +116,20 @@ type errorMessage struct {
 
 // Send sends a given email
 func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
+	_, err := c.SendMessage(ctx, email)
+	return err
+}
+
+// SendMessage sends a given email and returns its resend ID
+func (c *EmailClient) SendMessage(ctx context.Context, email emailer.Email) (string, error) {
+	if err := c.Capabilities().Check(email); err != nil {
+		return "", err
+	}
+	email, err := email.RenderMarkdown(c.markdownLayout)
+	if err != nil {
+		return "", fmt.Errorf("email.RenderMarkdown(): %v", err)
+	}
+
 	var p payload
 	p.From = email.From
 	p.To = append(p.To, email.To...)
@@ -78,12 +138,48 @@ func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
 	p.Subject = email.Subject
 	p.HTMLContent = email.HTMLContent
 	p.TextContent = email.TextContent
+	for _, a := range email.Attachments {
+		p.Attachments = append(p.Attachments, attachment{Content: a.Data, Filename: a.Filename, ContentType: a.ContentType, ContentID: a.ContentID})
+	}
 
-	raw, err := json.Marshal(p)
-	if err != nil {
-		return fmt.Errorf("json.Marshal(%v): %v", p, err)
+	if !email.SendAt.IsZero() {
+		p.ScheduledAt = email.SendAt.UTC().Format(time.RFC3339)
+	}
+
+	var r result
+	if err := c.do(ctx, http.MethodPost, c.baseURL+emailsPath, p, &r); err != nil {
+		return "", err
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(raw))
+	return r.ID, nil
+}
+
+// Cancel cancels a scheduled email by its resend ID
+func (c *EmailClient) Cancel(ctx context.Context, messageID string) error {
+	return emailer.NotFound(c.do(ctx, http.MethodPost, c.baseURL+emailsPath+"/"+url.PathEscape(messageID)+"/cancel", nil, nil))
+}
+
+// Reschedule moves a scheduled email by its resend ID to t
+func (c *EmailClient) Reschedule(ctx context.Context, messageID string, t time.Time) error {
+	if d := time.Until(t); d > Capabilities.ScheduleHorizon {
+		return fmt.Errorf("%w: resend schedules up to %v ahead, got %v", emailer.ErrScheduleHorizon, Capabilities.ScheduleHorizon, d.Round(time.Second))
+	}
+	p := struct {
+		ScheduledAt string `json:"scheduled_at"`
+	}{ScheduledAt: t.UTC().Format(time.RFC3339)}
+	return emailer.NotFound(c.do(ctx, http.MethodPatch, c.baseURL+emailsPath+"/"+url.PathEscape(messageID), p, nil))
+}
+
+// do sends body as JSON to given target of resend, then decodes a successful response into out when it is not nil
+func (c *EmailClient) do(ctx context.Context, method, target string, body, out any) error {
+	var reqBody io.Reader = http.NoBody
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("json.Marshal(%v): %v", body, err)
+		}
+		reqBody = bytes.NewBuffer(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reqBody)
 	if err != nil {
 		return fmt.Errorf("http.NewRequestWithContext(): %v", err)
 	}
@@ -91,23 +187,31 @@ func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
 	req.Header.Add("accept", "application/json")
 	req.Header.Add("content-type", "application/json")
 
-	resp, err := c.client.Do(req) //nolint:gosec //endpoint is already a constant
+	resp, err := emailer.Do(&c.client, req)
 	if err != nil {
-		return fmt.Errorf("client.Do(%v): %v", req, err)
+		return err
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
 
 	if slices.Contains([]int{http.StatusAccepted, http.StatusCreated, http.StatusOK}, resp.StatusCode) {
+		if out == nil {
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("json.NewDecoder().Decode(): %v", err)
+		}
 		return nil
 	}
 
-	var m errorMessage
-	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
-		dump, _ := httputil.DumpResponse(resp, true)
-		return fmt.Errorf("json.NewDecoder(%v).Decode(): %v", string(dump), err)
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("io.ReadAll(): %v", err)
 	}
-
-	return fmt.Errorf("unsuccessful response with status code(%d): %v", resp.StatusCode, m)
+	return emailer.NewStatusError(resp.StatusCode, raw, func(body []byte) (any, bool) {
+		var m errorMessage
+		err := json.Unmarshal(body, &m)
+		return m, err == nil
+	})
 }
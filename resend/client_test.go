@@ -1,15 +1,14 @@
 package resend
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"io"
-	"log/slog"
 	"net/http"
-	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
@@ -25,46 +24,28 @@ func TestNew(t *testing.T) {
 	}
 }
 
-func TestEmailHandler_BrokenRequest(t *testing.T) {
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/email", bytes.NewBuffer([]byte{'h', 'e', 'l', 'l', 'o'}))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(nil)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusBadRequest, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=\n %v", diff)
-	}
-
-	if diff := cmp.Diff("Failed to decode request: invalid character 'h' looking for beginning of value\n", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=\n %v", diff)
-	}
+// recipientPaths are the paths of the request body that hold each recipient
+var recipientPaths = map[string][]string{
+	"to":  {"to"},
+	"cc":  {"cc"},
+	"bcc": {"bcc"},
 }
 
-func TestEmailHandler_FailedValidation(t *testing.T) {
-	email := emailer.Email{
-		From: "a@a.com",
-	}
-	raw, err := json.Marshal(email)
-	if err != nil {
-		t.Fatalf("json.Marshal(%v): %v", email, err)
-	}
-
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/email", bytes.NewBuffer(raw))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(nil)
-	handler.ServeHTTP(rr, req)
+// errorBody is how resend rejects a request
+const errorBody = `{"statusCode":400,"name":"validation_error","message":"conformance failure"}`
 
-	if diff := cmp.Diff(http.StatusBadRequest, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=\n %v", diff)
-	}
-
-	if diff := cmp.Diff("Failed to validate: to field must not be blank\n", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=\n %v", diff)
-	}
+func TestConformance(t *testing.T) {
+	emailtest.RunSenderConformance(t, func(c emailer.Config) (emailer.Sender, error) {
+		return New(c)
+	}, emailtest.Provider{Fake: emailtest.NewResendServer, Recipients: recipientPaths, ErrorBody: errorBody})
 }
 
-func TestEmailHandler_Success(t *testing.T) {
+func TestSend_Schedule(t *testing.T) {
+	var got payload
 	tripper := func(req *http.Request) *http.Response {
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Fatalf("json.NewDecoder().Decode(): %v", err)
+		}
 		return &http.Response{
 			StatusCode: http.StatusOK,
 		}
@@ -74,73 +55,62 @@ func TestEmailHandler_Success(t *testing.T) {
 		t.Fatalf("New(): %v", err)
 	}
 
+	sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
 	email := emailer.Email{
 		From:        "a@a.com",
 		To:          []string{"b@b.com"},
-		BCC:         []string{"bcc@bcc.com"},
-		CC:          []string{"cc@cc.com"},
 		Subject:     "sub",
-		HTMLContent: "html",
+		TextContent: "text",
+		SendAt:      sendAt,
 	}
-	raw, err := json.Marshal(email)
-	if err != nil {
-		t.Fatalf("json.Marshal(%v): %v", email, err)
+	if err := client.Send(context.Background(), email); err != nil {
+		t.Fatalf("Send(): %v", err)
 	}
-
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/send", bytes.NewBuffer(raw))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(client)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusOK, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=\n %v", diff)
+	if diff := cmp.Diff(sendAt.UTC().Format(time.RFC3339), got.ScheduledAt); diff != "" {
+		t.Errorf("Send(): ScheduledAt diff=\n %v", diff)
 	}
 
-	if diff := cmp.Diff("Email successfully sent", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=\n %v", diff)
+	email.SendAt = time.Now().Add(Capabilities.ScheduleHorizon + time.Hour)
+	if err := client.Send(context.Background(), email); !errors.Is(err, emailer.ErrScheduleHorizon) {
+		t.Errorf("Send(): got=%v want=%v", err, emailer.ErrScheduleHorizon)
 	}
 }
 
-func TestEmailHandler_FaultyClient(t *testing.T) {
-	slog.SetLogLoggerLevel(slog.Level(100))
+func TestCancel(t *testing.T) {
+	var method, url string
 	tripper := func(req *http.Request) *http.Response {
-		return nil
+		method, url = req.Method, req.URL.String()
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"object": "email", "id": "id-1"}`)),
+		}
 	}
-	client, err := New(emailtest.NewFaultyClientConfig(tripper))
+	client, err := New(emailtest.NewConfig(tripper))
 	if err != nil {
 		t.Fatalf("New(): %v", err)
 	}
 
-	email := emailer.Email{
-		From:        "a@a.com",
-		To:          []string{"b@b.com"},
-		Subject:     "sub",
-		HTMLContent: "html",
-	}
-	raw, err := json.Marshal(email)
-	if err != nil {
-		t.Fatalf("json.Marshal(%v): %v", email, err)
-	}
-
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/send", bytes.NewBuffer(raw))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(client)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusInternalServerError, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=\n %v", diff)
+	if err := client.Cancel(context.Background(), "id-1"); err != nil {
+		t.Fatalf("Cancel(): %v", err)
 	}
-
-	if diff := cmp.Diff("Failed to send email\n", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=\n %v", diff)
+	if diff := cmp.Diff(http.MethodPost+" "+baseURL+emailsPath+"/id-1/cancel", method+" "+url); diff != "" {
+		t.Errorf("Cancel(): request diff=\n %v", diff)
 	}
 }
 
-func TestEmailHandler_TeapotClient(t *testing.T) {
-	slog.SetLogLoggerLevel(slog.Level(100))
+func TestReschedule(t *testing.T) {
+	var (
+		method, url string
+		got         map[string]string
+	)
 	tripper := func(req *http.Request) *http.Response {
+		method, url = req.Method, req.URL.String()
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Fatalf("json.NewDecoder().Decode(): %v", err)
+		}
 		return &http.Response{
-			StatusCode: http.StatusTeapot,
+			StatusCode: http.StatusNotFound,
+			Body:       io.NopCloser(strings.NewReader(`{"statusCode": 404, "name": "not_found", "message": "Email not found"}`)),
 		}
 	}
 	client, err := New(emailtest.NewConfig(tripper))
@@ -148,49 +118,21 @@ func TestEmailHandler_TeapotClient(t *testing.T) {
 		t.Fatalf("New(): %v", err)
 	}
 
-	email := emailer.Email{
-		From:        "a@a.com",
-		To:          []string{"b@b.com"},
-		Subject:     "sub",
-		HTMLContent: "html",
+	sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := client.Reschedule(context.Background(), "id-1", sendAt); !errors.Is(err, emailer.ErrMessageNotFound) {
+		t.Errorf("Reschedule(): got=%v want=%v", err, emailer.ErrMessageNotFound)
 	}
-	raw, err := json.Marshal(email)
-	if err != nil {
-		t.Fatalf("json.Marshal(%v): %v", email, err)
+	if diff := cmp.Diff(http.MethodPatch+" "+baseURL+emailsPath+"/id-1", method+" "+url); diff != "" {
+		t.Errorf("Reschedule(): request diff=\n %v", diff)
 	}
-
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/send", bytes.NewBuffer(raw))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(client)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusInternalServerError, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=\n %v", diff)
-	}
-
-	if diff := cmp.Diff("Failed to send email\n", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=\n %v", diff)
+	if diff := cmp.Diff(map[string]string{"scheduled_at": sendAt.UTC().Format(time.RFC3339)}, got); diff != "" {
+		t.Errorf("Reschedule(): payload diff=\n %v", diff)
 	}
 }
 
-func TestEmailHandler_ErrorMessage(t *testing.T) {
-	slog.SetLogLoggerLevel(slog.Level(100))
-	tripper := func(req *http.Request) *http.Response {
-		cm := errorMessage{
-			StatusCode: http.StatusBadRequest,
-			Message:    "resend don't like that",
-		}
-		raw, err := json.Marshal(cm)
-		if err != nil {
-			t.Fatalf("json.Marshal(%v): %v", cm, err)
-		}
-
-		return &http.Response{
-			StatusCode: http.StatusBadRequest,
-			Body:       io.NopCloser(bytes.NewBuffer(raw)),
-		}
-	}
-	client, err := New(emailtest.NewConfig(tripper))
+func TestFakeServer(t *testing.T) {
+	srv := emailtest.NewResendServer(t)
+	client, err := New(srv.Config())
 	if err != nil {
 		t.Fatalf("New(): %v", err)
 	}
@@ -198,24 +140,59 @@ func TestEmailHandler_ErrorMessage(t *testing.T) {
 	email := emailer.Email{
 		From:        "a@a.com",
 		To:          []string{"b@b.com"},
+		BCC:         []string{"bcc@bcc.com"},
 		Subject:     "sub",
 		HTMLContent: "html",
+		Attachments: []emailer.Attachment{{Filename: "logo.png", ContentType: "image/png", ContentID: "logo", Data: []byte("png")}},
 	}
-	raw, err := json.Marshal(email)
-	if err != nil {
-		t.Fatalf("json.Marshal(%v): %v", email, err)
+	if _, err := client.SendMessage(context.Background(), email); err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	var got payload
+	if err := json.Unmarshal(srv.LastRequest().Body, &got); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
+	}
+	want := payload{
+		From:        "a@a.com",
+		To:          []string{"b@b.com"},
+		BCC:         []string{"bcc@bcc.com"},
+		Subject:     "sub",
+		HTMLContent: "html",
+		Attachments: []attachment{{Content: []byte("png"), Filename: "logo.png", ContentType: "image/png", ContentID: "logo"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SendMessage(): payload diff=\n %v", diff)
 	}
 
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/send", bytes.NewBuffer(raw))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(client)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusInternalServerError, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=\n %v", diff)
+	email.SendAt = time.Now().Add(time.Hour)
+	id, err := client.SendMessage(context.Background(), email)
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	if err := client.Reschedule(context.Background(), id, time.Now().Add(2*time.Hour)); err != nil {
+		t.Errorf("Reschedule(): %v", err)
+	}
+	if err := client.Cancel(context.Background(), id); err != nil {
+		t.Errorf("Cancel(): %v", err)
+	}
+	if err := client.Cancel(context.Background(), id); !errors.Is(err, emailer.ErrMessageNotFound) {
+		t.Errorf("Cancel(): got=%v want=%v", err, emailer.ErrMessageNotFound)
+	}
+	if diff := cmp.Diff(5, len(srv.Requests())); diff != "" {
+		t.Errorf("Requests(): diff=\n %v", diff)
 	}
 
-	if diff := cmp.Diff("Failed to send email\n", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=\n %v", diff)
+	email.CC = []string{"not-an-address"}
+	if err := client.Send(context.Background(), email); err == nil || !strings.Contains(err.Error(), "status code(422)") {
+		t.Errorf("Send(): got=%v want=status code(422)", err)
+	}
+	cfg := srv.Config()
+	cfg.Key = "wrong-key"
+	client, err = New(cfg)
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	if err := client.Send(context.Background(), email); err == nil || !strings.Contains(err.Error(), "status code(403)") {
+		t.Errorf("Send(): got=%v want=status code(403)", err)
 	}
 }
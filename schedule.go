@@ -0,0 +1,232 @@
+package emailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrScheduleHorizon is returned by senders when an email is scheduled further in the future than they support
+var ErrScheduleHorizon = errors.New("sendAt is beyond the schedule horizon")
+
+// ErrMessageNotFound is returned by cancelers when the message does not exist or is not scheduled anymore
+var ErrMessageNotFound = errors.New("message not found")
+
+// NotFound marks a 404 StatusError of a cancel or reschedule request as ErrMessageNotFound, other errors are returned as they are.
+// Only those requests name a message, a 404 of a send means a wrong URL
+func NotFound(err error) error {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %w", ErrMessageNotFound, err)
+	}
+	return err
+}
+
+// localPrefix prefixes message IDs of the emails held by LocalScheduler
+const localPrefix = "local-"
+
+// Canceler is a behaviour for email senders that can take back or move scheduled emails by their message ID.
+// Senders that can only do one of them return [errors.ErrUnsupported] for the other.
+type Canceler interface {
+	Cancel(ctx context.Context, messageID string) error
+	Reschedule(ctx context.Context, messageID string, t time.Time) error
+}
+
+// LocalScheduler holds emails that next sender can not schedule natively in memory and sends them at their SendAt time.
+// Held emails are lost when the process exits.
+type LocalScheduler struct {
+	next    Sender
+	timeout time.Duration
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+	closed bool
+}
+
+// NewLocalScheduler creates a local scheduler in front of next sender, timeout limits each delayed send
+func NewLocalScheduler(next Sender, timeout time.Duration) *LocalScheduler {
+	return &LocalScheduler{
+		next:    next,
+		timeout: timeout,
+		timers:  make(map[string]*time.Timer),
+	}
+}
+
+// Send sends a given email, see SendMessage
+func (s *LocalScheduler) Send(ctx context.Context, e Email) error {
+	_, err := s.SendMessage(ctx, e)
+	return err
+}
+
+// SendMessage sends emails without SendAt right away, passes the ones within the schedule horizon of next sender as is,
+// and holds the rest until their SendAt time. Held emails get a local message ID.
+func (s *LocalScheduler) SendMessage(ctx context.Context, e Email) (string, error) {
+	if e.SendAt.IsZero() {
+		return SendMessage(ctx, s.next, e)
+	}
+	wait := time.Until(e.SendAt)
+	if wait <= 0 {
+		e.SendAt = time.Time{}
+		return SendMessage(ctx, s.next, e)
+	}
+	if c, ok := s.next.(Capable); ok && wait <= c.Capabilities().ScheduleHorizon {
+		return SendMessage(ctx, s.next, e)
+	}
+
+	// held emails are sent immediately later, so they are checked like that before holding them
+	e.SendAt = time.Time{}
+	if err := CheckCapabilities(s.next, e); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return "", errors.New("local scheduler is closed")
+	}
+
+	id := localPrefix + rand.Text()
+	detached := context.WithoutCancel(ctx)
+	s.timers[id] = time.AfterFunc(wait, func() {
+		s.mu.Lock()
+		delete(s.timers, id)
+		s.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(detached, s.timeout)
+		defer cancel()
+		if err := s.next.Send(ctx, e); err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, fmt.Sprintf("%T.Send()", s.next), slog.Any("email", e), slog.String("err", err.Error()))
+		}
+	})
+	return id, nil
+}
+
+// Cancel drops a held email, other message IDs are passed to next sender when it is a Canceler
+func (s *LocalScheduler) Cancel(ctx context.Context, messageID string) error {
+	if !strings.HasPrefix(messageID, localPrefix) {
+		c, ok := s.next.(Canceler)
+		if !ok {
+			return fmt.Errorf("%T can not cancel: %w", s.next, errors.ErrUnsupported)
+		}
+		return c.Cancel(ctx, messageID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.timers[messageID]
+	if !ok || !t.Stop() {
+		return fmt.Errorf("%w: %q", ErrMessageNotFound, messageID)
+	}
+	delete(s.timers, messageID)
+	return nil
+}
+
+// Reschedule moves a held email to t, other message IDs are passed to next sender when it is a Canceler
+func (s *LocalScheduler) Reschedule(ctx context.Context, messageID string, t time.Time) error {
+	if !strings.HasPrefix(messageID, localPrefix) {
+		c, ok := s.next.(Canceler)
+		if !ok {
+			return fmt.Errorf("%T can not reschedule: %w", s.next, errors.ErrUnsupported)
+		}
+		return c.Reschedule(ctx, messageID, t)
+	}
+
+	wait := time.Until(t)
+	if wait <= 0 {
+		return errors.New("sendAt must be in the future")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	timer, ok := s.timers[messageID]
+	if !ok || !timer.Stop() {
+		return fmt.Errorf("%w: %q", ErrMessageNotFound, messageID)
+	}
+	timer.Reset(wait)
+	return nil
+}
+
+// Pending returns the number of emails held
+func (s *LocalScheduler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.timers)
+}
+
+// Close drops held emails and rejects new ones, it returns the number of emails dropped
+func (s *LocalScheduler) Close() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	dropped := 0
+	for id, t := range s.timers {
+		if t.Stop() {
+			dropped++
+		}
+		delete(s.timers, id)
+	}
+	return dropped
+}
+
+// CancelHandlerFunc is opinionated/reusable HTTP handler that cancels the scheduled email of `{id}` path value
+func CancelHandlerFunc(c Canceler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if err := c.Cancel(r.Context(), id); err != nil {
+			slog.LogAttrs(r.Context(), slog.LevelError, fmt.Sprintf("%T.Cancel(%q)", c, id), slog.String("err", err.Error()))
+			http.Error(w, "Failed to cancel email", cancelStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, "Email successfully canceled")
+	}
+}
+
+// RescheduleHandlerFunc is opinionated/reusable HTTP handler that moves the scheduled email of `{id}` path value
+// to the `sendAt` of JSON request body
+func RescheduleHandlerFunc(c Canceler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SendAt time.Time `json:"sendAt"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to decode request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if !body.SendAt.After(time.Now()) {
+			http.Error(w, "Failed to validate: sendAt field must be in the future", http.StatusBadRequest)
+			return
+		}
+
+		id := r.PathValue("id")
+		if err := c.Reschedule(r.Context(), id, body.SendAt); err != nil {
+			slog.LogAttrs(r.Context(), slog.LevelError, fmt.Sprintf("%T.Reschedule(%q, %v)", c, id, body.SendAt), slog.String("err", err.Error()))
+			http.Error(w, "Failed to reschedule email", cancelStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, "Email successfully rescheduled")
+	}
+}
+
+// cancelStatus maps cancel and reschedule errors to HTTP status codes
+func cancelStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrMessageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errors.ErrUnsupported):
+		return http.StatusNotImplemented
+	case errors.Is(err, ErrScheduleHorizon):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,251 @@
+package emailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// nativeScheduler is a sender that can schedule natively up to horizon
+type nativeScheduler struct {
+	horizon time.Duration
+
+	mu   sync.Mutex
+	sent []Email
+}
+
+func (s *nativeScheduler) Send(_ context.Context, e Email) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, e)
+	return nil
+}
+
+func (s *nativeScheduler) Capabilities() Capabilities {
+	return Capabilities{ScheduleHorizon: s.horizon}
+}
+
+func (s *nativeScheduler) emails() []Email {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Email(nil), s.sent...)
+}
+
+func TestLocalScheduler_Native(t *testing.T) {
+	next := &nativeScheduler{horizon: time.Hour}
+	s := NewLocalScheduler(next, time.Second)
+	defer s.Close()
+
+	email := Email{Subject: "native", SendAt: time.Now().Add(time.Minute)}
+	if err := s.Send(context.Background(), email); err != nil {
+		t.Fatalf("Send(): %v", err)
+	}
+	if diff := cmp.Diff([]Email{email}, next.emails()); diff != "" {
+		t.Errorf("Send(): diff=\n %v", diff)
+	}
+	if diff := cmp.Diff(0, s.Pending()); diff != "" {
+		t.Errorf("Pending(): diff=\n %v", diff)
+	}
+}
+
+func TestLocalScheduler_BeyondHorizon(t *testing.T) {
+	next := &nativeScheduler{horizon: time.Millisecond}
+	s := NewLocalScheduler(next, time.Second)
+	defer s.Close()
+
+	if err := s.Send(context.Background(), Email{Subject: "later", SendAt: time.Now().Add(50 * time.Millisecond)}); err != nil {
+		t.Fatalf("Send(): %v", err)
+	}
+	if diff := cmp.Diff(1, s.Pending()); diff != "" {
+		t.Errorf("Pending(): diff=\n %v", diff)
+	}
+	if len(next.emails()) != 0 {
+		t.Fatalf("Send(): email is sent before its time")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(next.emails()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if diff := cmp.Diff([]Email{{Subject: "later"}}, next.emails()); diff != "" {
+		t.Errorf("Send(): diff=\n %v", diff)
+	}
+}
+
+func TestLocalScheduler_Close(t *testing.T) {
+	var sent []Email
+	next := SenderFunc(func(_ context.Context, e Email) error {
+		sent = append(sent, e)
+		return nil
+	})
+	s := NewLocalScheduler(next, time.Second)
+
+	if err := s.Send(context.Background(), Email{Subject: "now"}); err != nil {
+		t.Fatalf("Send(): %v", err)
+	}
+	if err := s.Send(context.Background(), Email{Subject: "later", SendAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("Send(): %v", err)
+	}
+	if diff := cmp.Diff(1, s.Close()); diff != "" {
+		t.Errorf("Close(): diff=\n %v", diff)
+	}
+	if err := s.Send(context.Background(), Email{Subject: "closed", SendAt: time.Now().Add(time.Hour)}); err == nil {
+		t.Error("Send(): expected error, got nil")
+	}
+	if diff := cmp.Diff([]Email{{Subject: "now"}}, sent); diff != "" {
+		t.Errorf("Send(): diff=\n %v", diff)
+	}
+}
+
+func TestLocalScheduler_CancelReschedule(t *testing.T) {
+	next := &nativeScheduler{horizon: time.Millisecond}
+	s := NewLocalScheduler(next, time.Second)
+	defer s.Close()
+
+	id, err := s.SendMessage(context.Background(), Email{Subject: "later", SendAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	if !strings.HasPrefix(id, localPrefix) {
+		t.Fatalf("SendMessage(): got=%q, want local message ID", id)
+	}
+
+	if err := s.Reschedule(context.Background(), id, time.Now().Add(10*time.Millisecond)); err != nil {
+		t.Fatalf("Reschedule(): %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(next.emails()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if diff := cmp.Diff([]Email{{Subject: "later"}}, next.emails()); diff != "" {
+		t.Errorf("Reschedule(): diff=\n %v", diff)
+	}
+	if err := s.Cancel(context.Background(), id); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Cancel(): got=%v want=%v", err, ErrMessageNotFound)
+	}
+
+	id, err = s.SendMessage(context.Background(), Email{Subject: "canceled", SendAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	if err := s.Cancel(context.Background(), id); err != nil {
+		t.Fatalf("Cancel(): %v", err)
+	}
+	if diff := cmp.Diff(0, s.Pending()); diff != "" {
+		t.Errorf("Pending(): diff=\n %v", diff)
+	}
+	if err := s.Cancel(context.Background(), "provider-id"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Cancel(): got=%v want=%v", err, errors.ErrUnsupported)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil"},
+		{name: "not found", err: &StatusError{StatusCode: http.StatusNotFound}, want: true},
+		{name: "wrapped not found", err: fmt.Errorf("cancel: %w", &StatusError{StatusCode: http.StatusNotFound}), want: true},
+		{name: "other status", err: &StatusError{StatusCode: http.StatusBadRequest}},
+		{name: "other error", err: errors.New("connection reset")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NotFound(tt.err)
+			if diff := cmp.Diff(tt.want, errors.Is(err, ErrMessageNotFound)); diff != "" {
+				t.Errorf("NotFound(): diff=\n %v", diff)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("NotFound(): %v does not wrap %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCancelHandlerFunc(t *testing.T) {
+	slog.SetLogLoggerLevel(slog.Level(100))
+	s := NewLocalScheduler(&nativeScheduler{}, time.Second)
+	defer s.Close()
+	id, err := s.SendMessage(context.Background(), Email{Subject: "later", SendAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /email/{id}", CancelHandlerFunc(s))
+	mux.HandleFunc("PATCH /email/{id}", RescheduleHandlerFunc(s))
+
+	tests := []struct {
+		name     string
+		method   string
+		id       string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "reschedule to the past",
+			method:   http.MethodPatch,
+			id:       id,
+			body:     `{"sendAt": "2000-01-01T00:00:00Z"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: "Failed to validate: sendAt field must be in the future\n",
+		},
+		{
+			name:     "reschedule",
+			method:   http.MethodPatch,
+			id:       id,
+			body:     `{"sendAt": "` + time.Now().Add(2*time.Hour).Format(time.RFC3339) + `"}`,
+			wantCode: http.StatusOK,
+			wantBody: "Email successfully rescheduled",
+		},
+		{
+			name:     "cancel",
+			method:   http.MethodDelete,
+			id:       id,
+			wantCode: http.StatusOK,
+			wantBody: "Email successfully canceled",
+		},
+		{
+			name:     "cancel again",
+			method:   http.MethodDelete,
+			id:       id,
+			wantCode: http.StatusNotFound,
+			wantBody: "Failed to cancel email\n",
+		},
+		{
+			name:     "cancel unsupported",
+			method:   http.MethodDelete,
+			id:       "provider-id",
+			wantCode: http.StatusNotImplemented,
+			wantBody: "Failed to cancel email\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequestWithContext(context.Background(), tt.method, "/email/"+tt.id, bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if diff := cmp.Diff(tt.wantCode, rr.Code); diff != "" {
+				t.Errorf("ServeHTTP(): HTTP code diff=\n %v", diff)
+			}
+			if diff := cmp.Diff(tt.wantBody, rr.Body.String()); diff != "" {
+				t.Errorf("ServeHTTP(): HTTP body diff=\n %v", diff)
+			}
+		})
+	}
+}
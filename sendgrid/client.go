@@ -19,24 +19,44 @@ package sendgrid
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
 	"net/http"
-	"net/http/httputil"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/mrwormhole/emailer"
 )
 
-const endpoint = "https://api.sendgrid.com/v3/mail/send"
+const (
+	baseURL            = "https://api.sendgrid.com"
+	sendPath           = "/v3/mail/send"
+	batchPath          = "/v3/mail/batch"
+	scheduledSendsPath = "/v3/user/scheduled_sends"
+)
+
+// Capabilities describes what sendgrid can honour of an email
+var Capabilities = emailer.Capabilities{
+	// sendgrid limits a personalization to 1000 recipients and an email to 30MB
+	MaxRecipients:     1000,
+	MaxAttachmentSize: 30 << 20,
+	InlineAttachments: true,
+	// sendgrid schedules emails up to 72 hours ahead
+	ScheduleHorizon: 72 * time.Hour,
+}
 
 // EmailClient is sendgrid email client to interact with emails
 type EmailClient struct {
-	key    string
-	client http.Client
+	key            string
+	baseURL        string
+	markdownLayout *template.Template
+	client         http.Client
 }
 
 // New creates a new sendgrid email client with given API key and http.Client
@@ -45,12 +65,23 @@ func New(c emailer.Config) (*EmailClient, error) {
 		return nil, errors.New("sendgrid API key is blank")
 	}
 	e := &EmailClient{
-		key:    c.Key,
-		client: c.Client,
+		key:            c.Key,
+		baseURL:        cmp.Or(strings.TrimSuffix(c.BaseURL, "/"), baseURL),
+		markdownLayout: c.MarkdownLayout,
+		client:         c.Client,
 	}
 	return e, nil
 }
 
+func init() {
+	emailer.Register("sendgrid", emailer.FactoryOf(New))
+}
+
+// Capabilities returns what sendgrid can honour of an email
+func (c *EmailClient) Capabilities() emailer.Capabilities {
+	return Capabilities
+}
+
 type emailObject struct {
 	Email string `json:"email"`
 }
@@ -74,6 +105,24 @@ type payload struct {
 	From             emailObject       `json:"from"`
 	Subject          string            `json:"subject"`
 	Content          []content         `json:"content,omitempty"`
+	SendAt           int64             `json:"send_at,omitempty"`
+	BatchID          string            `json:"batch_id,omitempty"`
+	Attachments      []attachment      `json:"attachments,omitempty"`
+}
+
+// attachment is a file of sendgrid email, the ones with inline disposition are referred by content ID
+type attachment struct {
+	// Content is base64 encoded by JSON
+	Content     []byte `json:"content"`
+	Type        string `json:"type,omitempty"`
+	Filename    string `json:"filename"`
+	Disposition string `json:"disposition,omitempty"`
+	ContentID   string `json:"content_id,omitempty"`
+}
+
+// batch is a response of sendgrid batch creation, batches group scheduled sends to cancel them
+type batch struct {
+	BatchID string `json:"batch_id"`
 }
 
 type errorMessage struct {
@@ -86,6 +135,21 @@ type errorMessage struct {
 
 // Send sends a given email
 func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
+	_, err := c.SendMessage(ctx, email)
+	return err
+}
+
+// SendMessage sends a given email and returns its sendgrid message ID.
+// Scheduled emails return their batch ID instead since sendgrid cancels scheduled sends by batch.
+func (c *EmailClient) SendMessage(ctx context.Context, email emailer.Email) (string, error) {
+	if err := c.Capabilities().Check(email); err != nil {
+		return "", err
+	}
+	email, err := email.RenderMarkdown(c.markdownLayout)
+	if err != nil {
+		return "", fmt.Errorf("email.RenderMarkdown(): %v", err)
+	}
+
 	var p payload
 	p.From.Email = email.From
 
@@ -108,36 +172,92 @@ func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
 	if email.HTMLContent != "" {
 		p.Content = append(p.Content, content{Type: "text/html", Value: email.HTMLContent})
 	}
+	for _, a := range email.Attachments {
+		att := attachment{Content: a.Data, Type: a.ContentType, Filename: a.Filename, Disposition: "attachment"}
+		if a.ContentID != "" {
+			att.Disposition, att.ContentID = "inline", a.ContentID
+		}
+		p.Attachments = append(p.Attachments, att)
+	}
+
+	if !email.SendAt.IsZero() {
+		var b batch
+		if _, err := c.do(ctx, http.MethodPost, c.baseURL+batchPath, nil, &b); err != nil {
+			return "", err
+		}
+		p.SendAt = email.SendAt.Unix()
+		p.BatchID = b.BatchID
+	}
 
-	raw, err := json.Marshal(p)
+	header, err := c.do(ctx, http.MethodPost, c.baseURL+sendPath, p, nil)
 	if err != nil {
-		return fmt.Errorf("json.Marshal(%v): %v", p, err)
+		return "", err
+	}
+	if p.BatchID != "" {
+		return p.BatchID, nil
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(raw))
+	return header.Get("X-Message-Id"), nil
+}
+
+// Cancel cancels scheduled emails by their sendgrid batch ID
+func (c *EmailClient) Cancel(ctx context.Context, messageID string) error {
+	p := struct {
+		BatchID string `json:"batch_id"`
+		Status  string `json:"status"`
+	}{BatchID: messageID, Status: "cancel"}
+	_, err := c.do(ctx, http.MethodPost, c.baseURL+scheduledSendsPath, p, nil)
+	return emailer.NotFound(err)
+}
+
+// Reschedule is not supported by sendgrid, scheduled emails can only be canceled
+func (c *EmailClient) Reschedule(context.Context, string, time.Time) error {
+	return fmt.Errorf("sendgrid can not reschedule: %w", errors.ErrUnsupported)
+}
+
+// do sends body as JSON to given target of sendgrid, then decodes a successful response into out when it is not nil.
+// It returns the headers of a successful response.
+func (c *EmailClient) do(ctx context.Context, method, target string, body, out any) (http.Header, error) {
+	var reqBody io.Reader = http.NoBody
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("json.Marshal(%v): %v", body, err)
+		}
+		reqBody = bytes.NewBuffer(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reqBody)
 	if err != nil {
-		return fmt.Errorf("http.NewRequestWithContext(): %v", err)
+		return nil, fmt.Errorf("http.NewRequestWithContext(): %v", err)
 	}
 	req.Header.Add("Authorization", "Bearer "+c.key)
 	req.Header.Add("accept", "application/json")
 	req.Header.Add("content-type", "application/json")
 
-	resp, err := c.client.Do(req) //nolint:gosec //endpoint is already a constant
+	resp, err := emailer.Do(&c.client, req)
 	if err != nil {
-		return fmt.Errorf("client.Do(%v): %v", req, err)
+		return nil, err
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
 
 	if slices.Contains([]int{http.StatusAccepted, http.StatusCreated, http.StatusOK}, resp.StatusCode) {
-		return nil
+		if out == nil {
+			return resp.Header, nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("json.NewDecoder().Decode(): %v", err)
+		}
+		return resp.Header, nil
 	}
 
-	var m errorMessage
-	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
-		dump, _ := httputil.DumpResponse(resp, true)
-		return fmt.Errorf("json.NewDecoder(%v).Decode(): %v", string(dump), err)
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("io.ReadAll(): %v", err)
 	}
-
-	return fmt.Errorf("unsuccessful response with status code(%d): %v", resp.StatusCode, m)
+	return nil, emailer.NewStatusError(resp.StatusCode, raw, func(body []byte) (any, bool) {
+		var m errorMessage
+		err := json.Unmarshal(body, &m)
+		return m, err == nil
+	})
 }
@@ -1,15 +1,14 @@
 package sendgrid
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"io"
-	"log/slog"
 	"net/http"
-	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
@@ -25,95 +24,36 @@ func TestNew(t *testing.T) {
 	}
 }
 
-func TestSend_Success(t *testing.T) {
-	tripper := func(req *http.Request) *http.Response {
-		return &http.Response{
-			StatusCode: http.StatusAccepted,
-		}
-	}
-	client, err := New(emailtest.NewConfig(tripper))
-	if err != nil {
-		t.Fatalf("New(): %v", err)
-	}
-
-	email := emailer.Email{
-		From:        "a@a.com",
-		To:          []string{"b@b.com"},
-		BCC:         []string{"bcc@bcc.com"},
-		CC:          []string{"cc@cc.com"},
-		Subject:     "sub",
-		HTMLContent: "html",
-		TextContent: "text",
-	}
-	if err := client.Send(context.Background(), email); err != nil {
-		t.Errorf("Send(): %v", err)
-	}
+// recipientPaths are the paths of the request body that hold each recipient
+var recipientPaths = map[string][]string{
+	"to":  {"personalizations.to.email"},
+	"cc":  {"personalizations.cc.email"},
+	"bcc": {"personalizations.bcc.email"},
 }
 
-func TestSend_FaultyClient(t *testing.T) {
-	slog.SetLogLoggerLevel(slog.Level(100))
-	tripper := func(req *http.Request) *http.Response {
-		return nil
-	}
-	client, err := New(emailtest.NewFaultyClientConfig(tripper))
-	if err != nil {
-		t.Fatalf("New(): %v", err)
-	}
+// errorBody is how sendgrid rejects a request
+const errorBody = `{"errors":[{"message":"conformance failure","field":"from","help":null}]}`
 
-	email := emailer.Email{
-		From:        "a@a.com",
-		To:          []string{"b@b.com"},
-		Subject:     "sub",
-		HTMLContent: "html",
-	}
-	if err := client.Send(context.Background(), email); err == nil {
-		t.Error("Send(): expected error, got nil")
-	}
+func TestConformance(t *testing.T) {
+	emailtest.RunSenderConformance(t, func(c emailer.Config) (emailer.Sender, error) {
+		return New(c)
+	}, emailtest.Provider{Fake: emailtest.NewSendgridServer, Recipients: recipientPaths, ErrorBody: errorBody})
 }
 
-func TestSend_TeapotClient(t *testing.T) {
-	slog.SetLogLoggerLevel(slog.Level(100))
+func TestSend_Schedule(t *testing.T) {
+	var got payload
 	tripper := func(req *http.Request) *http.Response {
-		return &http.Response{
-			StatusCode: http.StatusTeapot,
-		}
-	}
-	client, err := New(emailtest.NewConfig(tripper))
-	if err != nil {
-		t.Fatalf("New(): %v", err)
-	}
-
-	email := emailer.Email{
-		From:        "a@a.com",
-		To:          []string{"b@b.com"},
-		Subject:     "sub",
-		HTMLContent: "html",
-	}
-	if err := client.Send(context.Background(), email); err == nil {
-		t.Error("Send(): expected error, got nil")
-	}
-}
-
-func TestSend_ProviderCodeMessage(t *testing.T) {
-	slog.SetLogLoggerLevel(slog.Level(100))
-	tripper := func(req *http.Request) *http.Response {
-		cm := struct {
-			Errors []struct {
-				Message string `json:"message"`
-			} `json:"errors"`
-		}{
-			Errors: []struct {
-				Message string `json:"message"`
-			}{{Message: "sendgrid don't like that"}},
+		if req.URL.String() == baseURL+batchPath {
+			return &http.Response{
+				StatusCode: http.StatusCreated,
+				Body:       io.NopCloser(strings.NewReader(`{"batch_id": "batch"}`)),
+			}
 		}
-		raw, err := json.Marshal(cm)
-		if err != nil {
-			t.Fatalf("json.Marshal(%v): %v", cm, err)
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Fatalf("json.NewDecoder().Decode(): %v", err)
 		}
-
 		return &http.Response{
-			StatusCode: http.StatusBadRequest,
-			Body:       io.NopCloser(bytes.NewBuffer(raw)),
+			StatusCode: http.StatusAccepted,
 		}
 	}
 	client, err := New(emailtest.NewConfig(tripper))
@@ -121,59 +61,47 @@ func TestSend_ProviderCodeMessage(t *testing.T) {
 		t.Fatalf("New(): %v", err)
 	}
 
+	sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
 	email := emailer.Email{
 		From:        "a@a.com",
 		To:          []string{"b@b.com"},
 		Subject:     "sub",
-		HTMLContent: "html",
-	}
-	if err := client.Send(context.Background(), email); err == nil {
-		t.Error("Send(): expected error, got nil")
-	}
-}
-
-func TestEmailHandler_BrokenRequest(t *testing.T) {
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/email", bytes.NewBuffer([]byte{'h', 'e', 'l', 'l', 'o'}))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(nil)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusBadRequest, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=%v", diff)
+		TextContent: "text",
+		SendAt:      sendAt,
 	}
-
-	if diff := cmp.Diff("Failed to decode request: invalid character 'h' looking for beginning of value\n", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=%v", diff)
+	id, err := client.SendMessage(context.Background(), email)
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
 	}
-}
-
-func TestEmailHandler_FailedValidation(t *testing.T) {
-	email := emailer.Email{
-		From: "a@a.com",
+	if diff := cmp.Diff("batch", id); diff != "" {
+		t.Errorf("SendMessage(): ID diff=\n %v", diff)
 	}
-	raw, err := json.Marshal(email)
-	if err != nil {
-		t.Fatalf("json.Marshal(%v): %v", email, err)
+	if diff := cmp.Diff(sendAt.Unix(), got.SendAt); diff != "" {
+		t.Errorf("SendMessage(): SendAt diff=\n %v", diff)
 	}
-
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/email", bytes.NewBuffer(raw))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(nil)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusBadRequest, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=%v", diff)
+	if diff := cmp.Diff("batch", got.BatchID); diff != "" {
+		t.Errorf("SendMessage(): BatchID diff=\n %v", diff)
 	}
 
-	if diff := cmp.Diff("Failed to validate: to field must not be blank\n", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=%v", diff)
+	email.SendAt = time.Now().Add(Capabilities.ScheduleHorizon + time.Hour)
+	if err := client.Send(context.Background(), email); !errors.Is(err, emailer.ErrScheduleHorizon) {
+		t.Errorf("Send(): got=%v want=%v", err, emailer.ErrScheduleHorizon)
 	}
 }
 
-func TestEmailHandler_Success(t *testing.T) {
+func TestCancel(t *testing.T) {
+	var (
+		url string
+		got map[string]string
+	)
 	tripper := func(req *http.Request) *http.Response {
+		url = req.URL.String()
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Fatalf("json.NewDecoder().Decode(): %v", err)
+		}
 		return &http.Response{
-			StatusCode: http.StatusOK,
+			StatusCode: http.StatusCreated,
+			Body:       io.NopCloser(strings.NewReader(`{"batch_id": "batch", "status": "cancel"}`)),
 		}
 	}
 	client, err := New(emailtest.NewConfig(tripper))
@@ -181,37 +109,23 @@ func TestEmailHandler_Success(t *testing.T) {
 		t.Fatalf("New(): %v", err)
 	}
 
-	email := emailer.Email{
-		From:        "a@a.com",
-		To:          []string{"b@b.com"},
-		Subject:     "sub",
-		HTMLContent: "html",
+	if err := client.Cancel(context.Background(), "batch"); err != nil {
+		t.Fatalf("Cancel(): %v", err)
 	}
-	raw, err := json.Marshal(email)
-	if err != nil {
-		t.Fatalf("json.Marshal(%v): %v", email, err)
+	if diff := cmp.Diff(baseURL+scheduledSendsPath, url); diff != "" {
+		t.Errorf("Cancel(): URL diff=\n %v", diff)
 	}
-
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/send", bytes.NewBuffer(raw))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(client)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusOK, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=%v", diff)
+	if diff := cmp.Diff(map[string]string{"batch_id": "batch", "status": "cancel"}, got); diff != "" {
+		t.Errorf("Cancel(): payload diff=\n %v", diff)
 	}
-
-	if diff := cmp.Diff("Email successfully sent", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=%v", diff)
+	if err := client.Reschedule(context.Background(), "batch", time.Now()); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Reschedule(): got=%v want=%v", err, errors.ErrUnsupported)
 	}
 }
 
-func TestEmailHandler_FaultyClient(t *testing.T) {
-	slog.SetLogLoggerLevel(slog.Level(100))
-	tripper := func(req *http.Request) *http.Response {
-		return nil
-	}
-	client, err := New(emailtest.NewFaultyClientConfig(tripper))
+func TestFakeServer(t *testing.T) {
+	srv := emailtest.NewSendgridServer(t)
+	client, err := New(srv.Config())
 	if err != nil {
 		t.Fatalf("New(): %v", err)
 	}
@@ -219,113 +133,67 @@ func TestEmailHandler_FaultyClient(t *testing.T) {
 	email := emailer.Email{
 		From:        "a@a.com",
 		To:          []string{"b@b.com"},
+		CC:          []string{"cc@cc.com"},
 		Subject:     "sub",
+		TextContent: "text",
 		HTMLContent: "html",
+		Attachments: []emailer.Attachment{
+			{Filename: "logo.png", ContentType: "image/png", ContentID: "logo", Data: []byte("png")},
+			{Filename: "notes.txt", Data: []byte("notes")},
+		},
 	}
-	raw, err := json.Marshal(email)
+	id, err := client.SendMessage(context.Background(), email)
 	if err != nil {
-		t.Fatalf("json.Marshal(%v): %v", email, err)
+		t.Fatalf("SendMessage(): %v", err)
 	}
-
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/send", bytes.NewBuffer(raw))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(client)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusInternalServerError, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=%v", diff)
+	if id == "" {
+		t.Error("SendMessage(): empty message ID")
 	}
-
-	if diff := cmp.Diff("Failed to send email\n", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=%v", diff)
+	var got payload
+	if err := json.Unmarshal(srv.LastRequest().Body, &got); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
 	}
-}
-
-func TestEmailHandler_TeapotClient(t *testing.T) {
-	slog.SetLogLoggerLevel(slog.Level(100))
-	tripper := func(req *http.Request) *http.Response {
-		return &http.Response{
-			StatusCode: http.StatusTeapot,
-		}
+	want := payload{
+		Personalizations: []personalization{{To: []emailObject{{Email: "b@b.com"}}, CC: []emailObject{{Email: "cc@cc.com"}}}},
+		From:             emailObject{Email: "a@a.com"},
+		Subject:          "sub",
+		Content:          []content{{Type: "text/plain", Value: "text"}, {Type: "text/html", Value: "html"}},
+		Attachments: []attachment{
+			{Content: []byte("png"), Type: "image/png", Filename: "logo.png", Disposition: "inline", ContentID: "logo"},
+			{Content: []byte("notes"), Filename: "notes.txt", Disposition: "attachment"},
+		},
 	}
-	client, err := New(emailtest.NewConfig(tripper))
-	if err != nil {
-		t.Fatalf("New(): %v", err)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SendMessage(): payload diff=\n %v", diff)
 	}
 
-	email := emailer.Email{
-		From:        "a@a.com",
-		To:          []string{"b@b.com"},
-		Subject:     "sub",
-		HTMLContent: "html",
-	}
-	raw, err := json.Marshal(email)
+	email.SendAt = time.Now().Add(time.Hour)
+	id, err = client.SendMessage(context.Background(), email)
 	if err != nil {
-		t.Fatalf("json.Marshal(%v): %v", email, err)
+		t.Fatalf("SendMessage(): %v", err)
 	}
-
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/send", bytes.NewBuffer(raw))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(client)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusInternalServerError, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=%v", diff)
+	if err := client.Cancel(context.Background(), id); err != nil {
+		t.Errorf("Cancel(): %v", err)
 	}
-
-	if diff := cmp.Diff("Failed to send email\n", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=%v", diff)
-	}
-}
-
-func TestEmailHandler_ProviderCodeMessage(t *testing.T) {
-	slog.SetLogLoggerLevel(slog.Level(100))
-	tripper := func(req *http.Request) *http.Response {
-		cm := struct {
-			Errors []struct {
-				Message string `json:"message"`
-			} `json:"errors"`
-		}{
-			Errors: []struct {
-				Message string `json:"message"`
-			}{{Message: "sendgrid don't like that"}},
-		}
-		raw, err := json.Marshal(cm)
-		if err != nil {
-			t.Fatalf("json.Marshal(%v): %v", cm, err)
-		}
-
-		return &http.Response{
-			StatusCode: http.StatusBadRequest,
-			Body:       io.NopCloser(bytes.NewBuffer(raw)),
-		}
+	if err := client.Cancel(context.Background(), id); !errors.Is(err, emailer.ErrMessageNotFound) {
+		t.Errorf("Cancel(): got=%v want=%v", err, emailer.ErrMessageNotFound)
 	}
-	client, err := New(emailtest.NewConfig(tripper))
-	if err != nil {
-		t.Fatalf("New(): %v", err)
+	if diff := cmp.Diff(5, len(srv.Requests())); diff != "" {
+		t.Errorf("Requests(): diff=\n %v", diff)
 	}
 
-	email := emailer.Email{
-		From:        "a@a.com",
-		To:          []string{"b@b.com"},
-		Subject:     "sub",
-		HTMLContent: "html",
+	email.SendAt = time.Time{}
+	email.Subject = ""
+	if err := client.Send(context.Background(), email); err == nil || !strings.Contains(err.Error(), "status code(400)") {
+		t.Errorf("Send(): got=%v want=status code(400)", err)
 	}
-	raw, err := json.Marshal(email)
+	cfg := srv.Config()
+	cfg.Key = "wrong-key"
+	client, err = New(cfg)
 	if err != nil {
-		t.Fatalf("json.Marshal(%v): %v", email, err)
-	}
-
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/send", bytes.NewBuffer(raw))
-	rr := httptest.NewRecorder()
-	handler := emailer.HandlerFunc(client)
-	handler.ServeHTTP(rr, req)
-
-	if diff := cmp.Diff(http.StatusInternalServerError, rr.Code); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP code diff=%v", diff)
+		t.Fatalf("New(): %v", err)
 	}
-
-	if diff := cmp.Diff("Failed to send email\n", rr.Body.String()); diff != "" {
-		t.Errorf("HandlerFunc(): HTTP body diff=%v", diff)
+	if err := client.Send(context.Background(), email); err == nil || !strings.Contains(err.Error(), "status code(401)") {
+		t.Errorf("Send(): got=%v want=status code(401)", err)
 	}
 }
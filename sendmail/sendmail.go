@@ -0,0 +1,105 @@
+// Package sendmail hands emails over to the local MTA by piping MIME messages to a sendmail compatible binary.
+//
+// Example usage:
+//
+//	 c, err := sendmail.New("/usr/sbin/sendmail")
+//		if err != nil {
+//			//check err
+//		}
+//	 c.Send(ctx, email)
+package sendmail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/mrwormhole/emailer"
+	"github.com/mrwormhole/emailer/mime"
+)
+
+// maxStderr is how much of the binary stderr is kept in errors
+const maxStderr = 4 << 10
+
+// defaultArgs makes sendmail read recipients from the headers and not stop at a line with a single dot
+var defaultArgs = []string{"-t", "-i"}
+
+// ExitError is returned when the sendmail binary exits unsuccessfully
+type ExitError struct {
+	// Code is the exit code of the binary, see sysexits.h for its meaning
+	Code int
+	// Stderr is the trimmed standard error output of the binary
+	Stderr string
+
+	err *exec.ExitError
+}
+
+// Error returns the exit code and the stderr of the binary
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("sendmail exited with code(%d): %s", e.Code, e.Stderr)
+}
+
+// Unwrap returns the underlying exec.ExitError
+func (e *ExitError) Unwrap() error {
+	return e.err
+}
+
+// Client is sendmail client that pipes emails to a binary
+type Client struct {
+	path string
+	args []string
+}
+
+// New creates a new sendmail client for the binary at path, args replace the default -t -i arguments
+func New(path string, args ...string) (*Client, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, errors.New("sendmail path is blank")
+	}
+	p, err := exec.LookPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("exec.LookPath(%q): %v", path, err)
+	}
+	if len(args) == 0 {
+		args = defaultArgs
+	}
+	return &Client{path: p, args: args}, nil
+}
+
+// Send renders a given email as a MIME message and pipes it to the binary
+func (c *Client) Send(ctx context.Context, e emailer.Email) error {
+	_, err := c.SendMessage(ctx, e)
+	return err
+}
+
+// SendMessage renders a given email as a MIME message, pipes it to the binary and returns its Message-ID
+func (c *Client) SendMessage(ctx context.Context, e emailer.Email) (string, error) {
+	id := mime.NewMessageID(e.From)
+	// sendmail -t reads recipients from the headers including Bcc, then strips Bcc itself
+	raw, err := mime.New(e).MessageID(id).KeepBCC().Build()
+	if err != nil {
+		return "", fmt.Errorf("mime.New().Build(): %v", err)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.path, c.args...) //nolint:gosec //binary and arguments are configured by the operator
+	cmd.Stdin = bytes.NewReader(raw)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("cmd.Run(): %w", ctx.Err())
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			out := strings.TrimSpace(stderr.String())
+			if len(out) > maxStderr {
+				out = out[:maxStderr] + "..."
+			}
+			return "", &ExitError{Code: exitErr.ExitCode(), Stderr: out, err: exitErr}
+		}
+		return "", fmt.Errorf("cmd.Run(): %v", err)
+	}
+	return id, nil
+}
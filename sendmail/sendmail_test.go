@@ -0,0 +1,118 @@
+package sendmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+)
+
+// TestHelperProcess is not a real test, it acts as sendmail binary when SENDMAIL_HELPER is set
+func TestHelperProcess(t *testing.T) {
+	switch os.Getenv("SENDMAIL_HELPER") {
+	case "":
+		return
+	case "deliver":
+		raw, _ := io.ReadAll(os.Stdin)
+		_ = os.WriteFile(os.Getenv("SENDMAIL_OUT"), raw, 0o600)
+		os.Exit(0)
+	case "reject":
+		_, _ = io.Copy(io.Discard, os.Stdin)
+		fmt.Fprintln(os.Stderr, "sendmail: b@b.com... User unknown")
+		os.Exit(67)
+	case "hang":
+		time.Sleep(time.Minute)
+	}
+}
+
+// newHelper creates a client that runs the test binary as sendmail in given mode
+func newHelper(t *testing.T, mode string) *Client {
+	t.Helper()
+	t.Setenv("SENDMAIL_HELPER", mode)
+	c, err := New(os.Args[0], "-test.run=^TestHelperProcess$", "--", "-t", "-i")
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	return c
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("")
+	want := errors.New("sendmail path is blank")
+	if !cmp.Equal(want.Error(), err.Error()) {
+		t.Errorf("New(): got=%q want=%q", err, want)
+	}
+	if _, err := New(filepath.Join(t.TempDir(), "sendmail")); err == nil {
+		t.Error("New(): expected error, got nil")
+	}
+}
+
+var email = emailer.Email{
+	From:        "a@a.com",
+	To:          []string{"b@b.com"},
+	BCC:         []string{"bcc@bcc.com"},
+	Subject:     "sub",
+	TextContent: "text",
+}
+
+func TestSend(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "message.eml")
+	t.Setenv("SENDMAIL_OUT", out)
+	c := newHelper(t, "deliver")
+
+	id, err := c.SendMessage(context.Background(), email)
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatalf("os.Open(): %v", err)
+	}
+	defer f.Close()
+	msg, err := mail.ReadMessage(f)
+	if err != nil {
+		t.Fatalf("mail.ReadMessage(): %v", err)
+	}
+	if diff := cmp.Diff(id, msg.Header.Get("Message-ID")); diff != "" {
+		t.Errorf("SendMessage(): Message-ID diff=\n %v", diff)
+	}
+	if diff := cmp.Diff("bcc@bcc.com", msg.Header.Get("Bcc")); diff != "" {
+		t.Errorf("SendMessage(): Bcc diff=\n %v", diff)
+	}
+}
+
+func TestSend_ExitError(t *testing.T) {
+	c := newHelper(t, "reject")
+
+	err := c.Send(context.Background(), email)
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("Send(): got=%v want=%T", err, exitErr)
+	}
+	if diff := cmp.Diff(67, exitErr.Code); diff != "" {
+		t.Errorf("Send(): exit code diff=\n %v", diff)
+	}
+	if !strings.Contains(exitErr.Stderr, "User unknown") {
+		t.Errorf("Send(): stderr %q does not contain %q", exitErr.Stderr, "User unknown")
+	}
+}
+
+func TestSend_ContextCanceled(t *testing.T) {
+	c := newHelper(t, "hang")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := c.Send(ctx, email); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Send(): got=%v want=%v", err, context.DeadlineExceeded)
+	}
+}
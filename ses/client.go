@@ -0,0 +1,230 @@
+// Package ses makes it easy to send emails via Amazon SES. This package follows [ses spec] strictly.
+// Requests are signed with AWS Signature Version 4, so Config needs Key as access key ID and Secret as secret access key,
+// SessionToken is for temporary credentials and Region defaults to us-east-1.
+//
+// Example usage:
+//
+//	 email := emailer.Email{
+//		From:        "skywalker@jedi.com",
+//		To:          []string{"vindu@sith.com"},
+//		Subject:     "peace",
+//		TextContent: "peace was never an option",
+//	 }
+//	 c, err := New(emailer.Config{Key: "access-key-id", Secret: "secret-access-key", Region: "eu-west-1"})
+//		if err != nil {
+//			//check err
+//		}
+//	 c.Send(ctx, email)
+//
+// [ses spec]: https://docs.aws.amazon.com/ses/latest/APIReference-V2/API_SendEmail.html
+package ses
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mrwormhole/emailer"
+	"github.com/mrwormhole/emailer/mime"
+)
+
+const (
+	defaultRegion = "us-east-1"
+	emailsPath    = "/v2/email/outbound-emails"
+	// service is the signing name of SES
+	service = "ses"
+	charset = "UTF-8"
+)
+
+// Capabilities describes what SES can honour of an email
+var Capabilities = emailer.Capabilities{
+	// SES limits a message to 50 recipients and 40MB once attachments are base64 encoded
+	MaxRecipients:     50,
+	MaxAttachmentSize: 30 << 20,
+	InlineAttachments: true,
+}
+
+// EmailClient is SES email client to interact with emails
+type EmailClient struct {
+	creds          credentials
+	region         string
+	baseURL        string
+	markdownLayout *template.Template
+	client         http.Client
+}
+
+// New creates a new SES email client with given AWS credentials, region and http.Client
+func New(c emailer.Config) (*EmailClient, error) {
+	if strings.TrimSpace(c.Key) == "" {
+		return nil, errors.New("ses access key ID is blank")
+	}
+	if strings.TrimSpace(c.Secret) == "" {
+		return nil, errors.New("ses secret access key is blank")
+	}
+	region := cmp.Or(c.Region, defaultRegion)
+	e := &EmailClient{
+		creds:          credentials{accessKeyID: c.Key, secretAccessKey: c.Secret, sessionToken: c.SessionToken},
+		region:         region,
+		baseURL:        cmp.Or(strings.TrimSuffix(c.BaseURL, "/"), "https://email."+region+".amazonaws.com"),
+		markdownLayout: c.MarkdownLayout,
+		client:         c.Client,
+	}
+	return e, nil
+}
+
+func init() {
+	emailer.Register("ses", emailer.FactoryOf(New))
+}
+
+// Capabilities returns what SES can honour of an email
+func (c *EmailClient) Capabilities() emailer.Capabilities {
+	return Capabilities
+}
+
+// payload is a request that SES uses to send email
+type payload struct {
+	FromEmailAddress string      `json:"FromEmailAddress"`
+	Destination      destination `json:"Destination"`
+	Content          content     `json:"Content"`
+}
+
+type destination struct {
+	ToAddresses  []string `json:"ToAddresses"`
+	CcAddresses  []string `json:"CcAddresses,omitempty"`
+	BccAddresses []string `json:"BccAddresses,omitempty"`
+}
+
+// content is either a simple message that SES builds or a raw MIME message
+type content struct {
+	Simple *simple `json:"Simple,omitempty"`
+	Raw    *raw    `json:"Raw,omitempty"`
+}
+
+type simple struct {
+	Subject data `json:"Subject"`
+	Body    body `json:"Body"`
+}
+
+type body struct {
+	Text *data `json:"Text,omitempty"`
+	HTML *data `json:"Html,omitempty"`
+}
+
+type data struct {
+	Data    string `json:"Data"`
+	Charset string `json:"Charset"`
+}
+
+type raw struct {
+	// Data is base64 encoded by JSON
+	Data []byte `json:"Data"`
+}
+
+// result is a response when SES accepts an email
+type result struct {
+	MessageID string `json:"MessageId"`
+}
+
+type errorMessage struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// Send sends a given email
+func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
+	_, err := c.SendMessage(ctx, email)
+	return err
+}
+
+// SendMessage sends a given email and returns its SES message ID.
+// Emails with attachments are sent as raw MIME messages since the simple form cannot carry them
+func (c *EmailClient) SendMessage(ctx context.Context, email emailer.Email) (string, error) {
+	if err := c.Capabilities().Check(email); err != nil {
+		return "", err
+	}
+	email, err := email.RenderMarkdown(c.markdownLayout)
+	if err != nil {
+		return "", fmt.Errorf("email.RenderMarkdown(): %v", err)
+	}
+
+	var p payload
+	p.FromEmailAddress = email.From
+	p.Destination.ToAddresses = append(p.Destination.ToAddresses, email.To...)
+	p.Destination.CcAddresses = append(p.Destination.CcAddresses, email.CC...)
+	p.Destination.BccAddresses = append(p.Destination.BccAddresses, email.BCC...)
+	if len(email.Attachments) > 0 {
+		msg, err := mime.New(email).Build()
+		if err != nil {
+			return "", fmt.Errorf("mime.New().Build(): %v", err)
+		}
+		p.Content.Raw = &raw{Data: msg}
+	} else {
+		s := &simple{Subject: data{Data: email.Subject, Charset: charset}}
+		if email.TextContent != "" {
+			s.Body.Text = &data{Data: email.TextContent, Charset: charset}
+		}
+		if email.HTMLContent != "" {
+			s.Body.HTML = &data{Data: email.HTMLContent, Charset: charset}
+		}
+		p.Content.Simple = s
+	}
+
+	var r result
+	if err := c.do(ctx, http.MethodPost, c.baseURL+emailsPath, p, &r); err != nil {
+		return "", err
+	}
+	return r.MessageID, nil
+}
+
+// do sends body as signed JSON to given target of SES, then decodes a successful response into out when it is not nil
+func (c *EmailClient) do(ctx context.Context, method, target string, body, out any) error {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("json.Marshal(%v): %v", body, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("http.NewRequestWithContext(): %v", err)
+	}
+	req.Header.Add("accept", "application/json")
+	req.Header.Add("content-type", "application/json")
+	sign(req, reqBody, c.creds, c.region, service, time.Now())
+
+	resp, err := emailer.Do(&c.client, req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusOK {
+		if out == nil {
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("json.NewDecoder().Decode(): %v", err)
+		}
+		return nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("io.ReadAll(): %v", err)
+	}
+	return emailer.NewStatusError(resp.StatusCode, respBody, func(body []byte) (any, bool) {
+		var m errorMessage
+		err := json.Unmarshal(body, &m)
+		// SES names the error in a header such as "MessageRejected:http://internal.amazon.com/..."
+		m.Type, _, _ = strings.Cut(resp.Header.Get("X-Amzn-ErrorType"), ":")
+		return m, err == nil
+	})
+}
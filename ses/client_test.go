@@ -0,0 +1,155 @@
+package ses
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+	"github.com/mrwormhole/emailer/emailtest"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		c    emailer.Config
+		want string
+	}{
+		{name: "blank key", c: emailer.Config{Secret: "secret"}, want: "ses access key ID is blank"},
+		{name: "blank secret", c: emailer.Config{Key: "key"}, want: "ses secret access key is blank"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.c)
+			if err == nil || !cmp.Equal(tt.want, err.Error()) {
+				t.Errorf("New(): got=%v want=%q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew_Region(t *testing.T) {
+	var host, auth string
+	tripper := func(req *http.Request) *http.Response {
+		host, auth = req.URL.Host, req.Header.Get("Authorization")
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}
+	}
+	cfg := emailtest.NewConfig(tripper)
+	cfg.Region = "eu-west-1"
+	client, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+
+	email := emailer.Email{From: "a@a.com", To: []string{"b@b.com"}, Subject: "sub", TextContent: "text"}
+	if err := client.Send(context.Background(), email); err != nil {
+		t.Fatalf("Send(): %v", err)
+	}
+	if diff := cmp.Diff("email.eu-west-1.amazonaws.com", host); diff != "" {
+		t.Errorf("Send(): host diff=\n %v", diff)
+	}
+	if !strings.Contains(auth, "/eu-west-1/ses/aws4_request") {
+		t.Errorf("Send(): Authorization %q is not scoped to eu-west-1", auth)
+	}
+}
+
+// recipientPaths are the paths of the request body that hold each recipient
+var recipientPaths = map[string][]string{
+	"to":  {"destination.toaddresses"},
+	"cc":  {"destination.ccaddresses"},
+	"bcc": {"destination.bccaddresses"},
+}
+
+// errorBody is how SES rejects a request
+const errorBody = `{"message":"conformance failure"}`
+
+func TestConformance(t *testing.T) {
+	emailtest.RunSenderConformance(t, func(c emailer.Config) (emailer.Sender, error) {
+		return New(c)
+	}, emailtest.Provider{Fake: emailtest.NewSESServer, Recipients: recipientPaths, ErrorBody: errorBody})
+}
+
+func TestFakeServer(t *testing.T) {
+	srv := emailtest.NewSESServer(t)
+	client, err := New(srv.Config())
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+
+	email := emailer.Email{
+		From:        "a@a.com",
+		To:          []string{"b@b.com"},
+		BCC:         []string{"bcc@bcc.com"},
+		Subject:     "sub",
+		HTMLContent: "html",
+	}
+	id, err := client.SendMessage(context.Background(), email)
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	if id == "" {
+		t.Error("SendMessage(): message ID is empty")
+	}
+	var got payload
+	if err := json.Unmarshal(srv.LastRequest().Body, &got); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
+	}
+	want := payload{
+		FromEmailAddress: "a@a.com",
+		Destination:      destination{ToAddresses: []string{"b@b.com"}, BccAddresses: []string{"bcc@bcc.com"}},
+		Content: content{Simple: &simple{
+			Subject: data{Data: "sub", Charset: charset},
+			Body:    body{HTML: &data{Data: "html", Charset: charset}},
+		}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SendMessage(): payload diff=\n %v", diff)
+	}
+
+	email.Attachments = []emailer.Attachment{{Filename: "report.csv", ContentType: "text/csv", Data: []byte("a,b")}}
+	if err := client.Send(context.Background(), email); err != nil {
+		t.Fatalf("Send(): %v", err)
+	}
+	got = payload{}
+	if err := json.Unmarshal(srv.LastRequest().Body, &got); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
+	}
+	if got.Content.Simple != nil || got.Content.Raw == nil {
+		t.Fatalf("Send(): content=%+v want raw content", got.Content)
+	}
+	msg := string(got.Content.Raw.Data)
+	for _, want := range []string{"Subject: sub", "report.csv", "YSxi"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Send(): raw message does not contain %q", want)
+		}
+	}
+	if strings.Contains(msg, "bcc@bcc.com") {
+		t.Error("Send(): raw message reveals bcc recipients")
+	}
+
+	email.Attachments, email.Subject = nil, ""
+	var statusErr *emailer.StatusError
+	if err := client.Send(context.Background(), email); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Send(): got=%v want=status code(400)", err)
+	}
+	if diff := cmp.Diff(errorMessage{Type: "BadRequestException", Message: "Missing required field Subject"}, statusErr.Detail); diff != "" {
+		t.Errorf("Send(): error detail diff=\n %v", diff)
+	}
+
+	cfg := srv.Config()
+	cfg.Key = "wrong-key"
+	client, err = New(cfg)
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	email.Subject = "sub"
+	if err := client.Send(context.Background(), email); err == nil || !strings.Contains(err.Error(), "status code(403)") {
+		t.Errorf("Send(): got=%v want=status code(403)", err)
+	}
+}
@@ -0,0 +1,102 @@
+package ses
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// algorithm is the AWS Signature Version 4 algorithm name
+	algorithm = "AWS4-HMAC-SHA256"
+	// amzDateFormat is the time format of X-Amz-Date header
+	amzDateFormat = "20060102T150405Z"
+)
+
+// credentials are AWS credentials that sign requests
+type credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// sign adds X-Amz-Date, X-Amz-Security-Token and Authorization headers to req for given region and service, see [signature v4].
+// Every header of req at the time of signing and Host are signed.
+//
+// [signature v4]: https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html
+func sign(req *http.Request, body []byte, creds credentials, region, service string, t time.Time) {
+	amzDate := t.UTC().Format(amzDateFormat)
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(trimAll(v), ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, headers[k])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		// AWS wants spaces as %20 while url.Values encodes them as +
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hexSHA256(body),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{algorithm, amzDate, scope, hexSHA256([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+// trimAll trims values and collapses their inner spaces as canonical headers need
+func trimAll(values []string) []string {
+	trimmed := make([]string, 0, len(values))
+	for _, v := range values {
+		trimmed = append(trimmed, strings.Join(strings.Fields(v), " "))
+	}
+	return trimmed
+}
+
+// hexSHA256 returns hex encoded SHA-256 of data
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,70 @@
+package ses
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSign(t *testing.T) {
+	creds := credentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	at := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		creds  credentials
+		want   string
+	}{
+		{
+			// get-vanilla of AWS signature v4 test suite
+			name:   "vanilla",
+			method: http.MethodGet,
+			url:    "https://example.amazonaws.com/",
+			creds:  creds,
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			// get-vanilla-query-order-key-case of AWS signature v4 test suite
+			name:   "query order",
+			method: http.MethodGet,
+			url:    "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			creds:  creds,
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, http.NoBody)
+			if err != nil {
+				t.Fatalf("http.NewRequest(): %v", err)
+			}
+			sign(req, nil, tt.creds, "us-east-1", "service", at)
+			if diff := cmp.Diff(tt.want, req.Header.Get("Authorization")); diff != "" {
+				t.Errorf("sign(): diff=\n %v", diff)
+			}
+		})
+	}
+}
+
+func TestSign_SessionToken(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "https://email.eu-west-1.amazonaws.com/v2/email/outbound-emails", http.NoBody)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): %v", err)
+	}
+	sign(req, []byte("{}"), credentials{accessKeyID: "id", secretAccessKey: "secret", sessionToken: "token"}, "eu-west-1", "ses", time.Now())
+
+	if diff := cmp.Diff("token", req.Header.Get("X-Amz-Security-Token")); diff != "" {
+		t.Errorf("sign(): X-Amz-Security-Token diff=\n %v", diff)
+	}
+	if want := "SignedHeaders=host;x-amz-date;x-amz-security-token,"; !strings.Contains(req.Header.Get("Authorization"), want) {
+		t.Errorf("sign(): Authorization %q does not contain %q", req.Header.Get("Authorization"), want)
+	}
+}
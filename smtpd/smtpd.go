@@ -0,0 +1,634 @@
+// Package smtpd accepts SMTP submissions and relays them through an email sender, so tools that only speak SMTP can use any provider.
+//
+// Example usage:
+//
+//	 srv := &smtpd.Server{
+//		Addr:     ":2525",
+//		Sender:   sender,
+//		Username: "grafana",
+//		Password: "secret",
+//	 }
+//	 err := srv.ListenAndServe()
+package smtpd
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrwormhole/emailer"
+)
+
+const (
+	// defaultMaxSize is the message size limit when Server.MaxSize is not set
+	defaultMaxSize = 25 << 20
+	// defaultMaxRecipients is the recipient limit of a message when Server.MaxRecipients is not set
+	defaultMaxRecipients = 100
+	// commandTimeout is how long a client can stay silent, RFC 5321 section 4.5.3.2 suggests at least 5 minutes
+	commandTimeout = 5 * time.Minute
+	// sendTimeout is how long delivering a message via the sender can take
+	sendTimeout = 30 * time.Second
+	// maxLineLength is the command line limit, see RFC 5321 section 4.5.3.1.4
+	maxLineLength = 512
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Close
+var ErrServerClosed = errors.New("smtpd: server closed")
+
+// errLineTooLong is returned for command lines longer than maxLineLength
+var errLineTooLong = errors.New("line too long")
+
+// Server is SMTP submission server that relays every accepted message through Sender
+type Server struct {
+	// Addr is TCP address to listen on, ":2525" if empty
+	Addr string
+	// Domain is announced in the greeting, hostname if empty
+	Domain string
+	Sender emailer.Sender
+	// Username and Password are the only credentials accepted by AUTH PLAIN
+	Username string
+	Password string
+	// TLSConfig enables STARTTLS, then AUTH is only offered after STARTTLS
+	TLSConfig *tls.Config
+	// MaxSize is the message size limit in bytes, 25 MiB if zero
+	MaxSize int64
+	// MaxRecipients is the recipient limit of a message, 100 if zero
+	MaxRecipients int
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// ListenAndServe listens on Addr and serves SMTP connections until Close
+func (s *Server) ListenAndServe() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":2525"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("net.Listen(%q): %v", addr, err)
+	}
+	return s.Serve(l)
+}
+
+// Serve serves SMTP connections of l until Close
+func (s *Server) Serve(l net.Listener) error {
+	if s.Sender == nil {
+		return errors.New("smtpd: sender is nil")
+	}
+	if s.Username == "" || s.Password == "" {
+		return errors.New("smtpd: username or password is blank")
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listeners = append(s.listeners, l)
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return fmt.Errorf("l.Accept(): %v", err)
+		}
+		if !s.track(conn) {
+			_ = conn.Close()
+			return ErrServerClosed
+		}
+		s.wg.Go(func() { s.serveConn(conn) })
+	}
+}
+
+// Close stops listening, closes open connections and waits for their handlers to return
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var errs []error
+	for _, l := range s.listeners {
+		errs = append(errs, l.Close())
+	}
+	for c := range s.conns {
+		errs = append(errs, c.Close())
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return errors.Join(errs...)
+}
+
+// track remembers an open connection, it reports false when the server is closed
+func (s *Server) track(c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+	s.conns[c] = struct{}{}
+	return true
+}
+
+// untrack closes and forgets a connection
+func (s *Server) untrack(c net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = c.Close()
+	delete(s.conns, c)
+}
+
+// session is the state of a single SMTP connection
+type session struct {
+	srv  *Server
+	conn net.Conn
+	text *textproto.Conn
+	// lines bounds the lines read by text, so a line is not buffered whole before its length is checked
+	lines *lineReader
+
+	tls           bool
+	greeted       bool
+	authenticated bool
+	from          string
+	recipients    []string
+}
+
+// serveConn runs the command loop of a connection
+func (s *Server) serveConn(conn net.Conn) {
+	sess := &session{srv: s}
+	sess.setConn(conn)
+	_, sess.tls = conn.(*tls.Conn)
+	// the connection is replaced after STARTTLS, so the current one is untracked
+	defer func() { s.untrack(sess.conn) }()
+
+	domain := s.Domain
+	if domain == "" {
+		domain, _ = os.Hostname()
+	}
+	sess.reply(220, "%s ESMTP emailer", domain)
+	for {
+		_ = conn.SetDeadline(time.Now().Add(commandTimeout))
+		line, err := sess.readLine()
+		if errors.Is(err, errLineTooLong) {
+			sess.reply(500, "5.5.2 Line too long")
+			continue
+		}
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		if !sess.handle(strings.ToUpper(verb), strings.TrimSpace(arg), domain) {
+			return
+		}
+	}
+}
+
+// handle runs a single command, it reports false when the connection must be closed
+func (sess *session) handle(verb, arg, domain string) bool {
+	switch verb {
+	case "HELO", "EHLO":
+		if arg == "" {
+			sess.reply(501, "5.5.4 Domain is required")
+			return true
+		}
+		sess.reset()
+		sess.greeted = true
+		if verb == "HELO" {
+			sess.reply(250, "%s", domain)
+			return true
+		}
+		lines := []string{domain, "PIPELINING", fmt.Sprintf("SIZE %d", sess.srv.maxSize()), "8BITMIME", "ENHANCEDSTATUSCODES"}
+		if sess.srv.TLSConfig != nil && !sess.tls {
+			lines = append(lines, "STARTTLS")
+		}
+		if sess.authAllowed() {
+			lines = append(lines, "AUTH PLAIN")
+		}
+		sess.replyLines(250, lines)
+	case "STARTTLS":
+		return sess.startTLS()
+	case "AUTH":
+		sess.auth(arg)
+	case "MAIL":
+		sess.mail(arg)
+	case "RCPT":
+		sess.rcpt(arg)
+	case "DATA":
+		return sess.data()
+	case "RSET":
+		sess.reset()
+		sess.reply(250, "2.0.0 OK")
+	case "NOOP":
+		sess.reply(250, "2.0.0 OK")
+	case "VRFY":
+		sess.reply(252, "2.5.0 Cannot verify user, but will accept message")
+	case "QUIT":
+		sess.reply(221, "2.0.0 Bye")
+		return false
+	default:
+		sess.reply(502, "5.5.2 Command not recognized")
+	}
+	return true
+}
+
+// startTLS upgrades the connection, the client has to greet again afterwards
+func (sess *session) startTLS() bool {
+	if sess.srv.TLSConfig == nil || sess.tls {
+		sess.reply(502, "5.5.1 STARTTLS is not available")
+		return true
+	}
+	sess.reply(220, "2.0.0 Ready to start TLS")
+	tlsConn := tls.Server(sess.conn, sess.srv.TLSConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		slog.LogAttrs(context.Background(), slog.LevelDebug, "tlsConn.Handshake()", slog.String("err", err.Error()))
+		return false
+	}
+	sess.srv.mu.Lock()
+	delete(sess.srv.conns, sess.conn)
+	sess.srv.conns[tlsConn] = struct{}{}
+	sess.srv.mu.Unlock()
+
+	sess.setConn(tlsConn)
+	sess.tls = true
+	sess.greeted = false
+	sess.authenticated = false
+	sess.reset()
+	return true
+}
+
+// auth runs AUTH PLAIN, see RFC 4616
+func (sess *session) auth(arg string) {
+	switch {
+	case !sess.greeted:
+		sess.reply(503, "5.5.1 Send EHLO first")
+		return
+	case sess.authenticated:
+		sess.reply(503, "5.5.1 Already authenticated")
+		return
+	case !sess.authAllowed():
+		sess.reply(538, "5.7.11 Encryption required for requested authentication mechanism")
+		return
+	}
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	if !strings.EqualFold(mechanism, "PLAIN") {
+		sess.reply(504, "5.5.4 Unrecognized authentication type")
+		return
+	}
+	if initial == "" {
+		sess.reply(334, "")
+		line, err := sess.readLine()
+		if errors.Is(err, errLineTooLong) {
+			sess.reply(500, "5.5.2 Line too long")
+			return
+		}
+		if err != nil {
+			return
+		}
+		initial = line
+	}
+	if initial == "*" {
+		sess.reply(501, "5.0.0 Authentication canceled")
+		return
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(initial)
+	if err != nil {
+		sess.reply(501, "5.5.2 Cannot decode response")
+		return
+	}
+	parts := bytes.Split(raw, []byte{0})
+	if len(parts) != 3 {
+		sess.reply(501, "5.5.2 Malformed PLAIN response")
+		return
+	}
+	userOK := subtle.ConstantTimeCompare(parts[1], []byte(sess.srv.Username)) == 1
+	passOK := subtle.ConstantTimeCompare(parts[2], []byte(sess.srv.Password)) == 1
+	if !userOK || !passOK {
+		sess.reply(535, "5.7.8 Authentication credentials invalid")
+		return
+	}
+	sess.authenticated = true
+	sess.reply(235, "2.7.0 Authentication successful")
+}
+
+// mail starts a transaction with MAIL FROM:<address>
+func (sess *session) mail(arg string) {
+	switch {
+	case !sess.authenticated:
+		sess.reply(530, "5.7.0 Authentication required")
+		return
+	case sess.from != "":
+		sess.reply(503, "5.5.1 Sender already specified")
+		return
+	}
+	addr, params, ok := pathArg(arg, "FROM:")
+	if !ok {
+		sess.reply(501, "5.5.4 Syntax: MAIL FROM:<address>")
+		return
+	}
+	for _, p := range params {
+		k, v, _ := strings.Cut(p, "=")
+		if strings.EqualFold(k, "SIZE") {
+			if size, err := strconv.ParseInt(v, 10, 64); err == nil && size > sess.srv.maxSize() {
+				sess.reply(552, "5.3.4 Message size exceeds fixed limit")
+				return
+			}
+		}
+	}
+	// null reverse-path <> is valid for bounces, the From header is used then
+	sess.from = cmp.Or(addr, "<>")
+	sess.reply(250, "2.1.0 OK")
+}
+
+// rcpt adds a recipient with RCPT TO:<address>
+func (sess *session) rcpt(arg string) {
+	if sess.from == "" {
+		sess.reply(503, "5.5.1 Send MAIL first")
+		return
+	}
+	addr, _, ok := pathArg(arg, "TO:")
+	if !ok || addr == "" {
+		sess.reply(501, "5.5.4 Syntax: RCPT TO:<address>")
+		return
+	}
+	if len(sess.recipients) >= sess.srv.maxRecipients() {
+		sess.reply(452, "4.5.3 Too many recipients")
+		return
+	}
+	sess.recipients = append(sess.recipients, addr)
+	sess.reply(250, "2.1.5 OK")
+}
+
+// data reads the message then relays it, it reports false when the connection is broken
+func (sess *session) data() bool {
+	if len(sess.recipients) == 0 {
+		sess.reply(503, "5.5.1 Send RCPT first")
+		return true
+	}
+	sess.reply(354, "Start mail input; end with <CRLF>.<CRLF>")
+
+	// message lines are only limited by the message size
+	sess.lines.max = 0
+	defer func() { sess.lines.max = lineReaderMax }()
+	maxSize := sess.srv.maxSize()
+	dr := sess.text.DotReader()
+	raw, err := io.ReadAll(io.LimitReader(dr, maxSize+1))
+	if err != nil {
+		return false
+	}
+	defer sess.reset()
+	if int64(len(raw)) > maxSize {
+		// the rest of the message has to be read before replying
+		if _, err := io.Copy(io.Discard, dr); err != nil {
+			return false
+		}
+		sess.reply(552, "5.3.4 Message size exceeds fixed limit")
+		return true
+	}
+
+	e, err := emailer.ParseMIME(bytes.NewReader(raw))
+	if err != nil {
+		sess.reply(554, "5.6.0 Malformed message: %v", err)
+		return true
+	}
+	emails := envelope(e, sess.from, sess.recipients)
+	for _, e := range emails {
+		if m := e.ValidationMsg(); m != "" {
+			sess.reply(554, "5.6.0 Message rejected: %s", m)
+			return true
+		}
+	}
+
+	var ids []string
+	for i, e := range emails {
+		id, err := sess.srv.send(e)
+		if err != nil {
+			slog.LogAttrs(context.Background(), slog.LevelError, fmt.Sprintf("%T.Send()", sess.srv.Sender), slog.Any("email", e), slog.String("err", err.Error()))
+			if i > 0 {
+				// the client would send the copies that are delivered again, so a partial delivery is not retried
+				sess.reply(554, "5.0.0 Delivered to %d of %d recipients, then failed", i, len(emails))
+				return true
+			}
+			code, msg := replyFor(err)
+			sess.reply(code, "%s", msg)
+			return true
+		}
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > 0 {
+		sess.reply(250, "2.0.0 OK queued as %s", strings.Join(ids, " "))
+		return true
+	}
+	sess.reply(250, "2.0.0 OK")
+	return true
+}
+
+// send relays e to the sender of the server within sendTimeout
+func (s *Server) send(e emailer.Email) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	return emailer.SendMessage(ctx, s.Sender, e)
+}
+
+// setConn makes c the connection of the session, its lines are read through a lineReader
+func (sess *session) setConn(c net.Conn) {
+	sess.conn = c
+	sess.lines = &lineReader{r: bufio.NewReader(c), max: lineReaderMax}
+	sess.text = &textproto.Conn{
+		Reader: *textproto.NewReader(bufio.NewReader(sess.lines)),
+		Writer: *textproto.NewWriter(bufio.NewWriter(c)),
+	}
+}
+
+// readLine reads a command line, lines longer than maxLineLength fail with errLineTooLong
+func (sess *session) readLine() (string, error) {
+	line, err := sess.text.ReadLine()
+	// bufio returns what was read before errLineTooLong as a line, so the error shows as its length
+	if err == nil && len(line) > maxLineLength {
+		return "", errLineTooLong
+	}
+	return line, err
+}
+
+// reset forgets the current transaction
+func (sess *session) reset() {
+	sess.from = ""
+	sess.recipients = nil
+}
+
+// authAllowed reports whether credentials can be sent, which needs TLS when the server has it
+func (sess *session) authAllowed() bool {
+	return sess.srv.TLSConfig == nil || sess.tls
+}
+
+// reply writes a single line reply
+func (sess *session) reply(code int, format string, args ...any) {
+	_ = sess.text.PrintfLine("%d %s", code, fmt.Sprintf(format, args...))
+}
+
+// replyLines writes a multiline reply
+func (sess *session) replyLines(code int, lines []string) {
+	for i, l := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		_ = sess.text.PrintfLine("%d%s%s", code, sep, l)
+	}
+}
+
+// maxSize returns the message size limit
+func (s *Server) maxSize() int64 {
+	if s.MaxSize > 0 {
+		return s.MaxSize
+	}
+	return defaultMaxSize
+}
+
+// maxRecipients returns the recipient limit of a message
+func (s *Server) maxRecipients() int {
+	if s.MaxRecipients > 0 {
+		return s.MaxRecipients
+	}
+	return defaultMaxRecipients
+}
+
+// pathArg parses "FROM:<address> PARAMS" style arguments of MAIL and RCPT
+func pathArg(arg, prefix string) (string, []string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", nil, false
+	}
+	fields := strings.Fields(strings.TrimSpace(arg[len(prefix):]))
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "<") || !strings.HasSuffix(fields[0], ">") {
+		return "", nil, false
+	}
+	addr := strings.Trim(fields[0], "<>")
+	if addr != "" {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return "", nil, false
+		}
+	}
+	return addr, fields[1:], true
+}
+
+// lineReaderMax is how many bytes a command line can have before its line feed, the line and its carriage return
+const lineReaderMax = maxLineLength + 1
+
+// lineReader fails once a line has more than max bytes before its line feed, then skips the rest of that line.
+// It reads at most up to the limit at a time, so a line that is too long is never buffered whole. Zero max has no limit
+type lineReader struct {
+	r    *bufio.Reader
+	max  int
+	n    int
+	skip bool
+}
+
+func (lr *lineReader) Read(p []byte) (int, error) {
+	for lr.skip {
+		_, err := lr.r.ReadSlice('\n')
+		if err == nil {
+			lr.skip = false
+		} else if !errors.Is(err, bufio.ErrBufferFull) {
+			return 0, err
+		}
+	}
+	if lr.max > 0 {
+		// a line can be past the limit already when it was read while there was no limit
+		p = p[:min(len(p), max(lr.max-lr.n+1, 1))]
+	}
+	n, err := lr.r.Read(p)
+	for _, b := range p[:n] {
+		if b == '\n' {
+			lr.n = 0
+		} else {
+			lr.n++
+		}
+	}
+	if lr.max > 0 && lr.n > lr.max {
+		lr.n, lr.skip = 0, true
+		return n, errLineTooLong
+	}
+	return n, err
+}
+
+// envelope makes the recipients of e match the envelope, recipients that are not in To or Cc headers become Bcc.
+// Providers need a To recipient, so when none is in To the Cc recipients are moved there since they are shown anyway,
+// and undisclosed recipients such as the ones of Bcc-only messages get a copy each with themselves in To
+func envelope(e emailer.Email, from string, recipients []string) []emailer.Email {
+	contains := func(list []string, addr string) bool {
+		return slices.ContainsFunc(list, func(a string) bool { return strings.EqualFold(a, addr) })
+	}
+	if e.From == "" && from != "<>" {
+		e.From = from
+	}
+
+	var to, cc, bcc []string
+	for _, r := range recipients {
+		switch {
+		case contains(to, r) || contains(cc, r) || contains(bcc, r):
+		case contains(e.To, r):
+			to = append(to, r)
+		case contains(e.CC, r):
+			cc = append(cc, r)
+		default:
+			bcc = append(bcc, r)
+		}
+	}
+	if len(to) == 0 {
+		to, cc = cc, nil
+	}
+	if len(to) > 0 {
+		e.To, e.CC, e.BCC = to, cc, bcc
+		return []emailer.Email{e}
+	}
+
+	emails := make([]emailer.Email, 0, len(bcc))
+	for _, r := range bcc {
+		e.To, e.CC, e.BCC = []string{r}, nil, nil
+		emails = append(emails, e)
+	}
+	return emails
+}
+
+// replyFor maps a sender error to an SMTP reply, so clients retry only when it may succeed later
+func replyFor(err error) (int, string) {
+	var statusErr *emailer.StatusError
+	switch {
+	case errors.As(err, &statusErr) && !statusErr.Temporary():
+		return 554, fmt.Sprintf("5.0.0 Rejected by provider with status code %d", statusErr.StatusCode)
+	case errors.Is(err, emailer.ErrScheduleHorizon), errors.Is(err, emailer.ErrIncompatible), errors.Is(err, emailer.ErrRejected),
+		errors.Is(err, errors.ErrUnsupported):
+		return 554, "5.0.0 Rejected: " + err.Error()
+	default:
+		return 451, "4.3.0 Temporary failure, try again later"
+	}
+}
@@ -0,0 +1,457 @@
+package smtpd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+	"github.com/mrwormhole/emailer/acs"
+	"github.com/mrwormhole/emailer/emailtest"
+	"github.com/mrwormhole/emailer/mandrill"
+)
+
+const (
+	testUsername = "grafana"
+	testPassword = "secret"
+	testMessage  = "From: Alerts <alerts@example.com>\r\n" +
+		"To: oncall@example.com\r\n" +
+		"Cc: team@example.com\r\n" +
+		"Subject: Disk is full\r\n" +
+		"\r\n" +
+		"Disk usage is at 99%.\r\n"
+)
+
+// startServer serves srv on a random local port until the test ends
+func startServer(t *testing.T, srv *Server) string {
+	t.Helper()
+	slog.SetLogLoggerLevel(slog.Level(100))
+	srv.Username, srv.Password = testUsername, testPassword
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(): %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(l) }()
+	t.Cleanup(func() {
+		_ = srv.Close()
+		if err := <-done; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("srv.Serve(): err=%v, want=%v", err, ErrServerClosed)
+		}
+	})
+	return l.Addr().String()
+}
+
+// send submits msg with AUTH PLAIN, it returns the reply code of the failed step
+func send(addr, password, from string, to []string, msg string) error {
+	host, _, _ := net.SplitHostPort(addr)
+	return smtp.SendMail(addr, smtp.PlainAuth("", testUsername, password, host), from, to, []byte(msg))
+}
+
+// replyCode returns the SMTP reply code of err, 0 when it is not an SMTP reply
+func replyCode(err error) int {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return tpErr.Code
+	}
+	return 0
+}
+
+func TestServer_Send(t *testing.T) {
+	tests := []struct {
+		name       string
+		from       string
+		recipients []string
+		msg        string
+		want       []emailer.Email
+	}{
+		{
+			name:       "header recipients",
+			from:       "bounces@example.com",
+			recipients: []string{"oncall@example.com", "team@example.com"},
+			msg:        testMessage,
+			want: []emailer.Email{{
+				From:        "alerts@example.com",
+				To:          []string{"oncall@example.com"},
+				CC:          []string{"team@example.com"},
+				Subject:     "Disk is full",
+				TextContent: "Disk usage is at 99%.\n",
+			}},
+		},
+		{
+			name:       "envelope only recipient becomes bcc",
+			from:       "bounces@example.com",
+			recipients: []string{"oncall@example.com", "audit@example.com"},
+			msg:        testMessage,
+			want: []emailer.Email{{
+				From:        "alerts@example.com",
+				To:          []string{"oncall@example.com"},
+				BCC:         []string{"audit@example.com"},
+				Subject:     "Disk is full",
+				TextContent: "Disk usage is at 99%.\n",
+			}},
+		},
+		{
+			name:       "undisclosed recipients send no copy to sender",
+			from:       "alerts@example.com",
+			recipients: []string{"audit@example.com"},
+			msg:        "From: alerts@example.com\r\nTo: undisclosed-recipients:;\r\nSubject: Audit\r\n\r\naudit\r\n",
+			want: []emailer.Email{{
+				From:        "alerts@example.com",
+				To:          []string{"audit@example.com"},
+				Subject:     "Audit",
+				TextContent: "audit\n",
+			}},
+		},
+		{
+			name:       "no from header",
+			from:       "printer@example.com",
+			recipients: []string{"scans@example.com"},
+			msg:        "To: scans@example.com\r\nSubject: Scan\r\n\r\nscanned\r\n",
+			want: []emailer.Email{{
+				From:        "printer@example.com",
+				To:          []string{"scans@example.com"},
+				Subject:     "Scan",
+				TextContent: "scanned\n",
+			}},
+		},
+		{
+			name:       "undisclosed recipients get a copy each",
+			from:       "jenkins@example.com",
+			recipients: []string{"audit@example.com", "legal@example.com"},
+			msg:        "From: jenkins@example.com\r\nTo: undisclosed-recipients:;\r\nSubject: Build failed\r\n\r\nfailed\r\n",
+			want: []emailer.Email{
+				{From: "jenkins@example.com", To: []string{"audit@example.com"}, Subject: "Build failed", TextContent: "failed\n"},
+				{From: "jenkins@example.com", To: []string{"legal@example.com"}, Subject: "Build failed", TextContent: "failed\n"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &emailtest.Recorder{}
+			addr := startServer(t, &Server{Sender: rec, Domain: "mx.example.com"})
+
+			if err := send(addr, testPassword, tt.from, tt.recipients, tt.msg); err != nil {
+				t.Fatalf("smtp.SendMail(): %v", err)
+			}
+			if diff := cmp.Diff(tt.want, rec.Emails()); diff != "" {
+				t.Errorf("Server.Serve(): diff=\n %v", diff)
+			}
+		})
+	}
+}
+
+func TestServer_Replies(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		maxSize  int64
+		sendErr  error
+		msg      string
+		rcpts    []string
+		// failCall is the send that fails with sendErr, 0 means the first one
+		failCall   int
+		wantCode   int
+		wantEmails int
+	}{
+		{
+			name:     "wrong password",
+			password: "wrong",
+			msg:      testMessage,
+			wantCode: 535,
+		},
+		{
+			name:     "message too large",
+			password: testPassword,
+			maxSize:  64,
+			msg:      testMessage,
+			wantCode: 552,
+		},
+		{
+			name:     "invalid message",
+			password: testPassword,
+			msg:      "To: oncall@example.com\r\nSubject: Empty\r\n\r\n",
+			wantCode: 554,
+		},
+		{
+			name:       "bcc only message fails after a copy",
+			password:   testPassword,
+			sendErr:    &emailer.StatusError{StatusCode: 429, Detail: "slow down"},
+			failCall:   2,
+			msg:        "From: alerts@example.com\r\nSubject: Audit\r\n\r\naudit\r\n",
+			rcpts:      []string{"audit@example.com", "legal@example.com"},
+			wantCode:   554,
+			wantEmails: 1,
+		},
+		{
+			name:     "provider rejects",
+			password: testPassword,
+			sendErr:  &emailer.StatusError{StatusCode: 400, Detail: "invalid sender"},
+			msg:      testMessage,
+			wantCode: 554,
+		},
+		{
+			name:     "provider rate limits",
+			password: testPassword,
+			sendErr:  &emailer.StatusError{StatusCode: 429, Detail: "slow down"},
+			msg:      testMessage,
+			wantCode: 451,
+		},
+		{
+			name:     "provider unreachable",
+			password: testPassword,
+			sendErr:  errors.New("dial tcp: connection refused"),
+			msg:      testMessage,
+			wantCode: 451,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &emailtest.Recorder{}
+			if tt.sendErr != nil {
+				call := tt.failCall
+				if call == 0 {
+					call = 1
+				}
+				rec.FailCall(call, tt.sendErr)
+			}
+			addr := startServer(t, &Server{Sender: rec, MaxSize: tt.maxSize})
+
+			rcpts := tt.rcpts
+			if rcpts == nil {
+				rcpts = []string{"oncall@example.com"}
+			}
+			err := send(addr, tt.password, "bounces@example.com", rcpts, tt.msg)
+			if got := replyCode(err); got != tt.wantCode {
+				t.Errorf("smtp.SendMail(): code=%d, want=%d, err=%v", got, tt.wantCode, err)
+			}
+			if got := len(rec.Emails()); got != tt.wantEmails {
+				t.Errorf("Recorder.Emails(): len=%d, want=%d", got, tt.wantEmails)
+			}
+		})
+	}
+}
+
+func TestServer_Commands(t *testing.T) {
+	addr := startServer(t, &Server{Sender: &emailtest.Recorder{}, MaxRecipients: 1})
+	conn, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("textproto.Dial(): %v", err)
+	}
+	defer conn.Close()
+	if _, _, err := conn.ReadResponse(220); err != nil {
+		t.Fatalf("greeting: %v", err)
+	}
+
+	tests := []struct {
+		cmd      string
+		wantCode int
+	}{
+		{cmd: "MAIL FROM:<bounces@example.com>", wantCode: 530},
+		{cmd: "AUTH PLAIN AGdyYWZhbmEAc2VjcmV0", wantCode: 503},
+		{cmd: "EHLO client.example.com", wantCode: 250},
+		{cmd: "MAIL FROM:<bounces@example.com>", wantCode: 530},
+		{cmd: "AUTH LOGIN", wantCode: 504},
+		{cmd: "AUTH PLAIN", wantCode: 334},
+		{cmd: strings.Repeat("A", 64<<10), wantCode: 500},
+		{cmd: "NOOP " + strings.Repeat("x", maxLineLength-len("NOOP ")), wantCode: 250},
+		{cmd: "NOOP " + strings.Repeat("x", maxLineLength), wantCode: 500},
+		{cmd: "NOOP " + strings.Repeat("x", 64<<10), wantCode: 500},
+		{cmd: "AUTH PLAIN AGdyYWZhbmEAc2VjcmV0", wantCode: 235},
+		{cmd: "RCPT TO:<oncall@example.com>", wantCode: 503},
+		{cmd: "MAIL FROM:bounces@example.com", wantCode: 501},
+		{cmd: "MAIL FROM:<bounces@example.com> SIZE=99999999999", wantCode: 552},
+		{cmd: "MAIL FROM:<>", wantCode: 250},
+		{cmd: "DATA", wantCode: 503},
+		{cmd: "RCPT TO:<oncall@example.com>", wantCode: 250},
+		{cmd: "RCPT TO:<team@example.com>", wantCode: 452},
+		{cmd: "RSET", wantCode: 250},
+		{cmd: "NOOP", wantCode: 250},
+		{cmd: "VRFY oncall@example.com", wantCode: 252},
+		{cmd: "TURN", wantCode: 502},
+		{cmd: "STARTTLS", wantCode: 502},
+		{cmd: "QUIT", wantCode: 221},
+	}
+	for _, tt := range tests {
+		if err := conn.PrintfLine("%s", tt.cmd); err != nil {
+			t.Fatalf("conn.PrintfLine(%q): %v", tt.cmd, err)
+		}
+		code, msg, err := conn.ReadResponse(0)
+		if err != nil {
+			t.Fatalf("conn.ReadResponse(%q): %v", tt.cmd, err)
+		}
+		if code != tt.wantCode {
+			t.Errorf("%s: code=%d, want=%d, msg=%q", tt.cmd, code, tt.wantCode, msg)
+		}
+	}
+}
+
+func TestServer_STARTTLS(t *testing.T) {
+	rec := &emailtest.Recorder{}
+	addr := startServer(t, &Server{Sender: rec, TLSConfig: &tls.Config{Certificates: []tls.Certificate{selfSigned(t)}}})
+
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("smtp.Dial(): %v", err)
+	}
+	defer c.Close()
+	if err := c.Hello("client.example.com"); err != nil {
+		t.Fatalf("c.Hello(): %v", err)
+	}
+	if ok, _ := c.Extension("AUTH"); ok {
+		t.Errorf("c.Extension(AUTH): AUTH is offered before STARTTLS")
+	}
+	if err := c.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil { //nolint:gosec //self-signed test certificate
+		t.Fatalf("c.StartTLS(): %v", err)
+	}
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		t.Errorf("c.Extension(STARTTLS): STARTTLS is offered after STARTTLS")
+	}
+	if err := c.Auth(smtp.PlainAuth("", testUsername, testPassword, "127.0.0.1")); err != nil {
+		t.Fatalf("c.Auth(): %v", err)
+	}
+	if err := c.Mail("bounces@example.com"); err != nil {
+		t.Fatalf("c.Mail(): %v", err)
+	}
+	if err := c.Rcpt("oncall@example.com"); err != nil {
+		t.Fatalf("c.Rcpt(): %v", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		t.Fatalf("c.Data(): %v", err)
+	}
+	if _, err := w.Write([]byte(testMessage)); err != nil {
+		t.Fatalf("w.Write(): %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("w.Close(): %v", err)
+	}
+	if err := c.Quit(); err != nil {
+		t.Fatalf("c.Quit(): %v", err)
+	}
+	rec.AssertSentTo(t, "oncall@example.com")
+}
+
+func TestEnvelope(t *testing.T) {
+	tests := []struct {
+		name       string
+		e          emailer.Email
+		from       string
+		recipients []string
+		want       []emailer.Email
+	}{
+		{
+			name:       "header recipients outside envelope are dropped",
+			e:          emailer.Email{From: "a@example.com", To: []string{"b@example.com", "c@example.com"}, CC: []string{"d@example.com"}},
+			from:       "a@example.com",
+			recipients: []string{"B@example.com", "d@example.com"},
+			want:       []emailer.Email{{From: "a@example.com", To: []string{"B@example.com"}, CC: []string{"d@example.com"}}},
+		},
+		{
+			name:       "bcc header is replaced by envelope",
+			e:          emailer.Email{From: "a@example.com", To: []string{"b@example.com"}, BCC: []string{"x@example.com"}},
+			from:       "a@example.com",
+			recipients: []string{"b@example.com", "c@example.com", "c@example.com"},
+			want:       []emailer.Email{{From: "a@example.com", To: []string{"b@example.com"}, BCC: []string{"c@example.com"}}},
+		},
+		{
+			name:       "sole bcc recipient becomes to",
+			e:          emailer.Email{From: "a@example.com", To: []string{"list@example.com"}},
+			from:       "<>",
+			recipients: []string{"c@example.com"},
+			want:       []emailer.Email{{From: "a@example.com", To: []string{"c@example.com"}}},
+		},
+		{
+			name:       "cc recipients become to",
+			e:          emailer.Email{From: "a@example.com", CC: []string{"c@example.com", "d@example.com"}},
+			from:       "a@example.com",
+			recipients: []string{"c@example.com", "d@example.com", "e@example.com"},
+			want:       []emailer.Email{{From: "a@example.com", To: []string{"c@example.com", "d@example.com"}, BCC: []string{"e@example.com"}}},
+		},
+		{
+			name:       "many bcc recipients get a copy each",
+			e:          emailer.Email{From: "a@example.com"},
+			from:       "a@example.com",
+			recipients: []string{"c@example.com", "d@example.com"},
+			want: []emailer.Email{
+				{From: "a@example.com", To: []string{"c@example.com"}},
+				{From: "a@example.com", To: []string{"d@example.com"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := envelope(tt.e, tt.from, tt.recipients)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("envelope(): diff=\n %v", diff)
+			}
+		})
+	}
+}
+
+func TestReplyFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+	}{
+		{name: "bad request", err: &emailer.StatusError{StatusCode: 400}, wantCode: 554},
+		{name: "wrapped unauthorized", err: errors.Join(errors.New("send"), &emailer.StatusError{StatusCode: 401}), wantCode: 554},
+		{name: "too many requests", err: &emailer.StatusError{StatusCode: 429}, wantCode: 451},
+		{name: "server error", err: &emailer.StatusError{StatusCode: 502}, wantCode: 451},
+		{name: "unsupported", err: errors.ErrUnsupported, wantCode: 554},
+		{name: "incompatible", err: fmt.Errorf("%w: 60 recipients exceed the limit of 50", emailer.ErrIncompatible), wantCode: 554},
+		{name: "mandrill rejects", err: &mandrill.RejectError{Results: []mandrill.Result{{Email: "b@b.com", Status: "rejected"}}}, wantCode: 554},
+		{name: "acs operation failed", err: &acs.OperationError{ID: "op-1", Status: acs.StatusFailed}, wantCode: 554},
+		{name: "acs operation canceled", err: &acs.OperationError{ID: "op-1", Status: acs.StatusCanceled}, wantCode: 554},
+		{name: "unknown", err: errors.New("connection reset"), wantCode: 451},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, msg := replyFor(tt.err)
+			if code != tt.wantCode {
+				t.Errorf("replyFor(): code=%d, want=%d, msg=%q", code, tt.wantCode, msg)
+			}
+		})
+	}
+}
+
+// selfSigned creates a certificate for 127.0.0.1
+func selfSigned(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey(): %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate(): %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
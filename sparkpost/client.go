@@ -0,0 +1,230 @@
+// Package sparkpost makes it easy to send emails via sparkpost provider. This package follows [sparkpost spec] strictly.
+// Accounts on the EU region need Config.Region set to "eu".
+//
+// Example usage:
+//
+//	 email := emailer.Email{
+//		From:        "skywalker@jedi.com",
+//		To:          []string{"vindu@sith.com"},
+//		Subject:     "peace",
+//		TextContent: "peace was never an option",
+//	 }
+//	 c, err := New(emailer.Config{Key: "api-key"})
+//		if err != nil {
+//			//check err
+//		}
+//	 c.Send(ctx, email)
+//
+// [sparkpost spec]: https://developers.sparkpost.com/api/transmissions/
+package sparkpost
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/mrwormhole/emailer"
+)
+
+const (
+	baseURL           = "https://api.sparkpost.com"
+	euBaseURL         = "https://api.eu.sparkpost.com"
+	transmissionsPath = "/api/v1/transmissions"
+	// regionEU is Config.Region of accounts on the EU region
+	regionEU = "eu"
+)
+
+// Capabilities describes what sparkpost can honour of an email
+var Capabilities = emailer.Capabilities{
+	// sparkpost limits a transmission to 20MB
+	MaxAttachmentSize: 20 << 20,
+	InlineAttachments: true,
+}
+
+// EmailClient is sparkpost email client to interact with emails
+type EmailClient struct {
+	key            string
+	baseURL        string
+	markdownLayout *template.Template
+	client         http.Client
+}
+
+// New creates a new sparkpost email client with given API key, region and http.Client
+func New(c emailer.Config) (*EmailClient, error) {
+	if strings.TrimSpace(c.Key) == "" {
+		return nil, errors.New("sparkpost API key is blank")
+	}
+	host := baseURL
+	switch {
+	case strings.EqualFold(c.Region, regionEU):
+		host = euBaseURL
+	case c.Region != "" && !strings.EqualFold(c.Region, "us"):
+		return nil, fmt.Errorf("sparkpost region %q is not us or eu", c.Region)
+	}
+	e := &EmailClient{
+		key:            c.Key,
+		baseURL:        cmp.Or(strings.TrimSuffix(c.BaseURL, "/"), host),
+		markdownLayout: c.MarkdownLayout,
+		client:         c.Client,
+	}
+	return e, nil
+}
+
+func init() {
+	emailer.Register("sparkpost", emailer.FactoryOf(New))
+}
+
+// Capabilities returns what sparkpost can honour of an email
+func (c *EmailClient) Capabilities() emailer.Capabilities {
+	return Capabilities
+}
+
+// payload is a request that sparkpost uses to send a transmission
+type payload struct {
+	Recipients []recipient `json:"recipients"`
+	Content    content     `json:"content"`
+}
+
+// recipient is an envelope recipient, sparkpost has no cc or bcc so every recipient carries the To header it is shown
+type recipient struct {
+	Address address `json:"address"`
+}
+
+type address struct {
+	Email    string `json:"email"`
+	HeaderTo string `json:"header_to"`
+}
+
+type content struct {
+	From         string            `json:"from"`
+	Subject      string            `json:"subject"`
+	Text         string            `json:"text,omitempty"`
+	HTML         string            `json:"html,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Attachments  []attachment      `json:"attachments,omitempty"`
+	InlineImages []attachment      `json:"inline_images,omitempty"`
+}
+
+// attachment is a file of sparkpost transmission, inline images are named by their content ID
+type attachment struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Data is base64 encoded by JSON
+	Data []byte `json:"data"`
+}
+
+// result is a response when sparkpost accepts a transmission
+type result struct {
+	Results struct {
+		ID string `json:"id"`
+	} `json:"results"`
+}
+
+// errorMessage is a response when sparkpost encounters a problem with the transmission
+type errorMessage struct {
+	Errors []struct {
+		Message     string `json:"message"`
+		Description string `json:"description,omitempty"`
+		Code        string `json:"code,omitempty"`
+	} `json:"errors"`
+}
+
+// Send sends a given email
+func (c *EmailClient) Send(ctx context.Context, email emailer.Email) error {
+	_, err := c.SendMessage(ctx, email)
+	return err
+}
+
+// SendMessage sends a given email and returns its sparkpost transmission ID.
+// To, CC and BCC are all envelope recipients, CC ones are listed in Cc header and BCC ones in no header
+func (c *EmailClient) SendMessage(ctx context.Context, email emailer.Email) (string, error) {
+	if err := c.Capabilities().Check(email); err != nil {
+		return "", err
+	}
+	email, err := email.RenderMarkdown(c.markdownLayout)
+	if err != nil {
+		return "", fmt.Errorf("email.RenderMarkdown(): %v", err)
+	}
+
+	var p payload
+	headerTo := strings.Join(email.To, ",")
+	for _, e := range slices.Concat(email.To, email.CC, email.BCC) {
+		p.Recipients = append(p.Recipients, recipient{Address: address{Email: e, HeaderTo: headerTo}})
+	}
+	p.Content.From = email.From
+	p.Content.Subject = email.Subject
+	p.Content.Text = email.TextContent
+	p.Content.HTML = email.HTMLContent
+	if len(email.CC) > 0 {
+		p.Content.Headers = map[string]string{"CC": strings.Join(email.CC, ",")}
+	}
+	for _, a := range email.Attachments {
+		contentType := cmp.Or(a.ContentType, "application/octet-stream")
+		if a.ContentID != "" {
+			p.Content.InlineImages = append(p.Content.InlineImages, attachment{Name: a.ContentID, Type: contentType, Data: a.Data})
+			continue
+		}
+		p.Content.Attachments = append(p.Content.Attachments, attachment{Name: a.Filename, Type: contentType, Data: a.Data})
+	}
+
+	var r result
+	if err := c.do(ctx, http.MethodPost, c.baseURL+transmissionsPath, p, &r); err != nil {
+		return "", err
+	}
+	return r.Results.ID, nil
+}
+
+// do sends body as JSON to given target of sparkpost, then decodes a successful response into out when it is not nil
+func (c *EmailClient) do(ctx context.Context, method, target string, body, out any) error {
+	var reqBody io.Reader = http.NoBody
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("json.Marshal(%v): %v", body, err)
+		}
+		reqBody = bytes.NewBuffer(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reqBody)
+	if err != nil {
+		return fmt.Errorf("http.NewRequestWithContext(): %v", err)
+	}
+	req.Header.Add("Authorization", c.key)
+	req.Header.Add("accept", "application/json")
+	req.Header.Add("content-type", "application/json")
+
+	resp, err := emailer.Do(&c.client, req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusOK {
+		if out == nil {
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("json.NewDecoder().Decode(): %v", err)
+		}
+		return nil
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("io.ReadAll(): %v", err)
+	}
+	return emailer.NewStatusError(resp.StatusCode, raw, func(body []byte) (any, bool) {
+		var m errorMessage
+		err := json.Unmarshal(body, &m)
+		return m, err == nil && len(m.Errors) > 0
+	})
+}
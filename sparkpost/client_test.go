@@ -0,0 +1,140 @@
+package sparkpost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+	"github.com/mrwormhole/emailer/emailtest"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name        string
+		c           emailer.Config
+		wantBaseURL string
+		wantErr     string
+	}{
+		{name: "blank key", c: emailer.Config{}, wantErr: "sparkpost API key is blank"},
+		{name: "default region", c: emailer.Config{Key: "key"}, wantBaseURL: baseURL},
+		{name: "us region", c: emailer.Config{Key: "key", Region: "US"}, wantBaseURL: baseURL},
+		{name: "eu region", c: emailer.Config{Key: "key", Region: "eu"}, wantBaseURL: euBaseURL},
+		{name: "base URL override", c: emailer.Config{Key: "key", Region: "eu", BaseURL: "http://localhost/"}, wantBaseURL: "http://localhost"},
+		{name: "unknown region", c: emailer.Config{Key: "key", Region: "ap"}, wantErr: `sparkpost region "ap" is not us or eu`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.c)
+			if tt.wantErr != "" {
+				if err == nil || !cmp.Equal(tt.wantErr, err.Error()) {
+					t.Errorf("New(): got=%v want=%q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New(): %v", err)
+			}
+			if diff := cmp.Diff(tt.wantBaseURL, c.baseURL); diff != "" {
+				t.Errorf("New(): base URL diff=\n %v", diff)
+			}
+		})
+	}
+}
+
+// recipientPaths are the paths of the request body that hold each recipient,
+// every recipient shows the to address in header_to and cc addresses are shown in the Cc header
+var recipientPaths = map[string][]string{
+	"to":  {"recipients.address.email", "recipients.address.header_to"},
+	"cc":  {"content.headers.cc", "recipients.address.email"},
+	"bcc": {"recipients.address.email"},
+}
+
+// errorBody is how sparkpost rejects a request
+const errorBody = `{"errors":[{"message":"conformance failure","code":"1400"}]}`
+
+func TestConformance(t *testing.T) {
+	emailtest.RunSenderConformance(t, func(c emailer.Config) (emailer.Sender, error) {
+		return New(c)
+	}, emailtest.Provider{Fake: emailtest.NewSparkpostServer, Recipients: recipientPaths, ErrorBody: errorBody})
+}
+
+func TestFakeServer(t *testing.T) {
+	srv := emailtest.NewSparkpostServer(t)
+	client, err := New(srv.Config())
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+
+	email := emailer.Email{
+		From:        "a@a.com",
+		To:          []string{"b@b.com", "c@c.com"},
+		CC:          []string{"cc@cc.com"},
+		BCC:         []string{"bcc@bcc.com"},
+		Subject:     "sub",
+		HTMLContent: "html",
+		Attachments: []emailer.Attachment{
+			{Filename: "logo.png", ContentType: "image/png", ContentID: "logo", Data: []byte("png")},
+			{Filename: "report.csv", Data: []byte("a,b")},
+		},
+	}
+	id, err := client.SendMessage(context.Background(), email)
+	if err != nil {
+		t.Fatalf("SendMessage(): %v", err)
+	}
+	if id == "" {
+		t.Error("SendMessage(): transmission ID is empty")
+	}
+	var got payload
+	if err := json.Unmarshal(srv.LastRequest().Body, &got); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
+	}
+	headerTo := "b@b.com,c@c.com"
+	want := payload{
+		Recipients: []recipient{
+			{Address: address{Email: "b@b.com", HeaderTo: headerTo}},
+			{Address: address{Email: "c@c.com", HeaderTo: headerTo}},
+			{Address: address{Email: "cc@cc.com", HeaderTo: headerTo}},
+			{Address: address{Email: "bcc@bcc.com", HeaderTo: headerTo}},
+		},
+		Content: content{
+			From:         "a@a.com",
+			Subject:      "sub",
+			HTML:         "html",
+			Headers:      map[string]string{"CC": "cc@cc.com"},
+			Attachments:  []attachment{{Name: "report.csv", Type: "application/octet-stream", Data: []byte("a,b")}},
+			InlineImages: []attachment{{Name: "logo", Type: "image/png", Data: []byte("png")}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SendMessage(): payload diff=\n %v", diff)
+	}
+
+	email.Subject = ""
+	var statusErr *emailer.StatusError
+	if err := client.Send(context.Background(), email); !errors.As(err, &statusErr) || statusErr.StatusCode != 422 {
+		t.Fatalf("Send(): got=%v want=status code(422)", err)
+	}
+	m, ok := statusErr.Detail.(errorMessage)
+	if !ok || len(m.Errors) != 1 {
+		t.Fatalf("Send(): error detail=%#v want=errorMessage", statusErr.Detail)
+	}
+	if diff := cmp.Diff("content.subject is required", m.Errors[0].Description); diff != "" {
+		t.Errorf("Send(): error description diff=\n %v", diff)
+	}
+
+	cfg := srv.Config()
+	cfg.Key = "wrong-key"
+	client, err = New(cfg)
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	if err := client.Send(context.Background(), email); err == nil || !strings.Contains(err.Error(), "status code(401)") {
+		t.Errorf("Send(): got=%v want=status code(401)", err)
+	}
+}
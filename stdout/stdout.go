@@ -0,0 +1,121 @@
+// Package stdout prints emails instead of sending them, which is handy while developing or running CI without API keys.
+//
+// Example usage:
+//
+//	p := stdout.New(os.Stdout)
+//	p.Send(ctx, email)
+//
+//	l := stdout.NewLogger(slog.Default())
+//	l.Send(ctx, email)
+package stdout
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/mrwormhole/emailer"
+)
+
+// Printer is an email sender that pretty-prints every email to a writer, it is safe for concurrent use
+type Printer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// New creates a printer that writes to w
+func New(w io.Writer) *Printer {
+	return &Printer{w: w}
+}
+
+// Send prints a given email
+func (p *Printer) Send(_ context.Context, e emailer.Email) error {
+	e, err := e.RenderMarkdown(nil)
+	if err != nil {
+		return fmt.Errorf("email.RenderMarkdown(): %v", err)
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Repeat("=", 72) + "\n")
+	for _, h := range []struct{ k, v string }{
+		{"From", e.From},
+		{"To", strings.Join(e.To, ", ")},
+		{"Cc", strings.Join(e.CC, ", ")},
+		{"Bcc", strings.Join(e.BCC, ", ")},
+		{"Subject", e.Subject},
+		{"Send at", formatSendAt(e)},
+		{"Attach", attachmentNames(e)},
+	} {
+		if h.v != "" {
+			fmt.Fprintf(&b, "%-8s %s\n", h.k+":", h.v)
+		}
+	}
+	if e.TextContent != "" {
+		fmt.Fprintf(&b, "%s text %s\n%s\n", strings.Repeat("-", 4), strings.Repeat("-", 62), strings.TrimRight(e.TextContent, "\n"))
+	}
+	if e.HTMLContent != "" {
+		fmt.Fprintf(&b, "%s html %s\n%s\n", strings.Repeat("-", 4), strings.Repeat("-", 62), strings.TrimRight(e.HTMLContent, "\n"))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := io.WriteString(p.w, b.String()); err != nil {
+		return fmt.Errorf("io.WriteString(): %v", err)
+	}
+	return nil
+}
+
+// Logger is an email sender that logs every email as a structured record
+type Logger struct {
+	logger *slog.Logger
+}
+
+// NewLogger creates a logger sender that logs to l at info level
+func NewLogger(l *slog.Logger) *Logger {
+	return &Logger{logger: l}
+}
+
+// Send logs a given email
+func (l *Logger) Send(ctx context.Context, e emailer.Email) error {
+	e, err := e.RenderMarkdown(nil)
+	if err != nil {
+		return fmt.Errorf("email.RenderMarkdown(): %v", err)
+	}
+	attrs := []slog.Attr{
+		slog.String("from", e.From),
+		slog.Any("to", e.To),
+		slog.Any("cc", e.CC),
+		slog.Any("bcc", e.BCC),
+		slog.String("subject", e.Subject),
+		slog.String("textContent", e.TextContent),
+		slog.String("htmlContent", e.HTMLContent),
+	}
+	if s := formatSendAt(e); s != "" {
+		attrs = append(attrs, slog.String("sendAt", s))
+	}
+	if s := attachmentNames(e); s != "" {
+		attrs = append(attrs, slog.String("attachments", s))
+	}
+	l.logger.LogAttrs(ctx, slog.LevelInfo, "email", attrs...)
+	return nil
+}
+
+// attachmentNames lists attachment filenames of e with their sizes
+func attachmentNames(e emailer.Email) string {
+	names := make([]string, 0, len(e.Attachments))
+	for _, a := range e.Attachments {
+		names = append(names, fmt.Sprintf("%s (%d bytes)", a.Filename, len(a.Data)))
+	}
+	return strings.Join(names, ", ")
+}
+
+// formatSendAt formats send at time of e, empty when it is sent immediately
+func formatSendAt(e emailer.Email) string {
+	if e.SendAt.IsZero() {
+		return ""
+	}
+	return e.SendAt.Format("2006-01-02 15:04:05 MST")
+}
@@ -0,0 +1,71 @@
+package stdout
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+)
+
+func TestPrinter(t *testing.T) {
+	var b bytes.Buffer
+	email := emailer.Email{
+		From:            "a@a.com",
+		To:              []string{"b@b.com", "c@c.com"},
+		Subject:         "sub",
+		MarkdownContent: "**md**",
+	}
+	if err := New(&b).Send(context.Background(), email); err != nil {
+		t.Fatalf("Send(): %v", err)
+	}
+
+	want := `========================================================================
+From:    a@a.com
+To:      b@b.com, c@c.com
+Subject: sub
+---- text --------------------------------------------------------------
+md
+---- html --------------------------------------------------------------
+`
+	if diff := cmp.Diff(want, b.String()[:len(want)]); diff != "" {
+		t.Errorf("Send(): output diff=\n %v", diff)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var b bytes.Buffer
+	email := emailer.Email{
+		From:        "a@a.com",
+		To:          []string{"b@b.com"},
+		Subject:     "sub",
+		TextContent: "text",
+	}
+	if err := NewLogger(slog.New(slog.NewJSONHandler(&b, nil))).Send(context.Background(), email); err != nil {
+		t.Fatalf("Send(): %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
+	}
+	delete(got, "time")
+	want := map[string]any{
+		"level":       "INFO",
+		"msg":         "email",
+		"from":        "a@a.com",
+		"to":          []any{"b@b.com"},
+		"cc":          nil,
+		"bcc":         nil,
+		"subject":     "sub",
+		"textContent": "text",
+		"htmlContent": "",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Send(): record diff=\n %v", diff)
+	}
+}
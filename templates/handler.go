@@ -0,0 +1,72 @@
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/mrwormhole/emailer"
+)
+
+// Request is a request to send an email rendered from a template
+type Request struct {
+	From     string         `json:"from"`
+	To       []string       `json:"to"`
+	BCC      []string       `json:"bcc"`
+	CC       []string       `json:"cc"`
+	Template string         `json:"template"`
+	Locale   string         `json:"locale"`
+	Data     map[string]any `json:"data"`
+	SendAt   time.Time      `json:"sendAt,omitzero"`
+}
+
+// HandlerFunc is opinionated/reusable HTTP handler that renders templates from given set and sends them via sender
+func HandlerFunc(set *Set, sender emailer.Sender) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to decode request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		e, err := set.Render(req.Template, req.Locale, req.Data)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to render: %v", err), http.StatusBadRequest)
+			return
+		}
+		e.From = req.From
+		e.To = req.To
+		e.BCC = req.BCC
+		e.CC = req.CC
+		e.SendAt = req.SendAt
+
+		if m := e.ValidationMsg(); m != "" {
+			http.Error(w, fmt.Sprintf("Failed to validate: %v", m), http.StatusBadRequest)
+			return
+		}
+
+		id, err := emailer.SendMessage(r.Context(), sender, e)
+		if errors.Is(err, emailer.ErrIncompatible) {
+			http.Error(w, fmt.Sprintf("Failed to send email: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			slog.LogAttrs(r.Context(), slog.LevelError, fmt.Sprintf("%T.Send()", sender), slog.Any("email", e), slog.String("err", err.Error()))
+			http.Error(w, "Failed to send email", http.StatusInternalServerError)
+			return
+		}
+		if id != "" {
+			w.Header().Set("X-Message-Id", id)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if !e.SendAt.IsZero() {
+			_, _ = fmt.Fprint(w, "Email successfully scheduled")
+			return
+		}
+		_, _ = fmt.Fprint(w, "Email successfully sent")
+	}
+}
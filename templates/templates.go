@@ -0,0 +1,406 @@
+// Package templates renders localized emails from local template files.
+//
+// Templates are loaded from a file system with the layout below. Files at the root of a template directory belong to
+// the default locale, sub directories hold per-locale variants that override them file by file. Message catalogs are
+// flat JSON objects of message keys to [fmt] formats, templates look them up with `{{t "key" args...}}`.
+//
+//	messages/en.json
+//	messages/pt.json
+//	messages/pt-BR.json
+//	welcome/subject.txt
+//	welcome/body.html
+//	welcome/body.txt
+//	welcome/pt/body.html
+//
+// A locale falls back through its parents to the default locale, e.g. `pt-BR` tries `pt-BR`, `pt` then `en`.
+// Every message key used by any template must exist in the default catalog, and every other catalog must translate it
+// within its own fallback chain, otherwise loading fails.
+//
+// Example usage:
+//
+//	 set, err := templates.Load(os.DirFS("templates"), "en")
+//		if err != nil {
+//			//check err
+//		}
+//	 email, err := set.Render("welcome", "pt-BR", map[string]any{"Name": "Ana"})
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"text/template/parse"
+
+	"github.com/mrwormhole/emailer"
+	"github.com/mrwormhole/emailer/cssinline"
+)
+
+const (
+	messagesDir = "messages"
+	subjectFile = "subject.txt"
+	htmlFile    = "body.html"
+	textFile    = "body.txt"
+)
+
+// Set is a collection of localized email templates
+type Set struct {
+	defaultLocale string
+	catalogs      map[string]map[string]string
+	templates     map[string]map[string]*variant
+}
+
+// variant is a locale specific version of a template, nil fields fall back to the next locale
+type variant struct {
+	subject *texttemplate.Template
+	html    *htmltemplate.Template
+	text    *texttemplate.Template
+}
+
+// placeholderFuncs are used at parse time, they are replaced with locale aware funcs at render time
+var placeholderFuncs = map[string]any{
+	"t": func(string, ...any) (string, error) { return "", nil },
+}
+
+// Load parses templates and message catalogs from fsys, defaultLocale is the last resort of every fallback chain
+func Load(fsys fs.FS, defaultLocale string) (*Set, error) {
+	defaultLocale = canonical(defaultLocale)
+	if defaultLocale == "" {
+		return nil, errors.New("default locale is blank")
+	}
+	s := &Set{
+		defaultLocale: defaultLocale,
+		catalogs:      make(map[string]map[string]string),
+		templates:     make(map[string]map[string]*variant),
+	}
+
+	if err := s.loadCatalogs(fsys); err != nil {
+		return nil, err
+	}
+	if _, ok := s.catalogs[defaultLocale]; !ok {
+		s.catalogs[defaultLocale] = make(map[string]string)
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("fs.ReadDir(%q): %v", ".", err)
+	}
+	keys := make(map[string]bool)
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == messagesDir {
+			continue
+		}
+		if err := s.loadTemplate(fsys, e.Name(), keys); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.checkTranslations(slices.Sorted(maps.Keys(keys))); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Locales returns the locales that have a message catalog
+func (s *Set) Locales() []string {
+	return slices.Sorted(maps.Keys(s.catalogs))
+}
+
+// Render renders template name for given locale into an email with subject, HTML and text content filled.
+// Blank locale means the default locale, data is passed to the templates as is.
+func (s *Set) Render(name, locale string, data any) (emailer.Email, error) {
+	variants, ok := s.templates[name]
+	if !ok {
+		return emailer.Email{}, fmt.Errorf("template %q not found", name)
+	}
+	chain := s.fallback(locale)
+	funcs := map[string]any{
+		"t": func(key string, args ...any) (string, error) {
+			for _, l := range chain {
+				if msg, ok := s.catalogs[l][key]; ok {
+					if len(args) == 0 {
+						return msg, nil
+					}
+					return fmt.Sprintf(msg, args...), nil
+				}
+			}
+			return "", fmt.Errorf("missing translation %q for locale %q", key, chain[0])
+		},
+	}
+
+	var (
+		email   emailer.Email
+		subject *texttemplate.Template
+		h       *htmltemplate.Template
+		text    *texttemplate.Template
+	)
+	for _, l := range append(chain, "") {
+		v, ok := variants[l]
+		if !ok {
+			continue
+		}
+		if subject == nil {
+			subject = v.subject
+		}
+		if h == nil {
+			h = v.html
+		}
+		if text == nil {
+			text = v.text
+		}
+	}
+
+	var b bytes.Buffer
+	if err := executeText(&b, subject, funcs, data); err != nil {
+		return emailer.Email{}, err
+	}
+	email.Subject = strings.TrimSpace(b.String())
+
+	if h != nil {
+		b.Reset()
+		c, err := h.Clone()
+		if err != nil {
+			return emailer.Email{}, fmt.Errorf("html.Clone(): %v", err)
+		}
+		if err := c.Funcs(funcs).Execute(&b, data); err != nil {
+			return emailer.Email{}, fmt.Errorf("html.Execute(): %v", err)
+		}
+		out, err := cssinline.Inline(b.String())
+		if err != nil {
+			return emailer.Email{}, fmt.Errorf("cssinline.Inline(): %v", err)
+		}
+		email.HTMLContent = out
+	}
+	if text != nil {
+		b.Reset()
+		if err := executeText(&b, text, funcs, data); err != nil {
+			return emailer.Email{}, err
+		}
+		email.TextContent = b.String()
+	}
+	return email, nil
+}
+
+// executeText executes a clone of t with given funcs
+func executeText(b *bytes.Buffer, t *texttemplate.Template, funcs map[string]any, data any) error {
+	c, err := t.Clone()
+	if err != nil {
+		return fmt.Errorf("%s.Clone(): %v", t.Name(), err)
+	}
+	if err := c.Funcs(funcs).Execute(b, data); err != nil {
+		return fmt.Errorf("%s.Execute(): %v", t.Name(), err)
+	}
+	return nil
+}
+
+// fallback returns the locales to try in order for given locale, e.g. pt-BR gives pt-BR, pt and the default locale
+func (s *Set) fallback(locale string) []string {
+	var chain []string
+	for l := canonical(locale); l != ""; {
+		chain = append(chain, l)
+		i := strings.LastIndex(l, "-")
+		if i < 0 {
+			break
+		}
+		l = l[:i]
+	}
+	if !slices.Contains(chain, s.defaultLocale) {
+		chain = append(chain, s.defaultLocale)
+	}
+	return chain
+}
+
+// loadCatalogs reads message catalogs under the messages directory, a missing directory means no catalogs
+func (s *Set) loadCatalogs(fsys fs.FS) error {
+	entries, err := fs.ReadDir(fsys, messagesDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("fs.ReadDir(%q): %v", messagesDir, err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".json" {
+			continue
+		}
+		name := path.Join(messagesDir, e.Name())
+		raw, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return fmt.Errorf("fs.ReadFile(%q): %v", name, err)
+		}
+		var catalog map[string]string
+		if err := json.Unmarshal(raw, &catalog); err != nil {
+			return fmt.Errorf("json.Unmarshal(%q): %v", name, err)
+		}
+		s.catalogs[canonical(strings.TrimSuffix(e.Name(), ".json"))] = catalog
+	}
+	return nil
+}
+
+// loadTemplate parses the default files and locale variants of template name, message keys in use are added to keys
+func (s *Set) loadTemplate(fsys fs.FS, name string, keys map[string]bool) error {
+	s.templates[name] = make(map[string]*variant)
+
+	root, err := parseVariant(fsys, name, keys)
+	if err != nil {
+		return err
+	}
+	if root.subject == nil {
+		return fmt.Errorf("template %q has no %s", name, subjectFile)
+	}
+	if root.html == nil && root.text == nil {
+		return fmt.Errorf("template %q has neither %s nor %s", name, htmlFile, textFile)
+	}
+	s.templates[name][""] = root
+
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return fmt.Errorf("fs.ReadDir(%q): %v", name, err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		v, err := parseVariant(fsys, path.Join(name, e.Name()), keys)
+		if err != nil {
+			return err
+		}
+		s.templates[name][canonical(e.Name())] = v
+	}
+	return nil
+}
+
+// parseVariant parses the template files under dir, message keys in use are added to keys
+func parseVariant(fsys fs.FS, dir string, keys map[string]bool) (*variant, error) {
+	read := func(file string) (string, bool, error) {
+		name := path.Join(dir, file)
+		raw, err := fs.ReadFile(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("fs.ReadFile(%q): %v", name, err)
+		}
+		return string(raw), true, nil
+	}
+
+	var v variant
+	if raw, ok, err := read(subjectFile); err != nil {
+		return nil, err
+	} else if ok {
+		if v.subject, err = texttemplate.New(subjectFile).Funcs(placeholderFuncs).Parse(raw); err != nil {
+			return nil, fmt.Errorf("parse %q: %v", path.Join(dir, subjectFile), err)
+		}
+		collectKeys(v.subject.Root, keys)
+	}
+	if raw, ok, err := read(htmlFile); err != nil {
+		return nil, err
+	} else if ok {
+		if v.html, err = htmltemplate.New(htmlFile).Funcs(placeholderFuncs).Parse(raw); err != nil {
+			return nil, fmt.Errorf("parse %q: %v", path.Join(dir, htmlFile), err)
+		}
+		collectKeys(v.html.Tree.Root, keys)
+	}
+	if raw, ok, err := read(textFile); err != nil {
+		return nil, err
+	} else if ok {
+		if v.text, err = texttemplate.New(textFile).Funcs(placeholderFuncs).Parse(raw); err != nil {
+			return nil, fmt.Errorf("parse %q: %v", path.Join(dir, textFile), err)
+		}
+		collectKeys(v.text.Root, keys)
+	}
+	return &v, nil
+}
+
+// checkTranslations verifies that the default catalog has every key and other catalogs translate them
+func (s *Set) checkTranslations(keys []string) error {
+	var errs []error
+	for _, locale := range s.Locales() {
+		chain := s.fallback(locale)
+		if locale != s.defaultLocale {
+			chain = slices.DeleteFunc(chain, func(l string) bool { return l == s.defaultLocale })
+		}
+
+		var missing []string
+		for _, key := range keys {
+			if !slices.ContainsFunc(chain, func(l string) bool {
+				_, ok := s.catalogs[l][key]
+				return ok
+			}) {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) > 0 {
+			errs = append(errs, fmt.Errorf("locale %q is missing translations: %s", locale, strings.Join(missing, ", ")))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// collectKeys adds the message keys that are looked up with literal strings under n to keys
+func collectKeys(n parse.Node, keys map[string]bool) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			collectKeys(c, keys)
+		}
+	case *parse.ActionNode:
+		collectKeys(n.Pipe, keys)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectKeys(cmd, keys)
+		}
+	case *parse.CommandNode:
+		if len(n.Args) >= 2 {
+			if ident, ok := n.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "t" {
+				if key, ok := n.Args[1].(*parse.StringNode); ok {
+					keys[key.Text] = true
+				}
+			}
+		}
+		for _, arg := range n.Args {
+			collectKeys(arg, keys)
+		}
+	case *parse.IfNode:
+		collectKeys(&n.BranchNode, keys)
+	case *parse.RangeNode:
+		collectKeys(&n.BranchNode, keys)
+	case *parse.WithNode:
+		collectKeys(&n.BranchNode, keys)
+	case *parse.BranchNode:
+		collectKeys(n.Pipe, keys)
+		collectKeys(n.List, keys)
+		collectKeys(n.ElseList, keys)
+	case *parse.TemplateNode:
+		collectKeys(n.Pipe, keys)
+	}
+}
+
+// canonical normalizes a locale such as `pt_br` into `pt-BR`
+func canonical(locale string) string {
+	parts := strings.FieldsFunc(strings.TrimSpace(locale), func(r rune) bool { return r == '-' || r == '_' })
+	for i, p := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(p)
+		case len(p) == 4:
+			parts[i] = strings.ToUpper(p[:1]) + strings.ToLower(p[1:])
+		default:
+			parts[i] = strings.ToUpper(p)
+		}
+	}
+	return strings.Join(parts, "-")
+}
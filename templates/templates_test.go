@@ -0,0 +1,227 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mrwormhole/emailer"
+)
+
+func newFS() fstest.MapFS {
+	return fstest.MapFS{
+		"messages/en.json":        {Data: []byte(`{"subject": "Welcome %s", "hello": "Hello %s", "bye": "Bye"}`)},
+		"messages/pt.json":        {Data: []byte(`{"subject": "Bem-vindo %s", "hello": "Olá %s", "bye": "Tchau"}`)},
+		"messages/pt-BR.json":     {Data: []byte(`{"bye": "Falou"}`)},
+		"welcome/subject.txt":     {Data: []byte(`{{t "subject" .Name}}`)},
+		"welcome/body.html":       {Data: []byte(`<style>p { color: red }</style><p>{{t "hello" .Name}}</p>`)},
+		"welcome/body.txt":        {Data: []byte(`{{t "hello" .Name}}, {{t "bye"}}`)},
+		"welcome/pt/body.html":    {Data: []byte(`<p>{{t "hello" .Name}}!</p>`)},
+		"plain/subject.txt":       {Data: []byte(`Plain`)},
+		"plain/body.txt":          {Data: []byte(`{{if .Name}}{{t "bye"}}{{end}}`)},
+		"plain/pt-br/subject.txt": {Data: []byte(`Simples`)},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name   string
+		fsys   fstest.MapFS
+		locale string
+		want   string
+	}{
+		{
+			name:   "blank default locale",
+			fsys:   newFS(),
+			locale: " ",
+			want:   "default locale is blank",
+		},
+		{
+			name: "missing subject",
+			fsys: fstest.MapFS{"welcome/body.txt": {Data: []byte(`hi`)}},
+			want: `template "welcome" has no subject.txt`,
+		},
+		{
+			name: "missing body",
+			fsys: fstest.MapFS{"welcome/subject.txt": {Data: []byte(`hi`)}},
+			want: `template "welcome" has neither body.html nor body.txt`,
+		},
+		{
+			name: "broken template",
+			fsys: fstest.MapFS{"welcome/subject.txt": {Data: []byte(`{{`)}},
+			want: `parse "welcome/subject.txt": template: subject.txt:1: unclosed action`,
+		},
+		{
+			name: "missing translations",
+			fsys: fstest.MapFS{
+				"messages/en.json":     {Data: []byte(`{"hello": "Hello"}`)},
+				"messages/de.json":     {Data: []byte(`{"hello": "Hallo"}`)},
+				"messages/fr.json":     {Data: []byte(`{}`)},
+				"welcome/subject.txt":  {Data: []byte(`{{t "hello"}}`)},
+				"welcome/body.txt":     {Data: []byte(`hi`)},
+				"welcome/fr/body.html": {Data: []byte(`{{with .}}{{t "bye"}}{{end}}`)},
+			},
+			want: "locale \"de\" is missing translations: bye\nlocale \"en\" is missing translations: bye\nlocale \"fr\" is missing translations: bye, hello",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locale := tt.locale
+			if locale == "" {
+				locale = "en"
+			}
+			_, err := Load(tt.fsys, locale)
+			if err == nil {
+				t.Fatal("Load(): expected error, got nil")
+			}
+			if diff := cmp.Diff(tt.want, err.Error()); diff != "" {
+				t.Errorf("Load(): diff=\n %v", diff)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	set, err := Load(newFS(), "en")
+	if err != nil {
+		t.Fatalf("Load(): %v", err)
+	}
+	if diff := cmp.Diff([]string{"en", "pt", "pt-BR"}, set.Locales()); diff != "" {
+		t.Errorf("Locales(): diff=\n %v", diff)
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		locale   string
+		want     emailer.Email
+	}{
+		{
+			name:     "default locale",
+			template: "welcome",
+			want: emailer.Email{
+				Subject:     "Welcome Ana",
+				HTMLContent: `<html><head></head><body><p style="color: red">Hello Ana</p></body></html>`,
+				TextContent: "Hello Ana, Bye",
+			},
+		},
+		{
+			name:     "unknown locale falls back to default",
+			template: "welcome",
+			locale:   "de-DE",
+			want: emailer.Email{
+				Subject:     "Welcome Ana",
+				HTMLContent: `<html><head></head><body><p style="color: red">Hello Ana</p></body></html>`,
+				TextContent: "Hello Ana, Bye",
+			},
+		},
+		{
+			name:     "region falls back to language",
+			template: "welcome",
+			locale:   "pt_br",
+			want: emailer.Email{
+				Subject:     "Bem-vindo Ana",
+				HTMLContent: `<html><head></head><body><p>Olá Ana!</p></body></html>`,
+				TextContent: "Olá Ana, Falou",
+			},
+		},
+		{
+			name:     "localized subject variant",
+			template: "plain",
+			locale:   "pt-BR",
+			want: emailer.Email{
+				Subject:     "Simples",
+				TextContent: "Falou",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := set.Render(tt.template, tt.locale, map[string]any{"Name": "Ana"})
+			if err != nil {
+				t.Fatalf("Render(): %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Render(): diff=\n %v", diff)
+			}
+		})
+	}
+}
+
+func TestRender_UnknownTemplate(t *testing.T) {
+	set, err := Load(newFS(), "en")
+	if err != nil {
+		t.Fatalf("Load(): %v", err)
+	}
+	_, err = set.Render("missing", "en", nil)
+	if diff := cmp.Diff(`template "missing" not found`, err.Error()); diff != "" {
+		t.Errorf("Render(): diff=\n %v", diff)
+	}
+}
+
+func TestHandlerFunc(t *testing.T) {
+	set, err := Load(newFS(), "en")
+	if err != nil {
+		t.Fatalf("Load(): %v", err)
+	}
+	var got emailer.Email
+	sender := emailer.SenderFunc(func(_ context.Context, e emailer.Email) error {
+		got = e
+		return nil
+	})
+
+	tests := []struct {
+		name     string
+		req      Request
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "unknown template",
+			req:      Request{From: "a@a.com", To: []string{"b@b.com"}, Template: "missing"},
+			wantCode: http.StatusBadRequest,
+			wantBody: "Failed to render: template \"missing\" not found\n",
+		},
+		{
+			name:     "failed validation",
+			req:      Request{From: "a@a.com", Template: "welcome"},
+			wantCode: http.StatusBadRequest,
+			wantBody: "Failed to validate: to field must not be blank\n",
+		},
+		{
+			name:     "success",
+			req:      Request{From: "a@a.com", To: []string{"b@b.com"}, Template: "plain", Locale: "pt-BR", Data: map[string]any{"Name": "Ana"}},
+			wantCode: http.StatusOK,
+			wantBody: "Email successfully sent",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := json.Marshal(tt.req)
+			if err != nil {
+				t.Fatalf("json.Marshal(%v): %v", tt.req, err)
+			}
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/email/template", bytes.NewBuffer(raw))
+			rr := httptest.NewRecorder()
+			HandlerFunc(set, sender).ServeHTTP(rr, req)
+
+			if diff := cmp.Diff(tt.wantCode, rr.Code); diff != "" {
+				t.Errorf("HandlerFunc(): HTTP code diff=\n %v", diff)
+			}
+			if diff := cmp.Diff(tt.wantBody, rr.Body.String()); diff != "" {
+				t.Errorf("HandlerFunc(): HTTP body diff=\n %v", diff)
+			}
+		})
+	}
+
+	want := emailer.Email{From: "a@a.com", To: []string{"b@b.com"}, Subject: "Simples", TextContent: "Falou"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("HandlerFunc(): sent email diff=\n %v", diff)
+	}
+}